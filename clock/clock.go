@@ -0,0 +1,56 @@
+//Package clock provides the clocks used by the schedulers, so the current time can be controlled in tests
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+//Clock is used by the schedulers to get the current time, so it can be replaced in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+//SystemClock returns the current system time
+var SystemClock Clock = systemClock{}
+
+//ManualClock only advances if it's told to (e.g. in tests)
+type ManualClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+//NewManualClock returns a ManualClock set to the specified time
+func NewManualClock(Now time.Time) *ManualClock {
+	return &ManualClock{now: Now}
+}
+
+//Now returns the current time of the clock
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+//Set sets the clock to the specified time
+func (c *ManualClock) Set(Now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = Now
+}
+
+//Advance moves the clock forward by the duration
+func (c *ManualClock) Advance(Duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(Duration)
+}
@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+)
+
+const loggingArea = "CLUSTER"
+
+//Store is used to persist the membership and the leadership
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type Store interface {
+	HeartbeatMember(ctx context.Context, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error)
+	RemoveMember(ctx context.Context, ID uuid.UUID) error
+	GetLiveMembers(ctx context.Context, At time.Time) ([]models.ClusterMember, error)
+
+	AcquireLeadership(ctx context.Context, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error)
+	RenewLeadership(ctx context.Context, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error)
+	ResignLeadership(ctx context.Context, Leadership models.Leadership) error
+}
+
+//Options defines the timings of the membership and the leader election
+//Tick has to be called more often than HeartbeatTTL and LeaderLease, otherwise the node drops out of the cluster / loses its leadership
+type Options struct {
+	//Election is the name of the leader election
+	Election string
+	//HeartbeatTTL defines how long a member is regarded alive after its last heartbeat
+	HeartbeatTTL time.Duration
+	//LeaderLease defines how long the leadership is valid after it was acquired or renewed
+	LeaderLease time.Duration
+}
+
+//DefaultOptions is used by NewNode
+var DefaultOptions = Options{
+	Election:     "flowkeeper",
+	HeartbeatTTL: 30 * time.Second,
+	LeaderLease:  30 * time.Second,
+}
+
+//State is the view of the cluster after a tick
+type State struct {
+	//Members contains all live members ordered by their ID (including the node itself)
+	Members []models.ClusterMember
+	//Leader is true if the node is the leader
+	Leader     bool
+	Leadership models.Leadership
+}
+
+//Node is a single FlowKeeper server taking part in the cluster
+//The leader should run the tasks which may only run once per cluster (e.g. the online detection or purging agents)
+type Node struct {
+	Store   Store
+	Member  models.ClusterMember
+	Options Options
+
+	mutex      sync.Mutex
+	leadership models.Leadership
+}
+
+//NewNode returns a node with a new random member ID using the default options
+func NewNode(Store Store, Hostname string) *Node {
+	return &Node{
+		Store:   Store,
+		Member:  models.ClusterMember{ID: uuid.New(), Hostname: Hostname},
+		Options: DefaultOptions,
+	}
+}
+
+//Tick sends the heartbeat of the node, acquires or renews the leadership and returns the live members
+func (n *Node) Tick(ctx context.Context) (State, error) {
+	if _, err := n.Store.HeartbeatMember(ctx, n.Member, n.Options.HeartbeatTTL); err != nil {
+		return State{Leadership: n.Leadership()}, err
+	}
+
+	leadership, err := n.elect(ctx)
+	if err != nil {
+		return State{Leadership: leadership}, err
+	}
+
+	members, err := n.Store.GetLiveMembers(ctx, time.Now())
+	if err != nil {
+		return State{Leadership: leadership}, err
+	}
+
+	return State{
+		Members:    members,
+		Leader:     leadership.HeldBy(n.Member.ID, time.Now()),
+		Leadership: leadership,
+	}, nil
+}
+
+//elect renews the leadership if the node is the leader or tries to acquire it otherwise
+func (n *Node) elect(ctx context.Context) (models.Leadership, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.leadership.Leader == n.Member.ID {
+		renewed, err := n.Store.RenewLeadership(ctx, n.leadership, n.Options.LeaderLease)
+		if err == nil {
+			n.leadership = renewed
+			return renewed, nil
+		}
+		if !errors.Is(err, dbtemplate.ErrLeadershipLost) {
+			//The leadership is kept until it expires, so a short database outage doesn't cause a new election
+			return n.leadership, err
+		}
+
+		logger.Error(loggingArea, "Lost leadership of", n.Options.Election)
+		n.leadership = models.Leadership{}
+	}
+
+	acquired, err := n.Store.AcquireLeadership(ctx, n.Options.Election, n.Member.ID, n.Options.LeaderLease)
+	if errors.Is(err, dbtemplate.ErrLeadershipHeld) {
+		return n.leadership, nil
+	}
+	if err != nil {
+		return n.leadership, err
+	}
+
+	logger.Debug(loggingArea, "Acquired leadership of", n.Options.Election, "in term", acquired.Term)
+	n.leadership = acquired
+	return acquired, nil
+}
+
+//Leadership returns the leadership held by the node, it is empty if the node isn't the leader
+func (n *Node) Leadership() models.Leadership {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.leadership
+}
+
+//IsLeader returns true if the node holds an unexpired leadership
+func (n *Node) IsLeader() bool {
+	return n.Leadership().HeldBy(n.Member.ID, time.Now())
+}
+
+//Leave resigns the leadership and removes the node from the cluster, so the other members take over right away
+func (n *Node) Leave(ctx context.Context) error {
+	n.mutex.Lock()
+	leadership := n.leadership
+	n.leadership = models.Leadership{}
+	n.mutex.Unlock()
+
+	if leadership.Leader == n.Member.ID {
+		if err := n.Store.ResignLeadership(ctx, leadership); err != nil && !errors.Is(err, dbtemplate.ErrLeadershipLost) {
+			return err
+		}
+	}
+
+	if err := n.Store.RemoveMember(ctx, n.Member.ID); err != nil && !errors.Is(err, dbtemplate.ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package cluster
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//DefaultReplicas is the number of points every member gets on the hash ring
+//More points spread the agents more evenly across the members
+var DefaultReplicas = 128
+
+//Ring assigns agents to members via consistent hashing
+//If a member joins or leaves, only the agents of the ring segments next to its points move to another member
+type Ring struct {
+	points  []uint64
+	owners  map[uint64]uuid.UUID
+	members []uuid.UUID
+}
+
+//NewRing builds the hash ring for the specified members
+//Replicas defaults to DefaultReplicas if it isn't greater than zero
+func NewRing(Members []uuid.UUID, Replicas int) *Ring {
+	if Replicas <= 0 {
+		Replicas = DefaultReplicas
+	}
+
+	r := &Ring{
+		points:  make([]uint64, 0, len(Members)*Replicas),
+		owners:  make(map[uint64]uuid.UUID),
+		members: sortedMembers(Members),
+	}
+
+	for _, member := range r.members {
+		for i := 0; i < Replicas; i++ {
+			point := hash(append(member[:], strconv.Itoa(i)...))
+			//Collisions are resolved deterministically, so every member builds the same ring
+			if owner, taken := r.owners[point]; taken && lessUUID(owner, member) {
+				continue
+			} else if !taken {
+				r.points = append(r.points, point)
+			}
+			r.owners[point] = member
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+
+	return r
+}
+
+//Members returns the members of the ring ordered by their ID
+func (r *Ring) Members() []uuid.UUID {
+	return append(make([]uuid.UUID, 0, len(r.members)), r.members...)
+}
+
+//Owner returns the member the agent is assigned to
+//The returned bool is false if the ring has no members
+func (r *Ring) Owner(AgentID primitive.ObjectID) (uuid.UUID, bool) {
+	if len(r.points) == 0 {
+		return uuid.Nil, false
+	}
+
+	point := hash(AgentID[:])
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]], true
+}
+
+//Partitioner assigns agents to the live members of the cluster
+//It is rebuilt via Update whenever the membership changes, so every member can compute the same assignment independently
+type Partitioner struct {
+	//Self is the member ID of the local node
+	Self     uuid.UUID
+	Replicas int
+
+	mutex sync.RWMutex
+	ring  *Ring
+}
+
+//NewPartitioner returns a partitioner for the local node without any members
+func NewPartitioner(Self uuid.UUID) *Partitioner {
+	return &Partitioner{Self: Self, Replicas: DefaultReplicas, ring: NewRing(nil, DefaultReplicas)}
+}
+
+//Update rebuilds the ring if the set of members changed
+//The returned bool is true if the members changed, so agents may have moved to other members
+func (p *Partitioner) Update(Members []models.ClusterMember) bool {
+	ids := make([]uuid.UUID, 0, len(Members))
+	for _, k := range Members {
+		ids = append(ids, k.ID)
+	}
+	ids = sortedMembers(ids)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ring != nil && equalMembers(p.ring.members, ids) {
+		return false
+	}
+
+	p.ring = NewRing(ids, p.Replicas)
+	return true
+}
+
+//Ring returns the current hash ring
+func (p *Partitioner) Ring() *Ring {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.ring == nil {
+		return NewRing(nil, p.Replicas)
+	}
+
+	return p.ring
+}
+
+//Owns returns true if the agent is assigned to the local node
+func (p *Partitioner) Owns(AgentID primitive.ObjectID) bool {
+	owner, found := p.Ring().Owner(AgentID)
+	return found && owner == p.Self
+}
+
+//Filter returns the agents assigned to the local node
+//Ownership only decides which node should scrape an agent, the scraper lease still has to be acquired, as other members may have a different view of the cluster for a short time
+func (p *Partitioner) Filter(Agents []models.Agent) []models.Agent {
+	ring := p.Ring()
+
+	owned := make([]models.Agent, 0)
+	for _, k := range Agents {
+		if owner, found := ring.Owner(k.ID); found && owner == p.Self {
+			owned = append(owned, k)
+		}
+	}
+
+	return owned
+}
+
+//Assignments returns the IDs of the agents assigned to every member
+func (p *Partitioner) Assignments(Agents []models.Agent) map[uuid.UUID][]primitive.ObjectID {
+	ring := p.Ring()
+
+	assignments := make(map[uuid.UUID][]primitive.ObjectID)
+	for _, k := range ring.members {
+		assignments[k] = make([]primitive.ObjectID, 0)
+	}
+	for _, k := range Agents {
+		if owner, found := ring.Owner(k.ID); found {
+			assignments[owner] = append(assignments[owner], k.ID)
+		}
+	}
+
+	return assignments
+}
+
+func hash(Data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(Data)
+	sum := h.Sum64()
+
+	//fnv spreads short, similar inputs poorly, so the result is mixed once more (splitmix64 finalizer)
+	sum ^= sum >> 30
+	sum *= 0xbf58476d1ce4e5b9
+	sum ^= sum >> 27
+	sum *= 0x94d049bb133111eb
+	sum ^= sum >> 31
+
+	return sum
+}
+
+func sortedMembers(Members []uuid.UUID) []uuid.UUID {
+	sorted := make([]uuid.UUID, 0, len(Members))
+	seen := make(map[uuid.UUID]bool)
+	for _, k := range Members {
+		if k != uuid.Nil && !seen[k] {
+			seen[k] = true
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return lessUUID(sorted[i], sorted[j]) })
+
+	return sorted
+}
+
+func equalMembers(A []uuid.UUID, B []uuid.UUID) bool {
+	if len(A) != len(B) {
+		return false
+	}
+
+	for i := range A {
+		if A[i] != B[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lessUUID(A uuid.UUID, B uuid.UUID) bool {
+	return bytes.Compare(A[:], B[:]) < 0
+}
@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newMembers(Count int) []uuid.UUID {
+	members := make([]uuid.UUID, Count)
+	for i := range members {
+		members[i] = uuid.New()
+	}
+
+	return members
+}
+
+func newAgentIDs(Count int) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, Count)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+
+	return ids
+}
+
+//owners returns the owner of every agent
+func owners(t *testing.T, Ring *Ring, AgentIDs []primitive.ObjectID) map[primitive.ObjectID]uuid.UUID {
+	t.Helper()
+
+	owned := make(map[primitive.ObjectID]uuid.UUID)
+	for _, k := range AgentIDs {
+		owner, found := Ring.Owner(k)
+		if !found {
+			t.Fatal("agent has no owner")
+		}
+		owned[k] = owner
+	}
+
+	return owned
+}
+
+func TestRingDeterministic(t *testing.T) {
+	members := newMembers(4)
+	agents := newAgentIDs(500)
+
+	//The order and duplicates of the members mustn't influence the ring
+	reversed := []uuid.UUID{members[3], members[2], members[1], members[0], members[1]}
+	first, second := owners(t, NewRing(members, 0), agents), owners(t, NewRing(reversed, 0), agents)
+	for _, k := range agents {
+		if first[k] != second[k] {
+			t.Fatal("rings with the same members assign agents differently")
+		}
+	}
+
+	if _, found := NewRing(nil, 0).Owner(agents[0]); found {
+		t.Fatal("empty ring returned an owner")
+	}
+}
+
+func TestRingStability(t *testing.T) {
+	members := newMembers(5)
+	agents := newAgentIDs(2000)
+	before := owners(t, NewRing(members, 0), agents)
+	joining := uuid.New()
+
+	cases := []struct {
+		name    string
+		members []uuid.UUID
+		//changed is the member which gained or lost agents
+		changed uuid.UUID
+	}{
+		{"member leaves", members[1:], members[0]},
+		{"member joins", append(append(make([]uuid.UUID, 0), members...), joining), joining},
+	}
+
+	for _, k := range cases {
+		after := owners(t, NewRing(k.members, 0), agents)
+
+		moved := 0
+		for _, agent := range agents {
+			if before[agent] == after[agent] {
+				continue
+			}
+			moved++
+
+			//Only the agents of the leaving member move, or agents move to the joining member
+			if before[agent] != k.changed && after[agent] != k.changed {
+				t.Fatalf("%s: agent moved from %s to %s", k.name, before[agent], after[agent])
+			}
+		}
+
+		//About a fifth / sixth of the agents should move, allow for an uneven distribution
+		if moved == 0 || moved > len(agents)/3 {
+			t.Errorf("%s: %d of %d agents moved", k.name, moved, len(agents))
+		}
+	}
+}
+
+func TestRingBalance(t *testing.T) {
+	members := newMembers(4)
+	counts := make(map[uuid.UUID]int)
+	for _, owner := range owners(t, NewRing(members, 0), newAgentIDs(4000)) {
+		counts[owner]++
+	}
+
+	for _, k := range members {
+		if counts[k] < 500 || counts[k] > 1500 {
+			t.Errorf("member %s owns %d of 4000 agents", k, counts[k])
+		}
+	}
+}
+
+func TestPartitioner(t *testing.T) {
+	members := newMembers(3)
+	clusterMembers := make([]models.ClusterMember, len(members))
+	for i, k := range members {
+		clusterMembers[i] = models.ClusterMember{ID: k}
+	}
+
+	agents := make([]models.Agent, 0)
+	for _, k := range newAgentIDs(300) {
+		agents = append(agents, models.Agent{ID: k})
+	}
+
+	partitioners := make([]*Partitioner, len(members))
+	for i, k := range members {
+		partitioners[i] = NewPartitioner(k)
+		if !partitioners[i].Update(clusterMembers) {
+			t.Fatal("first update didn't change the members")
+		}
+		if partitioners[i].Update([]models.ClusterMember{clusterMembers[2], clusterMembers[0], clusterMembers[1]}) {
+			t.Fatal("update with the same members changed the ring")
+		}
+	}
+
+	//Every agent is owned by exactly one member
+	owned := make(map[primitive.ObjectID]int)
+	for _, p := range partitioners {
+		for _, k := range p.Filter(agents) {
+			owned[k.ID]++
+			if !p.Owns(k.ID) {
+				t.Fatal("filtered agent isn't owned")
+			}
+		}
+	}
+	if len(owned) != len(agents) {
+		t.Fatal(len(agents)-len(owned), "agents aren't owned by any member")
+	}
+	for id, count := range owned {
+		if count != 1 {
+			t.Fatal("agent", id.Hex(), "is owned by", count, "members")
+		}
+	}
+
+	assignments := partitioners[0].Assignments(agents)
+	total := 0
+	for _, k := range members {
+		total += len(assignments[k])
+	}
+	if len(assignments) != len(members) || total != len(agents) {
+		t.Fatal("assignments don't cover all agents:", len(assignments), total)
+	}
+}
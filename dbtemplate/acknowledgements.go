@@ -0,0 +1,127 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//AcknowledgeProblem marks the current problem of the trigger assignment as acknowledged
+//The severity of the problem is changed if Acknowledgement.Severity is set, the time and action are set automatically
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func AcknowledgeProblem(Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement) error {
+	return AcknowledgeProblemContext(context.Background(), Client, AgentID, TriggerID, Acknowledgement)
+}
+
+//AcknowledgeProblemContext marks the current problem of the trigger assignment as acknowledged
+//The severity of the problem is changed if Acknowledgement.Severity is set, the time and action are set automatically
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func AcknowledgeProblemContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement) error {
+	Acknowledgement.Action = models.ProblemAcknowledged
+
+	set := bson.M{"triggermappings.$.acknowledged": true}
+	if Acknowledgement.Severity != nil {
+		set["triggermappings.$.severityoverride"] = *Acknowledgement.Severity
+	}
+
+	return updateProblem(ctx, Client, AgentID, TriggerID, Acknowledgement, set)
+}
+
+//UnacknowledgeProblem revokes the acknowledgement of the current problem of the trigger assignment
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func UnacknowledgeProblem(Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return UnacknowledgeProblemContext(context.Background(), Client, AgentID, TriggerID, User, Comment)
+}
+
+//UnacknowledgeProblemContext revokes the acknowledgement of the current problem of the trigger assignment
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func UnacknowledgeProblemContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return updateProblem(ctx, Client, AgentID, TriggerID, models.Acknowledgement{
+		User:    User,
+		Action:  models.ProblemUnacknowledged,
+		Comment: Comment,
+	}, bson.M{"triggermappings.$.acknowledged": false})
+}
+
+//CloseProblem manually closes the current problem of the trigger assignment and stores a TriggerEvent for it
+//The assignment stays unproblematic until the expression recovers, afterwards new problems are detected again
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func CloseProblem(Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return CloseProblemContext(context.Background(), Client, AgentID, TriggerID, User, Comment)
+}
+
+//CloseProblemContext manually closes the current problem of the trigger assignment and stores a TriggerEvent for it
+//The assignment stays unproblematic until the expression recovers, afterwards new problems are detected again
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func CloseProblemContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	if err := updateProblem(ctx, Client, AgentID, TriggerID, models.Acknowledgement{
+		User:    User,
+		Action:  models.ProblemClosed,
+		Comment: Comment,
+	}, bson.M{
+		"triggermappings.$.problematic":    false,
+		"triggermappings.$.manuallyclosed": true,
+		"triggermappings.$.error":          "",
+	}); err != nil {
+		return err
+	}
+
+	//The problem is already closed, so the caller mustn't retry it just because the event couldn't be stored
+	event := newTriggerEvent(ctx, NewMongoStore(Client), AgentID, TriggerID, false, "")
+	event.User = User
+	if _, err := InsertTriggerEventContext(ctx, Client, event); err != nil {
+		logger.Error(loggingArea, "Couldn't store trigger event of agent", AgentID.Hex(), "and trigger", TriggerID.Hex(), ":", err)
+	}
+
+	return nil
+}
+
+//updateProblem applies the update to the trigger assignment and records the acknowledgement
+//The update is only applied if the assignment is problematic, so a problem can't be acknowledged / closed after it recovered
+func updateProblem(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement, Set bson.M) error {
+	Acknowledgement.Time = time.Now()
+	if err := Acknowledgement.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	result, err := Client.Collection("agents").UpdateOne(ctx, bson.M{
+		"_id": AgentID,
+		"triggermappings": bson.M{"$elemMatch": bson.M{
+			"triggerid":   TriggerID,
+			"problematic": true,
+		}},
+	}, bson.M{
+		"$set":  Set,
+		"$push": bson.M{"triggermappings.$.acknowledgements": Acknowledgement},
+	})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't update problem:", err)
+		return err
+	}
+
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	//Distinguish between a missing and an unproblematic trigger assignment
+	count, err := Client.Collection("agents").CountDocuments(ctx, bson.M{"_id": AgentID, "triggermappings.triggerid": TriggerID})
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read trigger assignment:", err)
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrNoProblem
+}
@@ -17,18 +17,28 @@ const loggingArea = "DB"
 
 //GetAgent returns the appropriate agent for the given ID
 func GetAgent(Client *mongo.Database, ID primitive.ObjectID) (models.Agent, error) {
-	return getAgentByField(Client, "_id", ID)
+	return GetAgentContext(context.Background(), Client, ID)
+}
+
+//GetAgentContext returns the appropriate agent for the given ID
+func GetAgentContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) (models.Agent, error) {
+	return getAgentByField(ctx, Client, "_id", ID)
 }
 
 //GetAgentByUUID returns the appropriate agent for the given UUID
 func GetAgentByUUID(Client *mongo.Database, UUID uuid.UUID) (models.Agent, error) {
-	return getAgentByField(Client, "agentuuid", UUID)
+	return GetAgentByUUIDContext(context.Background(), Client, UUID)
 }
 
-func getAgentByField(Client *mongo.Database, Field string, Value interface{}) (models.Agent, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+//GetAgentByUUIDContext returns the appropriate agent for the given UUID
+func GetAgentByUUIDContext(ctx context.Context, Client *mongo.Database, UUID uuid.UUID) (models.Agent, error) {
+	return getAgentByField(ctx, Client, "agentuuid", UUID)
+}
+
+func getAgentByField(ctx context.Context, Client *mongo.Database, Field string, Value interface{}) (models.Agent, error) {
+	queryCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
 	defer cancel()
-	result := Client.Collection("agents").FindOne(ctx, bson.M{Field: Value})
+	result := Client.Collection("agents").FindOne(queryCtx, bson.M{Field: Value})
 
 	if result.Err() != nil {
 		if !errors.Is(result.Err(), mongo.ErrNoDocuments) {
@@ -44,7 +54,7 @@ func getAgentByField(Client *mongo.Database, Field string, Value interface{}) (m
 		return models.Agent{}, err
 	}
 
-	if err := populateAgentFields(Client, &agent); err != nil {
+	if err := populateAgentFields(ctx, NewMongoStore(Client), &agent); err != nil {
 		return models.Agent{}, err
 	}
 
@@ -53,40 +63,129 @@ func getAgentByField(Client *mongo.Database, Field string, Value interface{}) (m
 
 //GetAllAgents returns all agents from the database
 func GetAllAgents(Client *mongo.Database) ([]models.Agent, error) {
-	var agents []models.Agent
+	return GetAllAgentsContext(context.Background(), Client)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	result, err := Client.Collection("agents").Find(ctx, bson.M{"$or": []bson.M{
-		{"deleted": false},
-		{"deleted": bson.M{"$exists": false}},
-	}})
+//GetAllAgentsContext returns all agents from the database
+//Deleted agents aren't returned, use GetAgents to filter by other lifecycle states
+func GetAllAgentsContext(ctx context.Context, Client *mongo.Database) ([]models.Agent, error) {
+	return GetAgentsContext(ctx, Client, AgentFilter{})
+}
 
-	if err != nil {
-		logger.Error(loggingArea, "Couldn't fetch agents from db:", err)
-		return agents, err
-	}
+//CreateAgent validates and persists a new agent
+//The returned agent contains the generated ID
+func CreateAgent(Client *mongo.Database, Agent models.Agent) (models.Agent, error) {
+	return CreateAgentContext(context.Background(), Client, Agent)
+}
 
-	err = result.All(ctx, &agents)
+//CreateAgentContext validates and persists a new agent
+//The returned agent contains the generated ID
+func CreateAgentContext(ctx context.Context, Client *mongo.Database, Agent models.Agent) (models.Agent, error) {
+	if err := Agent.Validate(); err != nil {
+		return models.Agent{}, err
+	}
 
+	countCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+	count, err := Client.Collection("agents").CountDocuments(countCtx, bson.M{"agentuuid": Agent.AgentUUID})
 	if err != nil {
-		logger.Error(loggingArea, "Couldn't decode agents:", err)
+		logger.Error(loggingArea, "Couldn't check if agent already exists:", err)
+		return models.Agent{}, err
+	}
+	if count > 0 {
+		return models.Agent{}, ErrAgentExists
 	}
 
-	if agents == nil {
-		agents = make([]models.Agent, 0)
+	Agent.ID = primitive.NewObjectID()
+	if Agent.TemplateIDs == nil {
+		Agent.TemplateIDs = make([]primitive.ObjectID, 0)
+	}
+	if Agent.TriggerMappings == nil {
+		Agent.TriggerMappings = make([]models.TriggerAssignment, 0)
 	}
+	Agent = initLifecycle(Agent)
 
-	for i := range agents {
-		if err := populateAgentFields(Client, &agents[i]); err != nil {
-			return agents, err
+	insertCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("agents").InsertOne(insertCtx, Agent); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Agent{}, ErrAgentExists
 		}
+
+		logger.Error(loggingArea, "Couldn't insert agent:", err)
+		return models.Agent{}, err
+	}
+
+	return Agent, nil
+}
+
+//UpdateAgent validates and persists the changes of an existing agent
+//Only the user editable fields are updated, state which is maintained by FlowKeeper itself (trigger assignments, scraper lock, ...) is left untouched
+//The lifecycle state (and with it Enabled) is changed via SetAgentLifecycle
+func UpdateAgent(Client *mongo.Database, Agent models.Agent) error {
+	return UpdateAgentContext(context.Background(), Client, Agent)
+}
+
+//UpdateAgentContext validates and persists the changes of an existing agent
+//Only the user editable fields are updated, state which is maintained by FlowKeeper itself (trigger assignments, scraper lock, ...) is left untouched
+//The lifecycle state (and with it Enabled) is changed via SetAgentLifecycle
+func UpdateAgentContext(ctx context.Context, Client *mongo.Database, Agent models.Agent) error {
+	if err := Agent.Validate(); err != nil {
+		return err
+	}
+
+	if Agent.TemplateIDs == nil {
+		Agent.TemplateIDs = make([]primitive.ObjectID, 0)
+	}
+	if Agent.Tags == nil {
+		Agent.Tags = make([]string, 0)
+	}
+	if Agent.ItemSchedules == nil {
+		Agent.ItemSchedules = make([]models.ItemSchedule, 0)
+	}
+	if Agent.Macros == nil {
+		Agent.Macros = make(map[string]string)
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Client.Collection("agents").UpdateOne(ctx, bson.M{"_id": Agent.ID}, bson.M{"$set": bson.M{
+		"name":           Agent.Name,
+		"description":    Agent.Description,
+		"os":             Agent.OS,
+		"templateids":    Agent.TemplateIDs,
+		"endpoint":       Agent.Endpoint,
+		"scrapeinterval": Agent.ScrapeInterval,
+		"tags":           Agent.Tags,
+		"itemschedules":  Agent.ItemSchedules,
+		"macros":         Agent.Macros,
+	}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't update agent:", err)
+		return err
 	}
 
-	return agents, nil
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+//DeleteAgent moves the specified agent into the deleted lifecycle state
+//Deleted agents are no longer returned by GetAllAgents, they can be restored via RestoreAgent until they are purged
+func DeleteAgent(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteAgentContext(context.Background(), Client, ID)
 }
 
-func populateAgentFields(Client *mongo.Database, Agent *models.Agent) error {
+//DeleteAgentContext moves the specified agent into the deleted lifecycle state
+//Deleted agents are no longer returned by GetAllAgents, they can be restored via RestoreAgent until they are purged
+func DeleteAgentContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return SetAgentLifecycleContext(ctx, Client, ID, models.LifecycleDeleted, "")
+}
+
+func populateAgentFields(ctx context.Context, Store Store, Agent *models.Agent) error {
 	//Fix if array is nil
 	if Agent.TemplateIDs == nil {
 		Agent.TemplateIDs = make([]primitive.ObjectID, 0)
@@ -100,28 +199,12 @@ func populateAgentFields(Client *mongo.Database, Agent *models.Agent) error {
 
 	if len(Agent.TemplateIDs) > 0 {
 		var err error
-		Agent.Templates, err = GetTemplates(Client, Agent.TemplateIDs)
+		Agent.Templates, err = Store.GetTemplates(ctx, Agent.TemplateIDs)
 		if err != nil {
 			return err
 		}
 	}
 
-	//Check if all trigger assignments are still referencing triggers assigned to the agent
-	for _, k := range Agent.TriggerMappings {
-		if _, err := Agent.GetTrigger(k.TriggerID); err != nil {
-			logger.Debug(loggingArea, "Found outdated trigger assignment on agent", Agent.Name, "-> Removing it")
-			//ToDo: Remove trigger assignment
-		}
-	}
-
-	//Check if all assigned triggers have a valid trigger assignment
-	for _, trigger := range Agent.GetAllTriggers() {
-		if _, err := Agent.GetTriggerMappingByTriggerID(trigger.ID); err != nil {
-			logger.Debug(loggingArea, "Found trigger without trigger assignement on agent", Agent.Name, "-> Adding it")
-			AddTriggerAssignment(Client, Agent.ID, trigger.ID)
-		}
-	}
-
 	return nil
 }
 
@@ -130,18 +213,24 @@ func AddTriggerAssignment(Client *mongo.Database, AgentID primitive.ObjectID, Tr
 	return AddTriggerAssignments(Client, AgentID, []primitive.ObjectID{TriggerID})
 }
 
+//AddTriggerAssignmentContext persist a mapping between an agent and a trigger
+func AddTriggerAssignmentContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID) error {
+	return AddTriggerAssignmentsContext(ctx, Client, AgentID, []primitive.ObjectID{TriggerID})
+}
+
 //AddTriggerAssignments persist a mapping between an agent and one or multiple triggers
 func AddTriggerAssignments(Client *mongo.Database, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID) error {
+	return AddTriggerAssignmentsContext(context.Background(), Client, AgentID, TriggerIDs)
+}
+
+//AddTriggerAssignmentsContext persist a mapping between an agent and one or multiple triggers
+func AddTriggerAssignmentsContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID) error {
 	newMappings := make([]models.TriggerAssignment, 0)
 	for _, k := range TriggerIDs {
-		newMappings = append(newMappings, models.TriggerAssignment{
-			TriggerID: k,
-			Enabled:   true,
-			History:   make([]models.TriggerHistoryEntry, 0),
-		})
+		newMappings = append(newMappings, newTriggerAssignment(k))
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
 
 	result := Client.Collection("agents").FindOneAndUpdate(ctx, bson.M{"_id": AgentID}, bson.M{"$push": bson.M{"triggermappings": bson.M{"$each": newMappings}}})
@@ -152,3 +241,230 @@ func AddTriggerAssignments(Client *mongo.Database, AgentID primitive.ObjectID, T
 
 	return result.Err()
 }
+
+//ReconcileReport describes the changes made by ReconcileTriggerAssignments
+type ReconcileReport struct {
+	//Added contains the IDs of the triggers which got a new trigger assignment
+	Added []primitive.ObjectID
+	//Removed contains the removed trigger assignments (including their history)
+	Removed []models.TriggerAssignment
+}
+
+//Changed returns true if trigger assignments were added or removed
+func (r ReconcileReport) Changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0
+}
+
+//ReconcileTriggerAssignments brings the trigger assignments of the agent in line with the triggers assigned via its templates
+//Missing trigger assignments are added and assignments referencing triggers which are no longer reachable are removed
+//Concurrent calls for the same agent are safe, every assignment is only added / reported once
+func ReconcileTriggerAssignments(Client *mongo.Database, AgentID primitive.ObjectID) (ReconcileReport, error) {
+	return ReconcileTriggerAssignmentsContext(context.Background(), Client, AgentID)
+}
+
+//ReconcileTriggerAssignmentsContext brings the trigger assignments of the agent in line with the triggers assigned via its templates
+//Missing trigger assignments are added and assignments referencing triggers which are no longer reachable are removed
+//Concurrent calls for the same agent are safe, every assignment is only added / reported once
+func ReconcileTriggerAssignmentsContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID) (ReconcileReport, error) {
+	agent, err := GetAgentContext(ctx, Client, AgentID)
+	if err != nil {
+		return ReconcileReport{}, err
+	}
+
+	missing, stale := diffTriggerAssignments(agent)
+	report := ReconcileReport{
+		Added:   make([]primitive.ObjectID, 0),
+		Removed: make([]models.TriggerAssignment, 0),
+	}
+
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	for _, k := range stale {
+		//Every assignment is pulled on its own, so only the caller actually removing it reports it
+		result, err := Client.Collection("agents").UpdateOne(updateCtx, bson.M{
+			"_id":                       AgentID,
+			"triggermappings.triggerid": k.TriggerID,
+		}, bson.M{"$pull": bson.M{"triggermappings": bson.M{"triggerid": k.TriggerID}}})
+
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't remove outdated trigger assignment from agent", agent.Name, ":", err)
+			return report, err
+		}
+
+		if result.ModifiedCount > 0 {
+			report.Removed = append(report.Removed, k)
+		}
+	}
+
+	if len(report.Removed) > 0 {
+		logger.Debug(loggingArea, "Removed", len(report.Removed), "outdated trigger assignment(s) from agent", agent.Name)
+	}
+
+	for _, k := range missing {
+		//The filter ensures that the assignment isn't added twice if another caller reconciles concurrently
+		result, err := Client.Collection("agents").UpdateOne(updateCtx, bson.M{
+			"_id":                       AgentID,
+			"triggermappings.triggerid": bson.M{"$ne": k},
+		}, bson.M{"$push": bson.M{"triggermappings": newTriggerAssignment(k)}})
+
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't add trigger assignment to agent", agent.Name, ":", err)
+			return report, err
+		}
+
+		if result.ModifiedCount > 0 {
+			report.Added = append(report.Added, k)
+		}
+	}
+
+	if len(report.Added) > 0 {
+		logger.Debug(loggingArea, "Added", len(report.Added), "missing trigger assignment(s) to agent", agent.Name)
+	}
+
+	return report, nil
+}
+
+//diffTriggerAssignments returns the IDs of assigned triggers without trigger assignment and all assignments referencing triggers no longer assigned to the agent
+//The agent has to be populated
+func diffTriggerAssignments(Agent models.Agent) ([]primitive.ObjectID, []models.TriggerAssignment) {
+	missing := make([]primitive.ObjectID, 0)
+	stale := make([]models.TriggerAssignment, 0)
+
+	for _, k := range Agent.TriggerMappings {
+		if _, err := Agent.GetTrigger(k.TriggerID); err != nil {
+			stale = append(stale, k)
+		}
+	}
+
+	for _, trigger := range Agent.GetAllTriggers() {
+		if _, err := Agent.GetTriggerMappingByTriggerID(trigger.ID); err != nil {
+			missing = append(missing, trigger.ID)
+		}
+	}
+
+	return missing, stale
+}
+
+func newTriggerAssignment(TriggerID primitive.ObjectID) models.TriggerAssignment {
+	return models.TriggerAssignment{
+		TriggerID:        TriggerID,
+		Enabled:          true,
+		History:          make([]models.TriggerHistoryEntry, 0),
+		Acknowledgements: make([]models.Acknowledgement, 0),
+	}
+}
+
+//SetTriggerState atomically sets the problem state and error of a single trigger assignment
+//A TriggerEvent is only stored if the problem state actually changed
+//A problem closed via CloseProblem isn't reopened until the assignment is set unproblematic once
+//The returned bool is true if this call changed the problem state, so notifications can be sent exactly once even if multiple scrapers evaluate the same trigger
+//The event is stored after the state changed and not within a transaction (which would require a replica set)
+//If storing the event fails, the error is only logged and the transition is still reported
+//ErrNotFound is returned if the agent has no trigger assignment for the trigger
+func SetTriggerState(Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return SetTriggerStateContext(context.Background(), Client, AgentID, TriggerID, Problematic, Error)
+}
+
+//SetTriggerStateContext atomically sets the problem state and error of a single trigger assignment
+//A TriggerEvent is only stored if the problem state actually changed
+//A problem closed via CloseProblem isn't reopened until the assignment is set unproblematic once
+//The returned bool is true if this call changed the problem state, so notifications can be sent exactly once even if multiple scrapers evaluate the same trigger
+//The event is stored after the state changed and not within a transaction (which would require a replica set)
+//If storing the event fails, the error is only logged and the transition is still reported
+//ErrNotFound is returned if the agent has no trigger assignment for the trigger
+func SetTriggerStateContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return setTriggerState(ctx, Client, bson.M{"_id": AgentID}, AgentID, TriggerID, Problematic, Error)
+}
+
+//setTriggerState implements SetTriggerState, Agent is the filter matching the agent (e.g. including a fencing token)
+func setTriggerState(ctx context.Context, Client *mongo.Database, Agent bson.M, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	//Only matches if the state differs, so only one concurrent caller can win the transition
+	match := bson.M{
+		"triggerid":   TriggerID,
+		"problematic": bson.M{"$ne": Problematic},
+	}
+	set := bson.M{
+		"triggermappings.$.problematic": Problematic,
+		"triggermappings.$.error":       Error,
+	}
+	if Problematic {
+		//A manually closed problem stays closed until the expression recovers
+		match["manuallyclosed"] = bson.M{"$ne": true}
+
+		//A new problem starts without the acknowledgements of the previous one
+		set["triggermappings.$.problemsince"] = time.Now()
+		set["triggermappings.$.acknowledged"] = false
+		set["triggermappings.$.severityoverride"] = nil
+		set["triggermappings.$.acknowledgements"] = make([]models.Acknowledgement, 0)
+	}
+
+	filter := bson.M{"triggermappings": bson.M{"$elemMatch": match}}
+	for k, v := range Agent {
+		filter[k] = v
+	}
+
+	result, err := Client.Collection("agents").UpdateOne(updateCtx, filter, bson.M{"$set": set})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't update trigger state:", err)
+		return false, err
+	}
+
+	if result.MatchedCount > 0 {
+		//The transition already happened, so the caller has to be told even if the event couldn't be stored
+		if _, err := InsertTriggerEventContext(ctx, Client, newTriggerEvent(ctx, NewMongoStore(Client), AgentID, TriggerID, Problematic, Error)); err != nil {
+			logger.Error(loggingArea, "Couldn't store trigger event of agent", AgentID.Hex(), "and trigger", TriggerID.Hex(), ":", err)
+		}
+		return true, nil
+	}
+
+	//State didn't change -> Only update the error
+	set = bson.M{"triggermappings.$.error": Error}
+	if !Problematic {
+		//The expression recovered, so a manually closed assignment can become problematic again
+		set["triggermappings.$.manuallyclosed"] = false
+	}
+
+	filter = bson.M{"triggermappings.triggerid": TriggerID}
+	for k, v := range Agent {
+		filter[k] = v
+	}
+
+	result, err = Client.Collection("agents").UpdateOne(updateCtx, filter, bson.M{"$set": set})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't update trigger error:", err)
+		return false, err
+	}
+
+	if result.MatchedCount == 0 {
+		return false, ErrNotFound
+	}
+
+	return false, nil
+}
+
+//newTriggerEvent returns the event for a state change of the trigger assignment
+//The severity is copied from the trigger, so that events can be queried by severity
+func newTriggerEvent(ctx context.Context, Store Store, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) models.TriggerEvent {
+	event := models.TriggerEvent{
+		AgentID:     AgentID,
+		TriggerID:   TriggerID,
+		Time:        time.Now(),
+		Problematic: Problematic,
+		Error:       Error,
+	}
+
+	trigger, err := Store.GetTrigger(ctx, TriggerID)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't get severity of trigger", TriggerID.Hex(), "for trigger event:", err)
+	} else {
+		event.Severity = trigger.Severity
+	}
+
+	return event
+}
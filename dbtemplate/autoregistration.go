@@ -0,0 +1,169 @@
+package dbtemplate
+
+import (
+	"context"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//GetAllAutoRegistrationRules returns all auto registration rules ordered by their priority
+func GetAllAutoRegistrationRules(Client *mongo.Database) ([]models.AutoRegistrationRule, error) {
+	return GetAllAutoRegistrationRulesContext(context.Background(), Client)
+}
+
+//GetAllAutoRegistrationRulesContext returns all auto registration rules ordered by their priority
+func GetAllAutoRegistrationRulesContext(ctx context.Context, Client *mongo.Database) ([]models.AutoRegistrationRule, error) {
+	rules := make([]models.AutoRegistrationRule, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("autoregistrationrules").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "_id", Value: 1}}))
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read auto registration rules:", err)
+		return rules, err
+	}
+
+	if err := cursor.All(ctx, &rules); err != nil {
+		logger.Error(loggingArea, "Couldn't decode auto registration rules:", err)
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+//CreateAutoRegistrationRule validates and persists a new auto registration rule
+//The returned rule contains the generated ID
+func CreateAutoRegistrationRule(Client *mongo.Database, Rule models.AutoRegistrationRule) (models.AutoRegistrationRule, error) {
+	return CreateAutoRegistrationRuleContext(context.Background(), Client, Rule)
+}
+
+//CreateAutoRegistrationRuleContext validates and persists a new auto registration rule
+//The returned rule contains the generated ID
+func CreateAutoRegistrationRuleContext(ctx context.Context, Client *mongo.Database, Rule models.AutoRegistrationRule) (models.AutoRegistrationRule, error) {
+	if err := Rule.Validate(); err != nil {
+		return models.AutoRegistrationRule{}, err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("autoregistrationrules"), Rule.Name, primitive.NilObjectID); err != nil {
+		return models.AutoRegistrationRule{}, err
+	}
+
+	Rule.ID = primitive.NewObjectID()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("autoregistrationrules").InsertOne(ctx, Rule); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.AutoRegistrationRule{}, ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't insert auto registration rule:", err)
+		return models.AutoRegistrationRule{}, err
+	}
+
+	return Rule, nil
+}
+
+//UpdateAutoRegistrationRule validates and persists the changes of an existing auto registration rule
+//Agents aren't changed until they register again or ApplyAutoRegistration is called
+func UpdateAutoRegistrationRule(Client *mongo.Database, Rule models.AutoRegistrationRule) error {
+	return UpdateAutoRegistrationRuleContext(context.Background(), Client, Rule)
+}
+
+//UpdateAutoRegistrationRuleContext validates and persists the changes of an existing auto registration rule
+//Agents aren't changed until they register again or ApplyAutoRegistration is called
+func UpdateAutoRegistrationRuleContext(ctx context.Context, Client *mongo.Database, Rule models.AutoRegistrationRule) error {
+	if err := Rule.Validate(); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("autoregistrationrules"), Rule.Name, Rule.ID); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("autoregistrationrules"), Rule.ID, Rule)
+}
+
+//DeleteAutoRegistrationRule removes the specified auto registration rule
+//Templates and tags already added to agents are kept
+func DeleteAutoRegistrationRule(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteAutoRegistrationRuleContext(context.Background(), Client, ID)
+}
+
+//DeleteAutoRegistrationRuleContext removes the specified auto registration rule
+//Templates and tags already added to agents are kept
+func DeleteAutoRegistrationRuleContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return deleteDocument(ctx, Client.Collection("autoregistrationrules"), ID)
+}
+
+//DryRunAutoRegistration returns which rules match the agent and how they would change it without persisting anything
+func DryRunAutoRegistration(Client *mongo.Database, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	return DryRunAutoRegistrationContext(context.Background(), Client, AgentID)
+}
+
+//DryRunAutoRegistrationContext returns which rules match the agent and how they would change it without persisting anything
+func DryRunAutoRegistrationContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	agent, err := GetAgentContext(ctx, Client, AgentID)
+	if err != nil {
+		return models.AutoRegistrationResult{}, err
+	}
+
+	rules, err := GetAllAutoRegistrationRulesContext(ctx, Client)
+	if err != nil {
+		return models.AutoRegistrationResult{}, err
+	}
+
+	return models.ApplyAutoRegistrationRules(rules, agent), nil
+}
+
+//ApplyAutoRegistration applies all matching auto registration rules to the agent
+//The trigger assignments are reconciled if templates were linked
+func ApplyAutoRegistration(Client *mongo.Database, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	return ApplyAutoRegistrationContext(context.Background(), Client, AgentID)
+}
+
+//ApplyAutoRegistrationContext applies all matching auto registration rules to the agent
+//The trigger assignments are reconciled if templates were linked
+func ApplyAutoRegistrationContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	result, err := DryRunAutoRegistrationContext(ctx, Client, AgentID)
+	if err != nil || !result.Changed() {
+		return result, err
+	}
+
+	//Only the changes are written, so concurrent updates of other fields aren't overwritten
+	update := bson.M{}
+	addToSet := bson.M{}
+	if len(result.AddedTemplateIDs) > 0 {
+		addToSet["templateids"] = bson.M{"$each": result.AddedTemplateIDs}
+	}
+	if len(result.AddedTags) > 0 {
+		addToSet["tags"] = bson.M{"$each": result.AddedTags}
+	}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+	if result.ScrapeInterval > 0 {
+		update["$set"] = bson.M{"scrapeinterval": result.ScrapeInterval}
+	}
+
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+	if _, err := Client.Collection("agents").UpdateOne(updateCtx, bson.M{"_id": AgentID}, update); err != nil {
+		logger.Error(loggingArea, "Couldn't apply auto registration rules to agent", result.Agent.Name, ":", err)
+		return result, err
+	}
+
+	if len(result.AddedTemplateIDs) > 0 {
+		if _, err := ReconcileTriggerAssignmentsContext(ctx, Client, AgentID); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//ErrLeadershipHeld is returned if the leadership should be acquired, but another member is the leader
+var ErrLeadershipHeld = errors.New("leadership is held by another member")
+
+//ErrLeadershipLost is returned if the leadership should be renewed or resigned, but another member acquired it in the meantime
+var ErrLeadershipLost = errors.New("leadership was lost")
+
+//HeartbeatMember registers the member or refreshes its heartbeat, so it's regarded alive for TTL
+func HeartbeatMember(Client *mongo.Database, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error) {
+	return HeartbeatMemberContext(context.Background(), Client, Member, TTL)
+}
+
+//HeartbeatMemberContext registers the member or refreshes its heartbeat, so it's regarded alive for TTL
+func HeartbeatMemberContext(ctx context.Context, Client *mongo.Database, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error) {
+	if Member.ID == uuid.Nil {
+		return models.ClusterMember{}, errors.New("member id can't be empty")
+	}
+
+	now := time.Now()
+
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result := Client.Collection("clustermembers").FindOneAndUpdate(updateCtx, bson.M{"_id": Member.ID}, bson.M{
+		"$set": bson.M{
+			"hostname":  Member.Hostname,
+			"heartbeat": now,
+			"expires":   now.Add(TTL),
+		},
+		"$setOnInsert": bson.M{"started": now},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	if result.Err() != nil {
+		logger.Error(loggingArea, "Couldn't send heartbeat of cluster member:", result.Err())
+		return models.ClusterMember{}, result.Err()
+	}
+
+	var member models.ClusterMember
+	if err := result.Decode(&member); err != nil {
+		logger.Error(loggingArea, "Couldn't decode cluster member:", err)
+		return models.ClusterMember{}, err
+	}
+
+	return member, nil
+}
+
+//RemoveMember removes the member from the cluster, e.g. during a graceful shutdown
+func RemoveMember(Client *mongo.Database, ID uuid.UUID) error {
+	return RemoveMemberContext(context.Background(), Client, ID)
+}
+
+//RemoveMemberContext removes the member from the cluster, e.g. during a graceful shutdown
+func RemoveMemberContext(ctx context.Context, Client *mongo.Database, ID uuid.UUID) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Client.Collection("clustermembers").DeleteOne(ctx, bson.M{"_id": ID})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't remove cluster member:", err)
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+//GetLiveMembers returns all members whose heartbeat didn't expire at the specified time
+func GetLiveMembers(Client *mongo.Database, At time.Time) ([]models.ClusterMember, error) {
+	return GetLiveMembersContext(context.Background(), Client, At)
+}
+
+//GetLiveMembersContext returns all members whose heartbeat didn't expire at the specified time
+func GetLiveMembersContext(ctx context.Context, Client *mongo.Database, At time.Time) ([]models.ClusterMember, error) {
+	members := make([]models.ClusterMember, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("clustermembers").Find(ctx, bson.M{"expires": bson.M{"$gt": At}}, options.Find().SetSort(bson.M{"_id": 1}))
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read cluster members:", err)
+		return members, err
+	}
+
+	if err := cursor.All(ctx, &members); err != nil {
+		logger.Error(loggingArea, "Couldn't decode cluster members:", err)
+		return members, err
+	}
+
+	return members, nil
+}
+
+//PruneMembers removes all members whose heartbeat expired before the specified time
+//The number of removed members is returned
+func PruneMembers(Client *mongo.Database, Before time.Time) (int64, error) {
+	return PruneMembersContext(context.Background(), Client, Before)
+}
+
+//PruneMembersContext removes all members whose heartbeat expired before the specified time
+//The number of removed members is returned
+func PruneMembersContext(ctx context.Context, Client *mongo.Database, Before time.Time) (int64, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Client.Collection("clustermembers").DeleteMany(ctx, bson.M{"expires": bson.M{"$lte": Before}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't prune cluster members:", err)
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+//AcquireLeadership makes the member the leader of the election if there is no leader or the leadership expired
+//Every acquisition increases the term of the leadership
+//ErrLeadershipHeld is returned if another member is the leader
+func AcquireLeadership(Client *mongo.Database, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error) {
+	return AcquireLeadershipContext(context.Background(), Client, Name, Member, Duration)
+}
+
+//AcquireLeadershipContext makes the member the leader of the election if there is no leader or the leadership expired
+//Every acquisition increases the term of the leadership
+//ErrLeadershipHeld is returned if another member is the leader
+func AcquireLeadershipContext(ctx context.Context, Client *mongo.Database, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error) {
+	if Member == uuid.Nil {
+		return models.Leadership{}, errors.New("member id can't be empty")
+	}
+
+	now := time.Now()
+
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	//The upsert fails with a duplicate key error if the election exists, but the leadership can't be acquired
+	result := Client.Collection("leaderships").FindOneAndUpdate(updateCtx, bson.M{
+		"_id": Name,
+		"$or": []bson.M{
+			{"leader": uuid.Nil},
+			{"leader": Member},
+			{"expires": bson.M{"$lte": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"leader":   Member,
+			"acquired": now,
+			"expires":  now.Add(Duration),
+		},
+		"$inc": bson.M{"term": int64(1)},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	if mongo.IsDuplicateKeyError(result.Err()) {
+		return models.Leadership{}, ErrLeadershipHeld
+	}
+
+	return decodeLeadership(result, ErrLeadershipHeld)
+}
+
+//RenewLeadership extends the leadership of the leader by Duration
+//ErrLeadershipLost is returned if another member acquired the leadership in the meantime
+func RenewLeadership(Client *mongo.Database, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error) {
+	return RenewLeadershipContext(context.Background(), Client, Leadership, Duration)
+}
+
+//RenewLeadershipContext extends the leadership of the leader by Duration
+//ErrLeadershipLost is returned if another member acquired the leadership in the meantime
+func RenewLeadershipContext(ctx context.Context, Client *mongo.Database, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error) {
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result := Client.Collection("leaderships").FindOneAndUpdate(updateCtx, bson.M{
+		"_id":    Leadership.Name,
+		"leader": Leadership.Leader,
+		"term":   Leadership.Term,
+	}, bson.M{"$set": bson.M{"expires": time.Now().Add(Duration)}}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+
+	return decodeLeadership(result, ErrLeadershipLost)
+}
+
+//ResignLeadership gives up the leadership, so another member can take over right away
+//ErrLeadershipLost is returned if another member acquired the leadership in the meantime
+func ResignLeadership(Client *mongo.Database, Leadership models.Leadership) error {
+	return ResignLeadershipContext(context.Background(), Client, Leadership)
+}
+
+//ResignLeadershipContext gives up the leadership, so another member can take over right away
+//ErrLeadershipLost is returned if another member acquired the leadership in the meantime
+func ResignLeadershipContext(ctx context.Context, Client *mongo.Database, Leadership models.Leadership) error {
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result := Client.Collection("leaderships").FindOneAndUpdate(updateCtx, bson.M{
+		"_id":    Leadership.Name,
+		"leader": Leadership.Leader,
+		"term":   Leadership.Term,
+	}, bson.M{"$set": bson.M{
+		"leader":  uuid.Nil,
+		"expires": time.Time{},
+	}})
+
+	_, err := decodeLeadership(result, ErrLeadershipLost)
+	return err
+}
+
+func decodeLeadership(Result *mongo.SingleResult, Mismatch error) (models.Leadership, error) {
+	if errors.Is(Result.Err(), mongo.ErrNoDocuments) {
+		return models.Leadership{}, Mismatch
+	}
+
+	if Result.Err() != nil {
+		logger.Error(loggingArea, "Couldn't update leadership:", Result.Err())
+		return models.Leadership{}, Result.Err()
+	}
+
+	var leadership models.Leadership
+	if err := Result.Decode(&leadership); err != nil {
+		logger.Error(loggingArea, "Couldn't decode leadership:", err)
+		return models.Leadership{}, err
+	}
+
+	return leadership, nil
+}
@@ -0,0 +1,22 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+)
+
+//AgentTimeout is applied to agent queries if the context passed by the caller has no deadline
+var AgentTimeout = 15 * time.Second
+
+//DefaultTimeout is applied to all other queries and writes if the context passed by the caller has no deadline
+var DefaultTimeout = 30 * time.Second
+
+//withDefaultTimeout derives a context for a single database operation
+//The deadline of the parent context is always respected, the timeout is only added if the parent has no deadline
+func withDefaultTimeout(ctx context.Context, Timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline || Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, Timeout)
+}
@@ -0,0 +1,98 @@
+package dbtemplate
+
+import (
+	"context"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//GetAllEscalationPolicies returns all escalation policies from the database
+func GetAllEscalationPolicies(Client *mongo.Database) ([]models.EscalationPolicy, error) {
+	return GetAllEscalationPoliciesContext(context.Background(), Client)
+}
+
+//GetAllEscalationPoliciesContext returns all escalation policies from the database
+func GetAllEscalationPoliciesContext(ctx context.Context, Client *mongo.Database) ([]models.EscalationPolicy, error) {
+	policies := make([]models.EscalationPolicy, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("escalationpolicies").Find(ctx, bson.M{})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read escalation policies:", err)
+		return policies, err
+	}
+
+	if err := cursor.All(ctx, &policies); err != nil {
+		logger.Error(loggingArea, "Couldn't decode escalation policies:", err)
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+//CreateEscalationPolicy validates and persists a new escalation policy
+//The returned policy contains the generated ID
+func CreateEscalationPolicy(Client *mongo.Database, Policy models.EscalationPolicy) (models.EscalationPolicy, error) {
+	return CreateEscalationPolicyContext(context.Background(), Client, Policy)
+}
+
+//CreateEscalationPolicyContext validates and persists a new escalation policy
+//The returned policy contains the generated ID
+func CreateEscalationPolicyContext(ctx context.Context, Client *mongo.Database, Policy models.EscalationPolicy) (models.EscalationPolicy, error) {
+	if err := Policy.Validate(); err != nil {
+		return models.EscalationPolicy{}, err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("escalationpolicies"), Policy.Name, primitive.NilObjectID); err != nil {
+		return models.EscalationPolicy{}, err
+	}
+
+	Policy.ID = primitive.NewObjectID()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("escalationpolicies").InsertOne(ctx, Policy); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.EscalationPolicy{}, ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't insert escalation policy:", err)
+		return models.EscalationPolicy{}, err
+	}
+
+	return Policy, nil
+}
+
+//UpdateEscalationPolicy validates and persists the changes of an existing escalation policy
+func UpdateEscalationPolicy(Client *mongo.Database, Policy models.EscalationPolicy) error {
+	return UpdateEscalationPolicyContext(context.Background(), Client, Policy)
+}
+
+//UpdateEscalationPolicyContext validates and persists the changes of an existing escalation policy
+func UpdateEscalationPolicyContext(ctx context.Context, Client *mongo.Database, Policy models.EscalationPolicy) error {
+	if err := Policy.Validate(); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("escalationpolicies"), Policy.Name, Policy.ID); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("escalationpolicies"), Policy.ID, Policy)
+}
+
+//DeleteEscalationPolicy removes the specified escalation policy
+func DeleteEscalationPolicy(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteEscalationPolicyContext(context.Background(), Client, ID)
+}
+
+//DeleteEscalationPolicyContext removes the specified escalation policy
+func DeleteEscalationPolicyContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return deleteDocument(ctx, Client.Collection("escalationpolicies"), ID)
+}
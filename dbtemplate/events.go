@@ -0,0 +1,338 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//TriggerEventFilter specifies which trigger events should be returned by GetTriggerEvents
+//Empty fields aren't used for filtering
+type TriggerEventFilter struct {
+	AgentIDs   []primitive.ObjectID
+	TriggerIDs []primitive.ObjectID
+	Severities []models.TriggerSeverity
+	From, To   time.Time //Both inclusive
+	Limit      int
+}
+
+func (f TriggerEventFilter) bson() bson.M {
+	filter := bson.M{}
+	if len(f.AgentIDs) > 0 {
+		filter["agentid"] = bson.M{"$in": f.AgentIDs}
+	}
+	if len(f.TriggerIDs) > 0 {
+		filter["triggerid"] = bson.M{"$in": f.TriggerIDs}
+	}
+	if len(f.Severities) > 0 {
+		filter["severity"] = bson.M{"$in": f.Severities}
+	}
+
+	timeFilter := bson.M{}
+	if !f.From.IsZero() {
+		timeFilter["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		timeFilter["$lte"] = f.To
+	}
+	if len(timeFilter) > 0 {
+		filter["time"] = timeFilter
+	}
+
+	return filter
+}
+
+func (f TriggerEventFilter) matches(Event models.TriggerEvent) bool {
+	if len(f.AgentIDs) > 0 && !containsObjectID(f.AgentIDs, Event.AgentID) {
+		return false
+	}
+	if len(f.TriggerIDs) > 0 && !containsObjectID(f.TriggerIDs, Event.TriggerID) {
+		return false
+	}
+	if len(f.Severities) > 0 {
+		found := false
+		for _, k := range f.Severities {
+			if k == Event.Severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.From.IsZero() && Event.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && Event.Time.After(f.To) {
+		return false
+	}
+
+	return true
+}
+
+//TriggerEventRetention defines which trigger events are removed by PruneTriggerEvents
+//Zero values disable the corresponding limit
+type TriggerEventRetention struct {
+	//MaxAge removes all events older than the specified duration
+	MaxAge time.Duration
+	//MaxEventsPerAssignment only keeps the newest N events of every agent / trigger combination
+	MaxEventsPerAssignment int
+}
+
+//InsertTriggerEvent persists a single trigger event
+func InsertTriggerEvent(Client *mongo.Database, Event models.TriggerEvent) (models.TriggerEvent, error) {
+	return InsertTriggerEventContext(context.Background(), Client, Event)
+}
+
+//InsertTriggerEventContext persists a single trigger event
+func InsertTriggerEventContext(ctx context.Context, Client *mongo.Database, Event models.TriggerEvent) (models.TriggerEvent, error) {
+	Event.ID = primitive.NewObjectID()
+	if Event.Time.IsZero() {
+		Event.Time = time.Now()
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("triggerevents").InsertOne(ctx, Event); err != nil {
+		logger.Error(loggingArea, "Couldn't insert trigger event:", err)
+		return models.TriggerEvent{}, err
+	}
+
+	return Event, nil
+}
+
+//GetTriggerEvents returns all trigger events matching the filter ordered newest-first
+func GetTriggerEvents(Client *mongo.Database, Filter TriggerEventFilter) ([]models.TriggerEvent, error) {
+	return GetTriggerEventsContext(context.Background(), Client, Filter)
+}
+
+//GetTriggerEventsContext returns all trigger events matching the filter ordered newest-first
+func GetTriggerEventsContext(ctx context.Context, Client *mongo.Database, Filter TriggerEventFilter) ([]models.TriggerEvent, error) {
+	events := make([]models.TriggerEvent, 0)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "time", Value: -1}})
+	if Filter.Limit > 0 {
+		findOptions.SetLimit(int64(Filter.Limit))
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("triggerevents").Find(ctx, Filter.bson(), findOptions)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read trigger events:", err)
+		return events, err
+	}
+
+	if err := cursor.All(ctx, &events); err != nil {
+		logger.Error(loggingArea, "Couldn't decode trigger events:", err)
+		return events, err
+	}
+
+	return events, nil
+}
+
+//PruneTriggerEvents removes all trigger events exceeding the retention limits
+//The number of removed events is returned
+func PruneTriggerEvents(Client *mongo.Database, Retention TriggerEventRetention) (int64, error) {
+	return PruneTriggerEventsContext(context.Background(), Client, Retention)
+}
+
+//PruneTriggerEventsContext removes all trigger events exceeding the retention limits
+//The number of removed events is returned
+func PruneTriggerEventsContext(ctx context.Context, Client *mongo.Database, Retention TriggerEventRetention) (int64, error) {
+	var removed int64
+	collection := Client.Collection("triggerevents")
+
+	if Retention.MaxAge > 0 {
+		deleteCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+		result, err := collection.DeleteMany(deleteCtx, bson.M{"time": bson.M{"$lt": time.Now().Add(-Retention.MaxAge)}})
+		cancel()
+
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't remove expired trigger events:", err)
+			return removed, err
+		}
+		removed += result.DeletedCount
+	}
+
+	if Retention.MaxEventsPerAssignment > 0 {
+		pipeline := mongo.Pipeline{
+			{{Key: "$group", Value: bson.M{
+				"_id":   bson.M{"agentid": "$agentid", "triggerid": "$triggerid"},
+				"count": bson.M{"$sum": 1},
+			}}},
+			{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": Retention.MaxEventsPerAssignment}}}},
+		}
+
+		aggregateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+		defer cancel()
+		cursor, err := collection.Aggregate(aggregateCtx, pipeline)
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't count trigger events:", err)
+			return removed, err
+		}
+
+		var groups []struct {
+			ID struct {
+				AgentID   primitive.ObjectID `bson:"agentid"`
+				TriggerID primitive.ObjectID `bson:"triggerid"`
+			} `bson:"_id"`
+		}
+		if err := cursor.All(aggregateCtx, &groups); err != nil {
+			logger.Error(loggingArea, "Couldn't decode trigger event counts:", err)
+			return removed, err
+		}
+
+		for _, k := range groups {
+			deleted, err := pruneTriggerEventGroup(ctx, collection, k.ID.AgentID, k.ID.TriggerID, Retention.MaxEventsPerAssignment)
+			removed += deleted
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+//pruneTriggerEventGroup removes all but the newest Keep events of the trigger assignment
+//Every group gets its own timeouts, so pruning many groups doesn't exceed the default timeout
+func pruneTriggerEventGroup(ctx context.Context, Collection *mongo.Collection, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Keep int) (int64, error) {
+	filter := bson.M{"agentid": AgentID, "triggerid": TriggerID}
+
+	//Find the oldest event which should be kept and remove everything before it
+	findCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	var cutoff models.TriggerEvent
+	err := Collection.FindOne(findCtx, filter, options.FindOne().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(Keep-1))).Decode(&cutoff)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't find oldest trigger event to keep:", err)
+		return 0, err
+	}
+
+	filter["$or"] = []bson.M{
+		{"time": bson.M{"$lt": cutoff.Time}},
+		{"time": cutoff.Time, "_id": bson.M{"$lt": cutoff.ID}},
+	}
+
+	deleteCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Collection.DeleteMany(deleteCtx, filter)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't remove surplus trigger events:", err)
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+//MigrateTriggerHistory moves the history embedded in the trigger assignments of all agents into the trigger event collection
+//The migration is idempotent and can be run repeatedly (e.g. on every startup)
+//The number of migrated history entries is returned
+func MigrateTriggerHistory(Client *mongo.Database) (int, error) {
+	return MigrateTriggerHistoryContext(context.Background(), Client)
+}
+
+//MigrateTriggerHistoryContext moves the history embedded in the trigger assignments of all agents into the trigger event collection
+//The migration is idempotent and can be run repeatedly (e.g. on every startup)
+//The number of migrated history entries is returned
+func MigrateTriggerHistoryContext(ctx context.Context, Client *mongo.Database) (int, error) {
+	triggers, err := GetAllTriggersContext(ctx, Client)
+	if err != nil {
+		return 0, err
+	}
+
+	severities := make(map[primitive.ObjectID]models.TriggerSeverity)
+	for _, k := range triggers {
+		severities[k.ID] = k.Severity
+	}
+
+	findCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("agents").Find(findCtx, bson.M{"triggermappings.history.0": bson.M{"$exists": true}})
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read agents with embedded trigger history:", err)
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	//Agents are migrated one by one, every batch and every agent gets its own timeout
+	migrated := 0
+	for {
+		nextCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+		found := cursor.Next(nextCtx)
+		cancel()
+
+		if !found {
+			break
+		}
+
+		var agent models.Agent
+		if err := cursor.Decode(&agent); err != nil {
+			logger.Error(loggingArea, "Couldn't decode agent:", err)
+			return migrated, err
+		}
+
+		count, err := migrateAgentTriggerHistory(ctx, Client, agent, severities)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += count
+	}
+
+	if err := cursor.Err(); err != nil {
+		logger.Error(loggingArea, "Couldn't read agents with embedded trigger history:", err)
+		return migrated, err
+	}
+
+	return migrated, nil
+}
+
+//migrateAgentTriggerHistory moves the embedded history of a single agent into the trigger event collection
+func migrateAgentTriggerHistory(ctx context.Context, Client *mongo.Database, Agent models.Agent, Severities map[primitive.ObjectID]models.TriggerSeverity) (int, error) {
+	writes := make([]mongo.WriteModel, 0)
+	for _, mapping := range Agent.TriggerMappings {
+		for _, entry := range mapping.History {
+			key := bson.M{"agentid": Agent.ID, "triggerid": mapping.TriggerID, "time": entry.Time}
+
+			//Upserting on agent / trigger / time prevents duplicates if a previous migration was interrupted
+			writes = append(writes, mongo.NewUpdateOneModel().SetFilter(key).SetUpsert(true).SetUpdate(bson.M{
+				"$setOnInsert": bson.M{
+					"problematic": entry.Problematic,
+					"severity":    Severities[mapping.TriggerID],
+					"error":       "",
+				},
+			}))
+		}
+	}
+
+	if len(writes) == 0 {
+		return 0, nil
+	}
+
+	writeCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("triggerevents").BulkWrite(writeCtx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		logger.Error(loggingArea, "Couldn't migrate trigger history of agent", Agent.Name, ":", err)
+		return 0, err
+	}
+
+	updateCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("agents").UpdateOne(updateCtx, bson.M{"_id": Agent.ID}, bson.M{"$set": bson.M{"triggermappings.$[].history": make([]models.TriggerHistoryEntry, 0)}}); err != nil {
+		logger.Error(loggingArea, "Couldn't clear embedded trigger history of agent", Agent.Name, ":", err)
+		return 0, err
+	}
+
+	return len(writes), nil
+}
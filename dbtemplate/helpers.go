@@ -0,0 +1,96 @@
+package dbtemplate
+
+import (
+	"context"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//ensureUniqueName returns ErrNameInUse if another document (with an ID other than Self) uses the specified name
+func ensureUniqueName(ctx context.Context, Collection *mongo.Collection, Name string, Self primitive.ObjectID) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	count, err := Collection.CountDocuments(ctx, bson.M{"name": Name, "_id": bson.M{"$ne": Self}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't check if name is unique in", Collection.Name(), ":", err)
+		return err
+	}
+
+	if count > 0 {
+		return ErrNameInUse
+	}
+
+	return nil
+}
+
+//replaceDocument replaces the document with the specified ID
+//ErrNotFound is returned if the document doesn't exist
+func replaceDocument(ctx context.Context, Collection *mongo.Collection, ID primitive.ObjectID, Document interface{}) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Collection.ReplaceOne(ctx, bson.M{"_id": ID}, Document)
+
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't update document in", Collection.Name(), ":", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+//deleteDocument removes the document with the specified ID
+//ErrNotFound is returned if the document doesn't exist
+func deleteDocument(ctx context.Context, Collection *mongo.Collection, ID primitive.ObjectID) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Collection.DeleteOne(ctx, bson.M{"_id": ID})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't delete document from", Collection.Name(), ":", err)
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+//pullReferences removes the specified ID from the array Field of all documents in the collection
+func pullReferences(ctx context.Context, Collection *mongo.Collection, Field string, ID primitive.ObjectID) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	_, err := Collection.UpdateMany(ctx, bson.M{Field: ID}, bson.M{"$pull": bson.M{Field: ID}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't remove references from", Collection.Name(), ":", err)
+	}
+
+	return err
+}
+
+//disableDocuments disables all documents in the collection matching the filter
+func disableDocuments(ctx context.Context, Collection *mongo.Collection, Filter bson.M) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	_, err := Collection.UpdateMany(ctx, Filter, bson.M{"$set": bson.M{"enabled": false}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't disable documents in", Collection.Name(), ":", err)
+	}
+
+	return err
+}
@@ -0,0 +1,73 @@
+package dbtemplate
+
+import (
+	"context"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//EnsureIndexes creates all indexes the dbtemplate package relies on
+//The unique indexes guarantee unique item / trigger names and agent uuids, even if multiple writers run concurrently
+func EnsureIndexes(Client *mongo.Database) error {
+	return EnsureIndexesContext(context.Background(), Client)
+}
+
+//EnsureIndexesContext creates all indexes the dbtemplate package relies on
+//The unique indexes guarantee unique item / trigger names and agent uuids, even if multiple writers run concurrently
+func EnsureIndexesContext(ctx context.Context, Client *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"agents": {
+			{Keys: bson.D{{Key: "agentuuid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"autoregistrationrules": {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"clustermembers": {
+			{Keys: bson.D{{Key: "expires", Value: 1}}},
+		},
+		"deliveries": {
+			{Keys: bson.D{{Key: "eventid", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created", Value: -1}}},
+		},
+		"escalationpolicies": {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"items": {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"notificationrules": {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"results": {
+			{Keys: bson.D{{Key: "itemid", Value: 1}, {Key: "hostid", Value: 1}, {Key: "capturedat", Value: -1}}},
+			{Keys: bson.D{{Key: "hostid", Value: 1}, {Key: "capturedat", Value: -1}}},
+		},
+		"silences": {
+			{Keys: bson.D{{Key: "end", Value: 1}, {Key: "start", Value: 1}}},
+		},
+		"triggerevents": {
+			{Keys: bson.D{{Key: "agentid", Value: 1}, {Key: "triggerid", Value: 1}, {Key: "time", Value: -1}}},
+			{Keys: bson.D{{Key: "time", Value: -1}}},
+			{Keys: bson.D{{Key: "severity", Value: 1}, {Key: "time", Value: -1}}},
+		},
+		"triggers": {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+	}
+
+	for collection, indexModels := range indexes {
+		indexCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+		_, err := Client.Collection(collection).Indexes().CreateMany(indexCtx, indexModels)
+		cancel()
+
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't create indexes for collection", collection, ":", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,7 +3,6 @@ package dbtemplate
 import (
 	"context"
 	"errors"
-	"time"
 
 	"github.com/FlowKeeper/FlowUtils/v2/models"
 	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
@@ -16,9 +15,16 @@ import (
 //If a item id isn't found in the database, no error is caused
 //Instead the missing item is omitted from the returned item slice
 func GetItems(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Item, error) {
+	return GetItemsContext(context.Background(), Client, IDs)
+}
+
+//GetItemsContext returns one or multiple item structs for the specified IDs
+//If a item id isn't found in the database, no error is caused
+//Instead the missing item is omitted from the returned item slice
+func GetItemsContext(ctx context.Context, Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Item, error) {
 	items := make([]models.Item, 0)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
 	result, err := Client.Collection("items").Find(ctx, bson.M{"_id": bson.M{"$in": IDs}})
 
@@ -37,7 +43,13 @@ func GetItems(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Item,
 //GetItemByName gets the appropriate item which matches the specified Name
 //WARNING: The query is case sensitive
 func GetItemByName(Client *mongo.Database, Name string) (models.Item, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return GetItemByNameContext(context.Background(), Client, Name)
+}
+
+//GetItemByNameContext gets the appropriate item which matches the specified Name
+//WARNING: The query is case sensitive
+func GetItemByNameContext(ctx context.Context, Client *mongo.Database, Name string) (models.Item, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
 	result := Client.Collection("items").FindOne(ctx, bson.M{"name": Name})
 
@@ -57,3 +69,70 @@ func GetItemByName(Client *mongo.Database, Name string) (models.Item, error) {
 
 	return item, nil
 }
+
+//CreateItem validates and persists a new item
+//The returned item contains the generated ID
+func CreateItem(Client *mongo.Database, Item models.Item) (models.Item, error) {
+	return CreateItemContext(context.Background(), Client, Item)
+}
+
+//CreateItemContext validates and persists a new item
+//The returned item contains the generated ID
+func CreateItemContext(ctx context.Context, Client *mongo.Database, Item models.Item) (models.Item, error) {
+	if err := Item.Validate(); err != nil {
+		return models.Item{}, err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("items"), Item.Name, primitive.NilObjectID); err != nil {
+		return models.Item{}, err
+	}
+
+	Item.ID = primitive.NewObjectID()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("items").InsertOne(ctx, Item); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Item{}, ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't insert item:", err)
+		return models.Item{}, err
+	}
+
+	return Item, nil
+}
+
+//UpdateItem validates and persists the changes of an existing item
+func UpdateItem(Client *mongo.Database, Item models.Item) error {
+	return UpdateItemContext(context.Background(), Client, Item)
+}
+
+//UpdateItemContext validates and persists the changes of an existing item
+func UpdateItemContext(ctx context.Context, Client *mongo.Database, Item models.Item) error {
+	if err := Item.Validate(); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("items"), Item.Name, Item.ID); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("items"), Item.ID, Item)
+}
+
+//DeleteItem removes the specified item and unlinks it from all templates
+//The item is unlinked before it is removed, so a failed cleanup can be retried by calling DeleteItem again
+func DeleteItem(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteItemContext(context.Background(), Client, ID)
+}
+
+//DeleteItemContext removes the specified item and unlinks it from all templates
+//The item is unlinked before it is removed, so a failed cleanup can be retried by calling DeleteItem again
+func DeleteItemContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	if err := pullReferences(ctx, Client.Collection("templates"), "itemids", ID); err != nil {
+		return err
+	}
+
+	return deleteDocument(ctx, Client.Collection("items"), ID)
+}
@@ -0,0 +1,271 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//ErrLeaseHeld is returned if a scraper lease should be acquired, which is held by another scraper
+var ErrLeaseHeld = errors.New("scraper lease is held by another scraper")
+
+//ErrLeaseLost is returned if a scraper lease should be renewed or released, which was acquired by another scraper in the meantime
+var ErrLeaseLost = errors.New("scraper lease was lost")
+
+//ErrStaleToken is returned if a fenced write carries a fencing token which doesn't belong to the current lease of the agent
+var ErrStaleToken = errors.New("fencing token is stale")
+
+//AcquireScraperLease acquires the lease of the agent for the scraper if it's free or expired
+//Every acquisition returns a new fencing token, which is higher than all tokens returned before for the agent
+//ErrLeaseHeld is returned if another scraper holds an unexpired lease
+func AcquireScraperLease(Client *mongo.Database, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration) (models.ScraperLease, error) {
+	return AcquireScraperLeaseContext(context.Background(), Client, AgentID, Scraper, Duration)
+}
+
+//AcquireScraperLeaseContext acquires the lease of the agent for the scraper if it's free or expired
+//Every acquisition returns a new fencing token, which is higher than all tokens returned before for the agent
+//ErrLeaseHeld is returned if another scraper holds an unexpired lease
+func AcquireScraperLeaseContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration) (models.ScraperLease, error) {
+	now := time.Now()
+	return acquireScraperLease(ctx, Client, AgentID, Scraper, Duration, now, bson.M{"$or": []bson.M{
+		{"scraper.uuid": uuid.Nil},
+		{"scraper.uuid": Scraper},
+		{"scraper.expires": bson.M{"$lte": now}},
+		{"scraper.expires": bson.M{"$exists": false}},
+	}})
+}
+
+//StealScraperLease acquires the lease of the agent like AcquireScraperLease, but also takes over leases which weren't renewed within Timeout
+//It is used to take over agents of scrapers which stopped working while holding long leases
+func StealScraperLease(Client *mongo.Database, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Timeout time.Duration) (models.ScraperLease, error) {
+	return StealScraperLeaseContext(context.Background(), Client, AgentID, Scraper, Duration, Timeout)
+}
+
+//StealScraperLeaseContext acquires the lease of the agent like AcquireScraperLease, but also takes over leases which weren't renewed within Timeout
+//It is used to take over agents of scrapers which stopped working while holding long leases
+func StealScraperLeaseContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Timeout time.Duration) (models.ScraperLease, error) {
+	now := time.Now()
+	return acquireScraperLease(ctx, Client, AgentID, Scraper, Duration, now, bson.M{"$or": []bson.M{
+		{"scraper.uuid": uuid.Nil},
+		{"scraper.uuid": Scraper},
+		{"scraper.expires": bson.M{"$lte": now}},
+		{"scraper.expires": bson.M{"$exists": false}},
+		{"scraper.lock": bson.M{"$lte": now.Add(-Timeout)}},
+	}})
+}
+
+func acquireScraperLease(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Now time.Time, Condition bson.M) (models.ScraperLease, error) {
+	if Scraper == uuid.Nil {
+		return models.ScraperLease{}, errors.New("scraper uuid can't be empty")
+	}
+
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	result := Client.Collection("agents").FindOneAndUpdate(updateCtx, bson.M{
+		"_id":  AgentID,
+		"$and": []bson.M{Condition},
+	}, bson.M{
+		"$set": bson.M{
+			"scraper.uuid":     Scraper,
+			"scraper.lock":     Now,
+			"scraper.expires":  Now.Add(Duration),
+			"scraper.acquired": Now,
+		},
+		"$inc": bson.M{"scraper.token": int64(1)},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"scraper": 1}))
+
+	return decodeScraperLease(ctx, Client, AgentID, result, ErrLeaseHeld)
+}
+
+//RenewScraperLease extends the lease of the scraper by Duration
+//Renewing is possible as long as no other scraper acquired the lease, even if it expired in the meantime
+//ErrLeaseLost is returned if another scraper acquired the lease
+func RenewScraperLease(Client *mongo.Database, AgentID primitive.ObjectID, Lease models.ScraperLease, Duration time.Duration) (models.ScraperLease, error) {
+	return RenewScraperLeaseContext(context.Background(), Client, AgentID, Lease, Duration)
+}
+
+//RenewScraperLeaseContext extends the lease of the scraper by Duration
+//Renewing is possible as long as no other scraper acquired the lease, even if it expired in the meantime
+//ErrLeaseLost is returned if another scraper acquired the lease
+func RenewScraperLeaseContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Lease models.ScraperLease, Duration time.Duration) (models.ScraperLease, error) {
+	now := time.Now()
+
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	result := Client.Collection("agents").FindOneAndUpdate(updateCtx, bson.M{
+		"_id":           AgentID,
+		"scraper.uuid":  Lease.UUID,
+		"scraper.token": Lease.Token,
+	}, bson.M{"$set": bson.M{
+		"scraper.lock":    now,
+		"scraper.expires": now.Add(Duration),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"scraper": 1}))
+
+	return decodeScraperLease(ctx, Client, AgentID, result, ErrLeaseLost)
+}
+
+//ReleaseScraperLease releases the lease of the scraper, so other scrapers can acquire it right away
+//The fencing token is kept, so writes carrying it are still accepted until the lease is acquired again
+//ErrLeaseLost is returned if another scraper acquired the lease
+func ReleaseScraperLease(Client *mongo.Database, AgentID primitive.ObjectID, Lease models.ScraperLease) error {
+	return ReleaseScraperLeaseContext(context.Background(), Client, AgentID, Lease)
+}
+
+//ReleaseScraperLeaseContext releases the lease of the scraper, so other scrapers can acquire it right away
+//The fencing token is kept, so writes carrying it are still accepted until the lease is acquired again
+//ErrLeaseLost is returned if another scraper acquired the lease
+func ReleaseScraperLeaseContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Lease models.ScraperLease) error {
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	result := Client.Collection("agents").FindOneAndUpdate(updateCtx, bson.M{
+		"_id":           AgentID,
+		"scraper.uuid":  Lease.UUID,
+		"scraper.token": Lease.Token,
+	}, bson.M{"$set": bson.M{
+		"scraper.uuid":    uuid.Nil,
+		"scraper.expires": time.Time{},
+	}}, options.FindOneAndUpdate().SetProjection(bson.M{"scraper": 1}))
+
+	_, err := decodeScraperLease(ctx, Client, AgentID, result, ErrLeaseLost)
+	return err
+}
+
+//decodeScraperLease decodes the lease returned by a lease operation
+//If no agent matched, ErrNotFound is returned if the agent doesn't exist and Mismatch otherwise
+func decodeScraperLease(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Result *mongo.SingleResult, Mismatch error) (models.ScraperLease, error) {
+	if errors.Is(Result.Err(), mongo.ErrNoDocuments) {
+		if err := ensureAgentExists(ctx, Client, bson.M{"_id": AgentID}); err != nil {
+			return models.ScraperLease{}, err
+		}
+
+		return models.ScraperLease{}, Mismatch
+	}
+
+	if Result.Err() != nil {
+		logger.Error(loggingArea, "Couldn't update scraper lease:", Result.Err())
+		return models.ScraperLease{}, Result.Err()
+	}
+
+	var agent models.Agent
+	if err := Result.Decode(&agent); err != nil {
+		logger.Error(loggingArea, "Couldn't decode scraper lease:", err)
+		return models.ScraperLease{}, err
+	}
+
+	return agent.Scraper, nil
+}
+
+//ensureAgentExists returns ErrNotFound if no agent matches the filter
+func ensureAgentExists(ctx context.Context, Client *mongo.Database, Filter bson.M) error {
+	countCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	count, err := Client.Collection("agents").CountDocuments(countCtx, Filter)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't check if agent exists:", err)
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+//InsertResultsFenced persists the results of the agent if the fencing token belongs to its current lease
+//All results have to belong to the agent, ErrStaleToken is returned if the lease was acquired by another scraper
+//The results are stored with the token, so results of a scraper losing its lease during this call are hidden from the read functions (see models.ScraperLease.Stale)
+func InsertResultsFenced(Client *mongo.Database, AgentID primitive.ObjectID, Token int64, Results []models.Result) ([]models.Result, error) {
+	return InsertResultsFencedContext(context.Background(), Client, AgentID, Token, Results)
+}
+
+//InsertResultsFencedContext persists the results of the agent if the fencing token belongs to its current lease
+//All results have to belong to the agent, ErrStaleToken is returned if the lease was acquired by another scraper
+//The results are stored with the token, so results of a scraper losing its lease during this call are hidden from the read functions (see models.ScraperLease.Stale)
+func InsertResultsFencedContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Token int64, Results []models.Result) ([]models.Result, error) {
+	for _, k := range Results {
+		if k.HostID != AgentID {
+			return nil, fmt.Errorf("result for agent %s can't be stored with the lease of agent %s", k.HostID.Hex(), AgentID.Hex())
+		}
+	}
+
+	if err := checkFencingToken(ctx, Client, AgentID, Token); err != nil {
+		return nil, err
+	}
+
+	results, err := insertResults(ctx, Client, Results, Token)
+	if err != nil {
+		return nil, err
+	}
+
+	//MongoDB can't make an insert conditional, so the results are removed again if the lease was lost in the meantime
+	if err := checkFencingToken(ctx, Client, AgentID, Token); errors.Is(err, ErrStaleToken) {
+		removeResults(ctx, Client, results)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+//removeResults removes results stored with a stale fencing token
+//Results which couldn't be removed are still hidden from the read functions, so errors are only logged
+func removeResults(ctx context.Context, Client *mongo.Database, Results []models.Result) {
+	ids := make([]primitive.ObjectID, 0, len(Results))
+	for _, k := range Results {
+		ids = append(ids, k.ID)
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("results").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		logger.Error(loggingArea, "Couldn't remove results stored with a stale fencing token:", err)
+	}
+}
+
+//SetTriggerStateFenced works like SetTriggerState, but only updates the trigger assignment if the fencing token belongs to the current lease of the agent
+//ErrStaleToken is returned if the lease was acquired by another scraper
+func SetTriggerStateFenced(Client *mongo.Database, AgentID primitive.ObjectID, Token int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return SetTriggerStateFencedContext(context.Background(), Client, AgentID, Token, TriggerID, Problematic, Error)
+}
+
+//SetTriggerStateFencedContext works like SetTriggerState, but only updates the trigger assignment if the fencing token belongs to the current lease of the agent
+//ErrStaleToken is returned if the lease was acquired by another scraper
+func SetTriggerStateFencedContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Token int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	changed, err := setTriggerState(ctx, Client, bson.M{"_id": AgentID, "scraper.token": Token}, AgentID, TriggerID, Problematic, Error)
+	if errors.Is(err, ErrNotFound) {
+		//Distinguish between a missing assignment and a stale token
+		if tokenErr := checkFencingToken(ctx, Client, AgentID, Token); tokenErr != nil {
+			return false, tokenErr
+		}
+	}
+
+	return changed, err
+}
+
+//checkFencingToken returns ErrStaleToken if the token doesn't belong to the current lease of the agent
+func checkFencingToken(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, Token int64) error {
+	if err := ensureAgentExists(ctx, Client, bson.M{"_id": AgentID}); err != nil {
+		return err
+	}
+
+	if err := ensureAgentExists(ctx, Client, bson.M{"_id": AgentID, "scraper.token": Token}); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrStaleToken
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//ErrLifecycleChanged is returned if the lifecycle state of an agent was changed concurrently
+var ErrLifecycleChanged = errors.New("agent lifecycle state was changed concurrently")
+
+//ErrNotPurgeable is returned if an agent should be purged, which isn't deleted or whose grace period didn't pass yet
+var ErrNotPurgeable = errors.New("agent isn't deleted or its grace period didn't pass yet")
+
+//AgentFilter defines which agents are returned by GetAgents
+type AgentFilter struct {
+	//Lifecycles limits the result to agents in one of the states, all agents except deleted ones are returned if it's empty
+	Lifecycles []models.LifecycleState
+}
+
+func (f AgentFilter) bson() bson.M {
+	if len(f.Lifecycles) == 0 {
+		return bson.M{"$nor": []bson.M{lifecycleFilter(models.LifecycleDeleted)}}
+	}
+
+	states := make([]bson.M, 0, len(f.Lifecycles))
+	for _, k := range f.Lifecycles {
+		states = append(states, lifecycleFilter(k))
+	}
+
+	return bson.M{"$or": states}
+}
+
+//matches is the in-memory equivalent of bson
+func (f AgentFilter) matches(Agent models.Agent) bool {
+	state := Agent.Lifecycle()
+	if len(f.Lifecycles) == 0 {
+		return state != models.LifecycleDeleted
+	}
+
+	for _, k := range f.Lifecycles {
+		if k == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+//lifecycleFilter matches all agents in the specified state
+//Agents stored before lifecycle states were introduced are matched by their Enabled, Deleted and Pending flags (see models.Agent.Lifecycle)
+func lifecycleFilter(State models.LifecycleState) bson.M {
+	legacy := bson.M{"lifecyclestate": bson.M{"$in": bson.A{nil, ""}}}
+
+	switch State {
+	case models.LifecycleDeleted:
+		legacy["deleted"] = true
+	case models.LifecyclePending:
+		legacy["deleted"] = bson.M{"$ne": true}
+		legacy["pending"] = true
+	case models.LifecycleActive:
+		legacy["deleted"] = bson.M{"$ne": true}
+		legacy["pending"] = bson.M{"$ne": true}
+		legacy["enabled"] = true
+	case models.LifecycleDisabled:
+		legacy["deleted"] = bson.M{"$ne": true}
+		legacy["pending"] = bson.M{"$ne": true}
+		legacy["enabled"] = bson.M{"$ne": true}
+	default:
+		return bson.M{"lifecyclestate": State}
+	}
+
+	return bson.M{"$or": []bson.M{{"lifecyclestate": State}, legacy}}
+}
+
+//initLifecycle records the initial lifecycle state of a new agent
+//The state is derived from the Enabled and Pending flags if it isn't set
+func initLifecycle(Agent models.Agent) models.Agent {
+	state := Agent.Lifecycle()
+	Agent.LifecycleTransitions = nil
+
+	return Agent.ApplyTransition(models.LifecycleTransition{To: state, Time: time.Now()})
+}
+
+//GetAgents returns all agents matching the filter
+func GetAgents(Client *mongo.Database, Filter AgentFilter) ([]models.Agent, error) {
+	return GetAgentsContext(context.Background(), Client, Filter)
+}
+
+//GetAgentsContext returns all agents matching the filter
+func GetAgentsContext(ctx context.Context, Client *mongo.Database, Filter AgentFilter) ([]models.Agent, error) {
+	agents := make([]models.Agent, 0)
+
+	queryCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+	result, err := Client.Collection("agents").Find(queryCtx, Filter.bson())
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't fetch agents from db:", err)
+		return agents, err
+	}
+
+	if err := result.All(queryCtx, &agents); err != nil {
+		logger.Error(loggingArea, "Couldn't decode agents:", err)
+		return agents, err
+	}
+
+	store := NewMongoStore(Client)
+	for i := range agents {
+		if err := populateAgentFields(ctx, store, &agents[i]); err != nil {
+			return agents, err
+		}
+	}
+
+	return agents, nil
+}
+
+//SetAgentLifecycle moves the agent into the specified lifecycle state
+//Setting the current state again is a no-op, deleted agents have to be restored via RestoreAgent
+//ErrInvalidTransition is returned if the state can't be reached from the current state
+func SetAgentLifecycle(Client *mongo.Database, ID primitive.ObjectID, State models.LifecycleState, User string) error {
+	return SetAgentLifecycleContext(context.Background(), Client, ID, State, User)
+}
+
+//SetAgentLifecycleContext moves the agent into the specified lifecycle state
+//Setting the current state again is a no-op, deleted agents have to be restored via RestoreAgent
+//ErrInvalidTransition is returned if the state can't be reached from the current state
+func SetAgentLifecycleContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID, State models.LifecycleState, User string) error {
+	return transitionAgent(ctx, Client, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		if Agent.Lifecycle() == State {
+			return models.LifecycleTransition{}, errNoTransition
+		}
+
+		return Agent.TransitionTo(State, User, time.Now())
+	})
+}
+
+//RestoreAgent moves a deleted agent back into the state it had before it was deleted
+func RestoreAgent(Client *mongo.Database, ID primitive.ObjectID, User string) error {
+	return RestoreAgentContext(context.Background(), Client, ID, User)
+}
+
+//RestoreAgentContext moves a deleted agent back into the state it had before it was deleted
+func RestoreAgentContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID, User string) error {
+	return transitionAgent(ctx, Client, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		return Agent.RestoreTransition(User, time.Now())
+	})
+}
+
+//errNoTransition is used internally to skip transitions which wouldn't change the agent
+var errNoTransition = errors.New("no lifecycle transition")
+
+//transitionAgent applies the transition returned by Transition to the stored agent
+//The update only succeeds if the agent is still in the state the transition starts from
+func transitionAgent(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID, Transition func(models.Agent) (models.LifecycleTransition, error)) error {
+	agent, err := GetAgentContext(ctx, Client, ID)
+	if err != nil {
+		return err
+	}
+
+	transition, err := Transition(agent)
+	if errors.Is(err, errNoTransition) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	updated := agent.ApplyTransition(transition)
+
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+	result, err := Client.Collection("agents").UpdateOne(updateCtx, bson.M{
+		"_id":  ID,
+		"$and": []bson.M{lifecycleFilter(transition.From)},
+	}, bson.M{
+		"$set": bson.M{
+			"lifecyclestate":   updated.LifecycleState,
+			"lifecyclechanged": updated.LifecycleChanged,
+			"enabled":          updated.Enabled,
+			"deleted":          updated.Deleted,
+			"pending":          updated.Pending,
+		},
+		"$push": bson.M{"lifecycletransitions": transition},
+	})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't change lifecycle state of agent", agent.Name, ":", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrLifecycleChanged
+	}
+
+	logger.Debug(loggingArea, "Agent", agent.Name, "changed lifecycle state from", transition.From, "to", transition.To)
+	return nil
+}
+
+//PurgeAgent permanently removes a deleted agent including its trigger assignments, results, trigger events and deliveries
+//ErrNotPurgeable is returned if the agent isn't deleted or was deleted less than GracePeriod ago
+func PurgeAgent(Client *mongo.Database, ID primitive.ObjectID, GracePeriod time.Duration) error {
+	return PurgeAgentContext(context.Background(), Client, ID, GracePeriod)
+}
+
+//PurgeAgentContext permanently removes a deleted agent including its trigger assignments, results, trigger events and deliveries
+//ErrNotPurgeable is returned if the agent isn't deleted or was deleted less than GracePeriod ago
+func PurgeAgentContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID, GracePeriod time.Duration) error {
+	agent, err := GetAgentContext(ctx, Client, ID)
+	if err != nil {
+		return err
+	}
+
+	if !agent.Purgeable(GracePeriod, time.Now()) {
+		return ErrNotPurgeable
+	}
+
+	return purgeAgent(ctx, Client, agent)
+}
+
+//PurgeDeletedAgents permanently removes all agents which were deleted more than GracePeriod ago
+//The IDs of the purged agents are returned
+func PurgeDeletedAgents(Client *mongo.Database, GracePeriod time.Duration) ([]primitive.ObjectID, error) {
+	return PurgeDeletedAgentsContext(context.Background(), Client, GracePeriod)
+}
+
+//PurgeDeletedAgentsContext permanently removes all agents which were deleted more than GracePeriod ago
+//The IDs of the purged agents are returned
+func PurgeDeletedAgentsContext(ctx context.Context, Client *mongo.Database, GracePeriod time.Duration) ([]primitive.ObjectID, error) {
+	purged := make([]primitive.ObjectID, 0)
+
+	deleted, err := GetAgentsContext(ctx, Client, AgentFilter{Lifecycles: []models.LifecycleState{models.LifecycleDeleted}})
+	if err != nil {
+		return purged, err
+	}
+
+	now := time.Now()
+	for _, k := range deleted {
+		if !k.Purgeable(GracePeriod, now) {
+			continue
+		}
+
+		if err := purgeAgent(ctx, Client, k); err != nil {
+			if errors.Is(err, ErrNotPurgeable) {
+				//Restored in the meantime
+				continue
+			}
+			return purged, err
+		}
+		purged = append(purged, k.ID)
+	}
+
+	return purged, nil
+}
+
+//purgeAgent removes the agent and everything referencing it
+//The dependents are removed first, so a failed purge can be retried as long as the agent exists
+//The agent is only removed if it's still deleted. An agent restored while it's purged keeps its configuration, but loses its history
+func purgeAgent(ctx context.Context, Client *mongo.Database, Agent models.Agent) error {
+	guard := bson.M{
+		"_id":  Agent.ID,
+		"$and": []bson.M{lifecycleFilter(models.LifecycleDeleted)},
+	}
+
+	countCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	count, err := Client.Collection("agents").CountDocuments(countCtx, guard)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't check agent", Agent.Name, ":", err)
+		return err
+	}
+	if count == 0 {
+		return ErrNotPurgeable
+	}
+
+	dependents := []struct {
+		collection string
+		filter     bson.M
+	}{
+		{"results", bson.M{"hostid": Agent.ID}},
+		{"triggerevents", bson.M{"agentid": Agent.ID}},
+		{"deliveries", bson.M{"agentid": Agent.ID}},
+	}
+	for _, k := range dependents {
+		if err := purgeDependents(ctx, Client.Collection(k.collection), k.filter); err != nil {
+			logger.Error(loggingArea, "Couldn't purge", k.collection, "of agent", Agent.Name, ":", err)
+			return err
+		}
+	}
+
+	if err := pullReferences(ctx, Client.Collection("maintenances"), "scope.agentids", Agent.ID); err != nil {
+		return err
+	}
+	//Rules only scoped to the agent are disabled, as they would otherwise match every agent
+	if err := disableDocuments(ctx, Client.Collection("notificationrules"), bson.M{"agentids": bson.A{Agent.ID}}); err != nil {
+		return err
+	}
+	if err := pullReferences(ctx, Client.Collection("notificationrules"), "agentids", Agent.ID); err != nil {
+		return err
+	}
+
+	deleteCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Client.Collection("agents").DeleteOne(deleteCtx, guard)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't purge agent", Agent.Name, ":", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotPurgeable
+	}
+
+	logger.Debug(loggingArea, "Purged agent", Agent.Name)
+	return nil
+}
+
+//purgeDependents removes all documents of the collection matching the filter
+func purgeDependents(ctx context.Context, Collection *mongo.Collection, Filter bson.M) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	_, err := Collection.DeleteMany(ctx, Filter)
+	return err
+}
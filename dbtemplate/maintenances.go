@@ -0,0 +1,175 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//GetMaintenance returns the maintenance with the specified ID
+func GetMaintenance(Client *mongo.Database, ID primitive.ObjectID) (models.Maintenance, error) {
+	return GetMaintenanceContext(context.Background(), Client, ID)
+}
+
+//GetMaintenanceContext returns the maintenance with the specified ID
+func GetMaintenanceContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) (models.Maintenance, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result := Client.Collection("maintenances").FindOne(ctx, bson.M{"_id": ID})
+
+	if result.Err() != nil {
+		if !errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			logger.Error(loggingArea, "Couldn't read maintenance:", result.Err())
+		}
+
+		return models.Maintenance{}, result.Err()
+	}
+
+	var maintenance models.Maintenance
+	if err := result.Decode(&maintenance); err != nil {
+		logger.Error(loggingArea, "Couldn't decode maintenance:", err)
+		return models.Maintenance{}, err
+	}
+
+	return maintenance, nil
+}
+
+//GetAllMaintenances returns all maintenances from the database
+func GetAllMaintenances(Client *mongo.Database) ([]models.Maintenance, error) {
+	return GetAllMaintenancesContext(context.Background(), Client)
+}
+
+//GetAllMaintenancesContext returns all maintenances from the database
+func GetAllMaintenancesContext(ctx context.Context, Client *mongo.Database) ([]models.Maintenance, error) {
+	return findMaintenances(ctx, Client, bson.M{})
+}
+
+//GetActiveMaintenances returns all maintenances which are active at the specified time
+func GetActiveMaintenances(Client *mongo.Database, At time.Time) ([]models.Maintenance, error) {
+	return GetActiveMaintenancesContext(context.Background(), Client, At)
+}
+
+//GetActiveMaintenancesContext returns all maintenances which are active at the specified time
+func GetActiveMaintenancesContext(ctx context.Context, Client *mongo.Database, At time.Time) ([]models.Maintenance, error) {
+	//Only preselect by the bounds, recurring windows are checked by the model
+	candidates, err := findMaintenances(ctx, Client, bson.M{
+		"start": bson.M{"$lte": At},
+		"$or": []bson.M{
+			{"end": bson.M{"$gt": At}},
+			{"end": time.Time{}},
+			{"end": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		return candidates, err
+	}
+
+	return models.ActiveMaintenances(candidates, At), nil
+}
+
+//IsAgentInMaintenance returns true if the whole agent is covered by a maintenance active at the specified time
+func IsAgentInMaintenance(Client *mongo.Database, Agent models.Agent, At time.Time) (bool, error) {
+	return IsAgentInMaintenanceContext(context.Background(), Client, Agent, At)
+}
+
+//IsAgentInMaintenanceContext returns true if the whole agent is covered by a maintenance active at the specified time
+func IsAgentInMaintenanceContext(ctx context.Context, Client *mongo.Database, Agent models.Agent, At time.Time) (bool, error) {
+	maintenances, err := GetActiveMaintenancesContext(ctx, Client, At)
+	if err != nil {
+		return false, err
+	}
+
+	return Agent.InMaintenance(maintenances, At), nil
+}
+
+//IsTriggerInMaintenance returns true if the trigger of the agent is covered by a maintenance active at the specified time
+//The agent has to be populated
+func IsTriggerInMaintenance(Client *mongo.Database, Agent models.Agent, TriggerID primitive.ObjectID, At time.Time) (bool, error) {
+	return IsTriggerInMaintenanceContext(context.Background(), Client, Agent, TriggerID, At)
+}
+
+//IsTriggerInMaintenanceContext returns true if the trigger of the agent is covered by a maintenance active at the specified time
+//The agent has to be populated
+func IsTriggerInMaintenanceContext(ctx context.Context, Client *mongo.Database, Agent models.Agent, TriggerID primitive.ObjectID, At time.Time) (bool, error) {
+	maintenances, err := GetActiveMaintenancesContext(ctx, Client, At)
+	if err != nil {
+		return false, err
+	}
+
+	return Agent.TriggerInMaintenance(maintenances, TriggerID, At), nil
+}
+
+//CreateMaintenance validates and persists a new maintenance
+//The returned maintenance contains the generated ID
+func CreateMaintenance(Client *mongo.Database, Maintenance models.Maintenance) (models.Maintenance, error) {
+	return CreateMaintenanceContext(context.Background(), Client, Maintenance)
+}
+
+//CreateMaintenanceContext validates and persists a new maintenance
+//The returned maintenance contains the generated ID
+func CreateMaintenanceContext(ctx context.Context, Client *mongo.Database, Maintenance models.Maintenance) (models.Maintenance, error) {
+	if err := Maintenance.Validate(); err != nil {
+		return models.Maintenance{}, err
+	}
+
+	Maintenance.ID = primitive.NewObjectID()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("maintenances").InsertOne(ctx, Maintenance); err != nil {
+		logger.Error(loggingArea, "Couldn't insert maintenance:", err)
+		return models.Maintenance{}, err
+	}
+
+	return Maintenance, nil
+}
+
+//UpdateMaintenance validates and persists the changes of an existing maintenance
+func UpdateMaintenance(Client *mongo.Database, Maintenance models.Maintenance) error {
+	return UpdateMaintenanceContext(context.Background(), Client, Maintenance)
+}
+
+//UpdateMaintenanceContext validates and persists the changes of an existing maintenance
+func UpdateMaintenanceContext(ctx context.Context, Client *mongo.Database, Maintenance models.Maintenance) error {
+	if err := Maintenance.Validate(); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("maintenances"), Maintenance.ID, Maintenance)
+}
+
+//DeleteMaintenance removes the specified maintenance
+func DeleteMaintenance(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteMaintenanceContext(context.Background(), Client, ID)
+}
+
+//DeleteMaintenanceContext removes the specified maintenance
+func DeleteMaintenanceContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return deleteDocument(ctx, Client.Collection("maintenances"), ID)
+}
+
+func findMaintenances(ctx context.Context, Client *mongo.Database, Filter bson.M) ([]models.Maintenance, error) {
+	maintenances := make([]models.Maintenance, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("maintenances").Find(ctx, Filter)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read maintenances:", err)
+		return maintenances, err
+	}
+
+	if err := cursor.All(ctx, &maintenances); err != nil {
+		logger.Error(loggingArea, "Couldn't decode maintenances:", err)
+		return maintenances, err
+	}
+
+	return maintenances, nil
+}
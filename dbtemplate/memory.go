@@ -0,0 +1,2483 @@
+package dbtemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//MemoryStore implements the Store interface without any database
+//It behaves like MongoStore (including the population of agents and templates) and is mainly used for unit tests
+//All returned structs are copies, modifying them doesn't change the stored documents
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	agents    map[primitive.ObjectID]models.Agent
+	templates map[primitive.ObjectID]models.Template
+	items     map[primitive.ObjectID]models.Item
+	triggers  map[primitive.ObjectID]models.Trigger
+	results   []models.Result
+	events    []models.TriggerEvent
+
+	maintenances map[primitive.ObjectID]models.Maintenance
+
+	notificationRules map[primitive.ObjectID]models.NotificationRule
+	deliveries        []models.Delivery
+
+	escalationPolicies map[primitive.ObjectID]models.EscalationPolicy
+
+	silences map[primitive.ObjectID]models.Silence
+
+	autoRegistrationRules map[primitive.ObjectID]models.AutoRegistrationRule
+
+	members     map[uuid.UUID]models.ClusterMember
+	leaderships map[string]models.Leadership
+}
+
+var _ Store = &MemoryStore{}
+var _ ResultStore = &MemoryStore{}
+var _ TriggerEventStore = &MemoryStore{}
+var _ MaintenanceStore = &MemoryStore{}
+var _ NotificationStore = &MemoryStore{}
+var _ EscalationStore = &MemoryStore{}
+var _ SilenceStore = &MemoryStore{}
+var _ RegistrationStore = &MemoryStore{}
+var _ AutoRegistrationStore = &MemoryStore{}
+var _ LifecycleStore = &MemoryStore{}
+var _ AgentStateStore = &MemoryStore{}
+var _ LeaseStore = &MemoryStore{}
+var _ ClusterStore = &MemoryStore{}
+
+//NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		agents:    make(map[primitive.ObjectID]models.Agent),
+		templates: make(map[primitive.ObjectID]models.Template),
+		items:     make(map[primitive.ObjectID]models.Item),
+		triggers:  make(map[primitive.ObjectID]models.Trigger),
+		results:   make([]models.Result, 0),
+		events:    make([]models.TriggerEvent, 0),
+
+		maintenances: make(map[primitive.ObjectID]models.Maintenance),
+
+		notificationRules: make(map[primitive.ObjectID]models.NotificationRule),
+		deliveries:        make([]models.Delivery, 0),
+
+		escalationPolicies: make(map[primitive.ObjectID]models.EscalationPolicy),
+
+		silences: make(map[primitive.ObjectID]models.Silence),
+
+		autoRegistrationRules: make(map[primitive.ObjectID]models.AutoRegistrationRule),
+
+		members:     make(map[uuid.UUID]models.ClusterMember),
+		leaderships: make(map[string]models.Leadership),
+	}
+}
+
+//PutAgent stores the agent as is and returns it
+//If the ID of the agent isn't set, a new one is generated
+func (s *MemoryStore) PutAgent(Agent models.Agent) models.Agent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if Agent.ID.IsZero() {
+		Agent.ID = primitive.NewObjectID()
+	}
+	Agent.Templates = nil
+	s.agents[Agent.ID] = cloneAgent(Agent)
+
+	return Agent
+}
+
+//PutTemplate stores the template as is and returns it
+//If the ID of the template isn't set, a new one is generated
+func (s *MemoryStore) PutTemplate(Template models.Template) models.Template {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if Template.ID.IsZero() {
+		Template.ID = primitive.NewObjectID()
+	}
+	Template.Items = nil
+	Template.Triggers = nil
+	s.templates[Template.ID] = cloneTemplate(Template)
+
+	return Template
+}
+
+//PutItem stores the item as is and returns it
+//If the ID of the item isn't set, a new one is generated
+func (s *MemoryStore) PutItem(Item models.Item) models.Item {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if Item.ID.IsZero() {
+		Item.ID = primitive.NewObjectID()
+	}
+	s.items[Item.ID] = cloneItem(Item)
+
+	return Item
+}
+
+//PutTrigger stores the trigger as is and returns it
+//If the ID of the trigger isn't set, a new one is generated
+func (s *MemoryStore) PutTrigger(Trigger models.Trigger) models.Trigger {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if Trigger.ID.IsZero() {
+		Trigger.ID = primitive.NewObjectID()
+	}
+	s.triggers[Trigger.ID] = cloneTrigger(Trigger)
+
+	return Trigger
+}
+
+//PutResult stores the result as is (including its fencing token) and returns it
+//If the ID of the result isn't set, a new one is generated
+func (s *MemoryStore) PutResult(Result models.Result) models.Result {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if Result.ID.IsZero() {
+		Result.ID = primitive.NewObjectID()
+	}
+	s.results = append(s.results, Result)
+
+	return Result
+}
+
+//GetAgent returns the appropriate agent for the given ID
+func (s *MemoryStore) GetAgent(ctx context.Context, ID primitive.ObjectID) (models.Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Agent{}, err
+	}
+
+	s.mutex.RLock()
+	agent, found := s.agents[ID]
+	s.mutex.RUnlock()
+
+	if !found {
+		return models.Agent{}, ErrNotFound
+	}
+
+	agent = cloneAgent(agent)
+	if err := populateAgentFields(ctx, s, &agent); err != nil {
+		return models.Agent{}, err
+	}
+
+	return agent, nil
+}
+
+//GetAgentByUUID returns the appropriate agent for the given UUID
+func (s *MemoryStore) GetAgentByUUID(ctx context.Context, UUID uuid.UUID) (models.Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Agent{}, err
+	}
+
+	s.mutex.RLock()
+	var agent models.Agent
+	found := false
+	for _, k := range sortedAgents(s.agents) {
+		if k.AgentUUID == UUID {
+			agent = cloneAgent(k)
+			found = true
+			break
+		}
+	}
+	s.mutex.RUnlock()
+
+	if !found {
+		return models.Agent{}, ErrNotFound
+	}
+
+	if err := populateAgentFields(ctx, s, &agent); err != nil {
+		return models.Agent{}, err
+	}
+
+	return agent, nil
+}
+
+//GetAllAgents returns all agents which aren't deleted
+func (s *MemoryStore) GetAllAgents(ctx context.Context) ([]models.Agent, error) {
+	return s.GetAgents(ctx, AgentFilter{})
+}
+
+//GetAgents returns all agents matching the filter
+func (s *MemoryStore) GetAgents(ctx context.Context, Filter AgentFilter) ([]models.Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	agents := make([]models.Agent, 0)
+
+	s.mutex.RLock()
+	for _, k := range sortedAgents(s.agents) {
+		if Filter.matches(k) {
+			agents = append(agents, cloneAgent(k))
+		}
+	}
+	s.mutex.RUnlock()
+
+	for i := range agents {
+		if err := populateAgentFields(ctx, s, &agents[i]); err != nil {
+			return agents, err
+		}
+	}
+
+	return agents, nil
+}
+
+//GetTemplates returns one or multiple template structs for the specified IDs
+//Missing templates are omitted from the returned slice
+func (s *MemoryStore) GetTemplates(ctx context.Context, IDs []primitive.ObjectID) ([]models.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	templates := make([]models.Template, 0)
+
+	s.mutex.RLock()
+	for _, k := range sortedTemplates(s.templates) {
+		if containsObjectID(IDs, k.ID) {
+			templates = append(templates, cloneTemplate(k))
+		}
+	}
+	s.mutex.RUnlock()
+
+	for i := range templates {
+		if err := populateTemplateFields(ctx, s, &templates[i]); err != nil {
+			return templates, err
+		}
+	}
+
+	return templates, nil
+}
+
+//GetAllTemplates returns all stored templates
+func (s *MemoryStore) GetAllTemplates(ctx context.Context) ([]models.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	templates := make([]models.Template, 0)
+
+	s.mutex.RLock()
+	for _, k := range sortedTemplates(s.templates) {
+		templates = append(templates, cloneTemplate(k))
+	}
+	s.mutex.RUnlock()
+
+	for i := range templates {
+		if err := populateTemplateFields(ctx, s, &templates[i]); err != nil {
+			return templates, err
+		}
+	}
+
+	return templates, nil
+}
+
+//GetItems returns one or multiple item structs for the specified IDs
+//Missing items are omitted from the returned slice
+func (s *MemoryStore) GetItems(ctx context.Context, IDs []primitive.ObjectID) ([]models.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	items := make([]models.Item, 0)
+	for _, k := range sortedItems(s.items) {
+		if containsObjectID(IDs, k.ID) {
+			items = append(items, cloneItem(k))
+		}
+	}
+
+	return items, nil
+}
+
+//GetItemByName gets the appropriate item which matches the specified Name
+//WARNING: The query is case sensitive
+func (s *MemoryStore) GetItemByName(ctx context.Context, Name string) (models.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Item{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, k := range sortedItems(s.items) {
+		if k.Name == Name {
+			return cloneItem(k), nil
+		}
+	}
+
+	return models.Item{}, ErrNotFound
+}
+
+//GetTrigger gets the appropriate trigger which matches the specified ID
+func (s *MemoryStore) GetTrigger(ctx context.Context, ID primitive.ObjectID) (models.Trigger, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Trigger{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	trigger, found := s.triggers[ID]
+	if !found {
+		return models.Trigger{}, ErrNotFound
+	}
+
+	return cloneTrigger(trigger), nil
+}
+
+//GetTriggerByName gets the appropriate trigger which matches the specified Name
+func (s *MemoryStore) GetTriggerByName(ctx context.Context, Name string) (models.Trigger, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Trigger{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, k := range sortedTriggers(s.triggers) {
+		if k.Name == Name {
+			return cloneTrigger(k), nil
+		}
+	}
+
+	return models.Trigger{}, ErrNotFound
+}
+
+//GetTriggers returns one or multiple trigger structs for the specified IDs
+//Missing triggers are omitted from the returned slice
+func (s *MemoryStore) GetTriggers(ctx context.Context, IDs []primitive.ObjectID) ([]models.Trigger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	triggers := make([]models.Trigger, 0)
+	for _, k := range sortedTriggers(s.triggers) {
+		if containsObjectID(IDs, k.ID) {
+			triggers = append(triggers, cloneTrigger(k))
+		}
+	}
+
+	return triggers, nil
+}
+
+//GetAllTriggers returns all stored triggers
+func (s *MemoryStore) GetAllTriggers(ctx context.Context) ([]models.Trigger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	triggers := make([]models.Trigger, 0, len(s.triggers))
+	for _, k := range sortedTriggers(s.triggers) {
+		triggers = append(triggers, cloneTrigger(k))
+	}
+
+	return triggers, nil
+}
+
+//AddTriggerAssignments persist a mapping between an agent and one or multiple triggers
+func (s *MemoryStore) AddTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return ErrNotFound
+	}
+
+	for _, k := range TriggerIDs {
+		agent.TriggerMappings = append(agent.TriggerMappings, newTriggerAssignment(k))
+	}
+	s.agents[AgentID] = agent
+
+	return nil
+}
+
+//ReconcileTriggerAssignments brings the trigger assignments of the agent in line with the triggers assigned via its templates
+func (s *MemoryStore) ReconcileTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID) (ReconcileReport, error) {
+	agent, err := s.GetAgent(ctx, AgentID)
+	if err != nil {
+		return ReconcileReport{}, err
+	}
+
+	missing, stale := diffTriggerAssignments(agent)
+	report := ReconcileReport{
+		Added:   make([]primitive.ObjectID, 0),
+		Removed: make([]models.TriggerAssignment, 0),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, found := s.agents[AgentID]
+	if !found {
+		return report, ErrNotFound
+	}
+
+	mappings := make([]models.TriggerAssignment, 0, len(stored.TriggerMappings))
+	for _, k := range stored.TriggerMappings {
+		isStale := false
+		for _, j := range stale {
+			if j.TriggerID == k.TriggerID {
+				isStale = true
+				break
+			}
+		}
+
+		if isStale {
+			report.Removed = append(report.Removed, k)
+		} else {
+			mappings = append(mappings, k)
+		}
+	}
+
+	for _, k := range missing {
+		exists := false
+		for _, j := range mappings {
+			if j.TriggerID == k {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			mappings = append(mappings, newTriggerAssignment(k))
+			report.Added = append(report.Added, k)
+		}
+	}
+
+	stored.TriggerMappings = mappings
+	s.agents[AgentID] = stored
+
+	return report, nil
+}
+
+//SetTriggerState atomically sets the problem state and error of a single trigger assignment
+//A TriggerEvent is only stored if the problem state actually changed
+func (s *MemoryStore) SetTriggerState(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return s.setTriggerState(ctx, AgentID, nil, TriggerID, Problematic, Error)
+}
+
+//setTriggerState implements SetTriggerState, the fencing token is only checked if Token isn't nil
+func (s *MemoryStore) setTriggerState(ctx context.Context, AgentID primitive.ObjectID, Token *int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return false, ErrNotFound
+	}
+	if Token != nil && agent.Scraper.Token != *Token {
+		return false, ErrStaleToken
+	}
+
+	for i, k := range agent.TriggerMappings {
+		if k.TriggerID != TriggerID {
+			continue
+		}
+
+		//A manually closed problem stays closed until the expression recovers
+		transitioned := k.Problematic != Problematic && !(Problematic && k.ManuallyClosed)
+		if transitioned {
+			k.Problematic = Problematic
+			if Problematic {
+				k.ProblemSince = time.Now()
+				k.Acknowledged = false
+				k.SeverityOverride = nil
+				k.Acknowledgements = make([]models.Acknowledgement, 0)
+			}
+		} else if !Problematic {
+			k.ManuallyClosed = false
+		}
+		k.Error = Error
+		agent.TriggerMappings[i] = k
+		s.agents[AgentID] = agent
+
+		if transitioned {
+			s.events = append(s.events, s.newTriggerEvent(AgentID, TriggerID, Problematic, Error))
+		}
+
+		return transitioned, nil
+	}
+
+	return false, ErrNotFound
+}
+
+//CreateAgent validates and persists a new agent
+func (s *MemoryStore) CreateAgent(ctx context.Context, Agent models.Agent) (models.Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Agent{}, err
+	}
+
+	if err := Agent.Validate(); err != nil {
+		return models.Agent{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.agents {
+		if k.AgentUUID == Agent.AgentUUID {
+			return models.Agent{}, ErrAgentExists
+		}
+	}
+
+	Agent.ID = primitive.NewObjectID()
+	Agent.Templates = nil
+	if Agent.TemplateIDs == nil {
+		Agent.TemplateIDs = make([]primitive.ObjectID, 0)
+	}
+	if Agent.TriggerMappings == nil {
+		Agent.TriggerMappings = make([]models.TriggerAssignment, 0)
+	}
+	Agent = initLifecycle(Agent)
+	s.agents[Agent.ID] = cloneAgent(Agent)
+
+	return Agent, nil
+}
+
+//UpdateAgent validates and persists the user editable fields of an existing agent
+//The lifecycle state (and with it Enabled) is changed via SetAgentLifecycle
+func (s *MemoryStore) UpdateAgent(ctx context.Context, Agent models.Agent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Agent.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, found := s.agents[Agent.ID]
+	if !found {
+		return ErrNotFound
+	}
+
+	stored.Name = Agent.Name
+	stored.Description = Agent.Description
+	stored.OS = Agent.OS
+	stored.TemplateIDs = cloneObjectIDs(Agent.TemplateIDs)
+	if stored.TemplateIDs == nil {
+		stored.TemplateIDs = make([]primitive.ObjectID, 0)
+	}
+	stored.Endpoint = Agent.Endpoint
+	stored.ScrapeInterval = Agent.ScrapeInterval
+	stored.Tags = append(make([]string, 0, len(Agent.Tags)), Agent.Tags...)
+	stored.ItemSchedules = cloneItemSchedules(Agent.ItemSchedules)
+	stored.Macros = cloneStringMap(Agent.Macros)
+	s.agents[Agent.ID] = stored
+
+	return nil
+}
+
+//AcquireScraperLease acquires the lease of the agent for the scraper if it's free or expired
+func (s *MemoryStore) AcquireScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration) (models.ScraperLease, error) {
+	return s.acquireScraperLease(ctx, AgentID, Scraper, Duration, func(Lease models.ScraperLease, Now time.Time) bool {
+		return Lease.Free(Now) || Lease.UUID == Scraper
+	})
+}
+
+//StealScraperLease acquires the lease of the agent like AcquireScraperLease, but also takes over leases which weren't renewed within Timeout
+func (s *MemoryStore) StealScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Timeout time.Duration) (models.ScraperLease, error) {
+	return s.acquireScraperLease(ctx, AgentID, Scraper, Duration, func(Lease models.ScraperLease, Now time.Time) bool {
+		return Lease.Free(Now) || Lease.UUID == Scraper || !Lease.Lock.After(Now.Add(-Timeout))
+	})
+}
+
+func (s *MemoryStore) acquireScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Acquirable func(models.ScraperLease, time.Time) bool) (models.ScraperLease, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ScraperLease{}, err
+	}
+
+	if Scraper == uuid.Nil {
+		return models.ScraperLease{}, errors.New("scraper uuid can't be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return models.ScraperLease{}, ErrNotFound
+	}
+
+	now := time.Now()
+	if !Acquirable(agent.Scraper, now) {
+		return models.ScraperLease{}, ErrLeaseHeld
+	}
+
+	agent.Scraper = models.ScraperLease{UUID: Scraper, Lock: now, Expires: now.Add(Duration), Token: agent.Scraper.Token + 1, Acquired: now}
+	s.agents[AgentID] = agent
+
+	return agent.Scraper, nil
+}
+
+//RenewScraperLease extends the lease of the scraper by Duration
+func (s *MemoryStore) RenewScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease, Duration time.Duration) (models.ScraperLease, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ScraperLease{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return models.ScraperLease{}, ErrNotFound
+	}
+	if agent.Scraper.UUID != Lease.UUID || agent.Scraper.Token != Lease.Token {
+		return models.ScraperLease{}, ErrLeaseLost
+	}
+
+	now := time.Now()
+	agent.Scraper.Lock = now
+	agent.Scraper.Expires = now.Add(Duration)
+	s.agents[AgentID] = agent
+
+	return agent.Scraper, nil
+}
+
+//ReleaseScraperLease releases the lease of the scraper, so other scrapers can acquire it right away
+func (s *MemoryStore) ReleaseScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return ErrNotFound
+	}
+	if agent.Scraper.UUID != Lease.UUID || agent.Scraper.Token != Lease.Token {
+		return ErrLeaseLost
+	}
+
+	agent.Scraper.UUID = uuid.Nil
+	agent.Scraper.Expires = time.Time{}
+	s.agents[AgentID] = agent
+
+	return nil
+}
+
+//InsertResultsFenced persists the results of the agent if the fencing token belongs to its current lease
+func (s *MemoryStore) InsertResultsFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, Results []models.Result) ([]models.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, k := range Results {
+		if k.HostID != AgentID {
+			return nil, fmt.Errorf("result for agent %s can't be stored with the lease of agent %s", k.HostID.Hex(), AgentID.Hex())
+		}
+	}
+
+	results, err := prepareResults(Results, Token)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return nil, ErrNotFound
+	}
+	if agent.Scraper.Token != Token {
+		return nil, ErrStaleToken
+	}
+	s.results = append(s.results, results...)
+
+	return results, nil
+}
+
+//SetTriggerStateFenced works like SetTriggerState, but only updates the trigger assignment if the fencing token belongs to the current lease of the agent
+func (s *MemoryStore) SetTriggerStateFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return s.setTriggerState(ctx, AgentID, &Token, TriggerID, Problematic, Error)
+}
+
+//SetAgentState sets the online state of the agent and stores a trigger event if it changed
+//The agent is only marked offline if it wasn't seen after LastSeen
+func (s *MemoryStore) SetAgentState(ctx context.Context, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return false, ErrNotFound
+	}
+
+	if agent.State == State {
+		return false, nil
+	}
+	if State == models.Offline && agent.LastSeen.After(LastSeen) {
+		return false, nil
+	}
+
+	agent.State = State
+	agent.StateChanged = At
+	s.agents[AgentID] = agent
+
+	event := models.NewStateEvent(AgentID, State, At, Error)
+	event.ID = primitive.NewObjectID()
+	s.events = append(s.events, event)
+
+	return true, nil
+}
+
+//DeleteAgent moves the specified agent into the deleted lifecycle state
+func (s *MemoryStore) DeleteAgent(ctx context.Context, ID primitive.ObjectID) error {
+	return s.SetAgentLifecycle(ctx, ID, models.LifecycleDeleted, "")
+}
+
+//SetAgentLifecycle moves the agent into the specified lifecycle state
+//Setting the current state again is a no-op, deleted agents have to be restored via RestoreAgent
+func (s *MemoryStore) SetAgentLifecycle(ctx context.Context, ID primitive.ObjectID, State models.LifecycleState, User string) error {
+	return s.transitionAgent(ctx, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		if Agent.Lifecycle() == State {
+			return models.LifecycleTransition{}, errNoTransition
+		}
+
+		return Agent.TransitionTo(State, User, time.Now())
+	})
+}
+
+//RestoreAgent moves a deleted agent back into the state it had before it was deleted
+func (s *MemoryStore) RestoreAgent(ctx context.Context, ID primitive.ObjectID, User string) error {
+	return s.transitionAgent(ctx, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		return Agent.RestoreTransition(User, time.Now())
+	})
+}
+
+func (s *MemoryStore) transitionAgent(ctx context.Context, ID primitive.ObjectID, Transition func(models.Agent) (models.LifecycleTransition, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[ID]
+	if !found {
+		return ErrNotFound
+	}
+
+	transition, err := Transition(agent)
+	if errors.Is(err, errNoTransition) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.agents[ID] = agent.ApplyTransition(transition)
+
+	return nil
+}
+
+//PurgeAgent permanently removes a deleted agent including its trigger assignments, results, trigger events and deliveries
+//ErrNotPurgeable is returned if the agent isn't deleted or was deleted less than GracePeriod ago
+func (s *MemoryStore) PurgeAgent(ctx context.Context, ID primitive.ObjectID, GracePeriod time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[ID]
+	if !found {
+		return ErrNotFound
+	}
+
+	if !agent.Purgeable(GracePeriod, time.Now()) {
+		return ErrNotPurgeable
+	}
+
+	s.purgeAgent(ID)
+
+	return nil
+}
+
+//PurgeDeletedAgents permanently removes all agents which were deleted more than GracePeriod ago
+func (s *MemoryStore) PurgeDeletedAgents(ctx context.Context, GracePeriod time.Duration) ([]primitive.ObjectID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	purged := make([]primitive.ObjectID, 0)
+	now := time.Now()
+	for _, k := range sortedAgents(s.agents) {
+		if k.Purgeable(GracePeriod, now) {
+			s.purgeAgent(k.ID)
+			purged = append(purged, k.ID)
+		}
+	}
+
+	return purged, nil
+}
+
+//purgeAgent removes the agent and everything referencing it, the caller has to hold the lock
+func (s *MemoryStore) purgeAgent(ID primitive.ObjectID) {
+	delete(s.agents, ID)
+
+	results := make([]models.Result, 0, len(s.results))
+	for _, k := range s.results {
+		if k.HostID != ID {
+			results = append(results, k)
+		}
+	}
+	s.results = results
+
+	events := make([]models.TriggerEvent, 0, len(s.events))
+	for _, k := range s.events {
+		if k.AgentID != ID {
+			events = append(events, k)
+		}
+	}
+	s.events = events
+
+	deliveries := make([]models.Delivery, 0, len(s.deliveries))
+	for _, k := range s.deliveries {
+		if k.AgentID != ID {
+			deliveries = append(deliveries, k)
+		}
+	}
+	s.deliveries = deliveries
+
+	for maintenanceID, maintenance := range s.maintenances {
+		maintenance.Scope.AgentIDs = removeObjectID(maintenance.Scope.AgentIDs, ID)
+		s.maintenances[maintenanceID] = maintenance
+	}
+	for ruleID, rule := range s.notificationRules {
+		if onlyObjectID(rule.AgentIDs, ID) {
+			rule.Enabled = false
+		}
+		rule.AgentIDs = removeObjectID(rule.AgentIDs, ID)
+		s.notificationRules[ruleID] = rule
+	}
+}
+
+//CreateTemplate validates and persists a new template
+func (s *MemoryStore) CreateTemplate(ctx context.Context, Template models.Template) (models.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Template{}, err
+	}
+
+	if err := Template.Validate(); err != nil {
+		return models.Template{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	Template.ID = primitive.NewObjectID()
+	Template.Items = nil
+	Template.Triggers = nil
+	fixTemplateArrays(&Template)
+	s.templates[Template.ID] = cloneTemplate(Template)
+
+	return Template, nil
+}
+
+//UpdateTemplate validates and persists the changes of an existing template
+func (s *MemoryStore) UpdateTemplate(ctx context.Context, Template models.Template) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Template.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.templates[Template.ID]; !found {
+		return ErrNotFound
+	}
+
+	Template.Items = nil
+	Template.Triggers = nil
+	fixTemplateArrays(&Template)
+	s.templates[Template.ID] = cloneTemplate(Template)
+
+	return nil
+}
+
+//DeleteTemplate removes the specified template and unlinks it from all agents, auto registration rules, maintenances, notification rules and escalation policies
+func (s *MemoryStore) DeleteTemplate(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.templates[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.templates, ID)
+
+	for agentID, agent := range s.agents {
+		agent.TemplateIDs = removeObjectID(agent.TemplateIDs, ID)
+		s.agents[agentID] = agent
+	}
+	for ruleID, rule := range s.autoRegistrationRules {
+		if onlyObjectID(rule.TemplateIDs, ID) && rule.ScrapeInterval <= 0 && len(rule.Tags) == 0 {
+			rule.Enabled = false
+		}
+		rule.TemplateIDs = removeObjectID(rule.TemplateIDs, ID)
+		s.autoRegistrationRules[ruleID] = rule
+	}
+	for maintenanceID, maintenance := range s.maintenances {
+		maintenance.Scope.TemplateIDs = removeObjectID(maintenance.Scope.TemplateIDs, ID)
+		s.maintenances[maintenanceID] = maintenance
+	}
+	for ruleID, rule := range s.notificationRules {
+		if onlyObjectID(rule.TemplateIDs, ID) {
+			rule.Enabled = false
+		}
+		rule.TemplateIDs = removeObjectID(rule.TemplateIDs, ID)
+		s.notificationRules[ruleID] = rule
+	}
+	for policyID, policy := range s.escalationPolicies {
+		if onlyObjectID(policy.TemplateIDs, ID) {
+			policy.Enabled = false
+		}
+		policy.TemplateIDs = removeObjectID(policy.TemplateIDs, ID)
+		s.escalationPolicies[policyID] = policy
+	}
+
+	return nil
+}
+
+//CreateItem validates and persists a new item
+func (s *MemoryStore) CreateItem(ctx context.Context, Item models.Item) (models.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Item{}, err
+	}
+
+	if err := Item.Validate(); err != nil {
+		return models.Item{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.items {
+		if k.Name == Item.Name {
+			return models.Item{}, ErrNameInUse
+		}
+	}
+
+	Item.ID = primitive.NewObjectID()
+	s.items[Item.ID] = cloneItem(Item)
+
+	return Item, nil
+}
+
+//UpdateItem validates and persists the changes of an existing item
+func (s *MemoryStore) UpdateItem(ctx context.Context, Item models.Item) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Item.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.items {
+		if k.Name == Item.Name && k.ID != Item.ID {
+			return ErrNameInUse
+		}
+	}
+
+	if _, found := s.items[Item.ID]; !found {
+		return ErrNotFound
+	}
+	s.items[Item.ID] = cloneItem(Item)
+
+	return nil
+}
+
+//DeleteItem removes the specified item and unlinks it from all templates
+func (s *MemoryStore) DeleteItem(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.items[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.items, ID)
+
+	for templateID, template := range s.templates {
+		template.ItemIDs = removeObjectID(template.ItemIDs, ID)
+		s.templates[templateID] = template
+	}
+
+	return nil
+}
+
+//CreateTrigger validates and persists a new trigger
+func (s *MemoryStore) CreateTrigger(ctx context.Context, Trigger models.Trigger) (models.Trigger, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Trigger{}, err
+	}
+
+	if err := validateTrigger(Trigger); err != nil {
+		return models.Trigger{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.triggers {
+		if k.Name == Trigger.Name {
+			return models.Trigger{}, ErrNameInUse
+		}
+	}
+
+	Trigger.ID = primitive.NewObjectID()
+	if Trigger.DependsOn == nil {
+		Trigger.DependsOn = make([]primitive.ObjectID, 0)
+	}
+
+	if err := checkTriggerDependencies(Trigger, sortedTriggers(s.triggers)); err != nil {
+		return models.Trigger{}, err
+	}
+	s.triggers[Trigger.ID] = cloneTrigger(Trigger)
+
+	return Trigger, nil
+}
+
+//UpdateTrigger validates and persists the changes of an existing trigger
+func (s *MemoryStore) UpdateTrigger(ctx context.Context, Trigger models.Trigger) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := validateTrigger(Trigger); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.triggers {
+		if k.Name == Trigger.Name && k.ID != Trigger.ID {
+			return ErrNameInUse
+		}
+	}
+
+	if _, found := s.triggers[Trigger.ID]; !found {
+		return ErrNotFound
+	}
+	if Trigger.DependsOn == nil {
+		Trigger.DependsOn = make([]primitive.ObjectID, 0)
+	}
+
+	if err := checkTriggerDependencies(Trigger, sortedTriggers(s.triggers)); err != nil {
+		return err
+	}
+	s.triggers[Trigger.ID] = cloneTrigger(Trigger)
+
+	return nil
+}
+
+//DeleteTrigger removes the specified trigger
+//The trigger is also unlinked from all templates, dependent triggers and agents (trigger assignments)
+func (s *MemoryStore) DeleteTrigger(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.triggers[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.triggers, ID)
+
+	for templateID, template := range s.templates {
+		template.TriggerIDs = removeObjectID(template.TriggerIDs, ID)
+		s.templates[templateID] = template
+	}
+
+	for triggerID, trigger := range s.triggers {
+		trigger.DependsOn = removeObjectID(trigger.DependsOn, ID)
+		s.triggers[triggerID] = trigger
+	}
+
+	for agentID, agent := range s.agents {
+		mappings := make([]models.TriggerAssignment, 0, len(agent.TriggerMappings))
+		for _, k := range agent.TriggerMappings {
+			if k.TriggerID != ID {
+				mappings = append(mappings, k)
+			}
+		}
+		agent.TriggerMappings = mappings
+		s.agents[agentID] = agent
+	}
+
+	return nil
+}
+
+//InsertResult validates and persists a single result
+func (s *MemoryStore) InsertResult(ctx context.Context, Result models.Result) (models.Result, error) {
+	results, err := s.InsertResults(ctx, []models.Result{Result})
+	if err != nil {
+		return models.Result{}, err
+	}
+
+	return results[0], nil
+}
+
+//InsertResults validates and persists multiple results
+func (s *MemoryStore) InsertResults(ctx context.Context, Results []models.Result) ([]models.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := prepareResults(Results, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.results = append(s.results, results...)
+
+	return results, nil
+}
+
+//GetLastResults returns the last N results of the item captured on the specified agent
+//If Limit is 0 all results are returned
+func (s *MemoryStore) GetLastResults(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ResultSet{}, err
+	}
+
+	lease := s.scraperLease(HostID)
+	set := s.filterResults(func(Result models.Result) bool {
+		return Result.ItemID == ItemID && Result.HostID == HostID && !lease.Stale(Result)
+	})
+
+	if Limit > 0 && len(set.Results) > Limit {
+		set.Results = set.Results[:Limit]
+	}
+
+	return set, nil
+}
+
+//GetResultsBetween returns all results of the item captured on the specified agent between From and To (both inclusive)
+func (s *MemoryStore) GetResultsBetween(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, From time.Time, To time.Time) (models.ResultSet, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ResultSet{}, err
+	}
+
+	lease := s.scraperLease(HostID)
+	return s.filterResults(func(Result models.Result) bool {
+		return Result.ItemID == ItemID && Result.HostID == HostID && !Result.CapturedAt.Before(From) && !Result.CapturedAt.After(To) && !lease.Stale(Result)
+	}), nil
+}
+
+//GetLatestResultPerItem returns the newest result of every item captured on the specified agent
+func (s *MemoryStore) GetLatestResultPerItem(ctx context.Context, HostID primitive.ObjectID) (models.ResultSet, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ResultSet{}, err
+	}
+
+	lease := s.scraperLease(HostID)
+	seen := make(map[primitive.ObjectID]bool)
+	return s.filterResults(func(Result models.Result) bool {
+		if Result.HostID != HostID || seen[Result.ItemID] || lease.Stale(Result) {
+			return false
+		}
+
+		seen[Result.ItemID] = true
+		return true
+	}), nil
+}
+
+//scraperLease returns the scraper lease of the agent, which is empty if the agent doesn't exist
+func (s *MemoryStore) scraperLease(AgentID primitive.ObjectID) models.ScraperLease {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.agents[AgentID].Scraper
+}
+
+//filterResults returns all results matching the filter ordered newest-first
+//The filter is called in that order as well
+func (s *MemoryStore) filterResults(Filter func(Result models.Result) bool) models.ResultSet {
+	s.mutex.RLock()
+	sorted := append(make([]models.Result, 0, len(s.results)), s.results...)
+	s.mutex.RUnlock()
+
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CapturedAt.After(sorted[j].CapturedAt) })
+
+	set := models.ResultSet{Results: make([]models.Result, 0)}
+	for _, k := range sorted {
+		if Filter(k) {
+			set.Results = append(set.Results, k)
+		}
+	}
+
+	return set
+}
+
+//InsertTriggerEvent persists a single trigger event
+func (s *MemoryStore) InsertTriggerEvent(ctx context.Context, Event models.TriggerEvent) (models.TriggerEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TriggerEvent{}, err
+	}
+
+	Event.ID = primitive.NewObjectID()
+	if Event.Time.IsZero() {
+		Event.Time = time.Now()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, Event)
+
+	return Event, nil
+}
+
+//GetTriggerEvents returns all trigger events matching the filter ordered newest-first
+func (s *MemoryStore) GetTriggerEvents(ctx context.Context, Filter TriggerEventFilter) ([]models.TriggerEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	events := make([]models.TriggerEvent, 0)
+	for _, k := range s.sortedEvents() {
+		if Filter.Limit > 0 && len(events) >= Filter.Limit {
+			break
+		}
+		if Filter.matches(k) {
+			events = append(events, k)
+		}
+	}
+
+	return events, nil
+}
+
+//PruneTriggerEvents removes all trigger events exceeding the retention limits
+func (s *MemoryStore) PruneTriggerEvents(ctx context.Context, Retention TriggerEventRetention) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-Retention.MaxAge)
+	type assignmentKey struct{ AgentID, TriggerID primitive.ObjectID }
+	kept := make(map[assignmentKey]int)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := sortEvents(s.events)
+	remaining := make([]models.TriggerEvent, 0, len(events))
+	for _, k := range events {
+		if Retention.MaxAge > 0 && k.Time.Before(cutoff) {
+			continue
+		}
+
+		key := assignmentKey{AgentID: k.AgentID, TriggerID: k.TriggerID}
+		if Retention.MaxEventsPerAssignment > 0 && kept[key] >= Retention.MaxEventsPerAssignment {
+			continue
+		}
+
+		kept[key]++
+		remaining = append(remaining, k)
+	}
+
+	removed := int64(len(s.events) - len(remaining))
+	s.events = remaining
+
+	return removed, nil
+}
+
+//sortedEvents returns a copy of all trigger events ordered newest-first
+func (s *MemoryStore) sortedEvents() []models.TriggerEvent {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return sortEvents(s.events)
+}
+
+func sortEvents(Events []models.TriggerEvent) []models.TriggerEvent {
+	sorted := append(make([]models.TriggerEvent, 0, len(Events)), Events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+
+	return sorted
+}
+
+//GetMaintenance returns the maintenance with the specified ID
+func (s *MemoryStore) GetMaintenance(ctx context.Context, ID primitive.ObjectID) (models.Maintenance, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Maintenance{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	maintenance, found := s.maintenances[ID]
+	if !found {
+		return models.Maintenance{}, ErrNotFound
+	}
+
+	return cloneMaintenance(maintenance), nil
+}
+
+//GetAllMaintenances returns all stored maintenances
+func (s *MemoryStore) GetAllMaintenances(ctx context.Context) ([]models.Maintenance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	maintenances := make([]models.Maintenance, 0, len(s.maintenances))
+	for _, k := range s.maintenances {
+		maintenances = append(maintenances, cloneMaintenance(k))
+	}
+	sort.Slice(maintenances, func(i, j int) bool { return lessObjectID(maintenances[i].ID, maintenances[j].ID) })
+
+	return maintenances, nil
+}
+
+//GetActiveMaintenances returns all maintenances which are active at the specified time
+func (s *MemoryStore) GetActiveMaintenances(ctx context.Context, At time.Time) ([]models.Maintenance, error) {
+	maintenances, err := s.GetAllMaintenances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ActiveMaintenances(maintenances, At), nil
+}
+
+//CreateMaintenance validates and persists a new maintenance
+func (s *MemoryStore) CreateMaintenance(ctx context.Context, Maintenance models.Maintenance) (models.Maintenance, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Maintenance{}, err
+	}
+
+	if err := Maintenance.Validate(); err != nil {
+		return models.Maintenance{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	Maintenance.ID = primitive.NewObjectID()
+	s.maintenances[Maintenance.ID] = cloneMaintenance(Maintenance)
+
+	return Maintenance, nil
+}
+
+//UpdateMaintenance validates and persists the changes of an existing maintenance
+func (s *MemoryStore) UpdateMaintenance(ctx context.Context, Maintenance models.Maintenance) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Maintenance.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.maintenances[Maintenance.ID]; !found {
+		return ErrNotFound
+	}
+	s.maintenances[Maintenance.ID] = cloneMaintenance(Maintenance)
+
+	return nil
+}
+
+//DeleteMaintenance removes the specified maintenance
+func (s *MemoryStore) DeleteMaintenance(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.maintenances[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.maintenances, ID)
+
+	return nil
+}
+
+//AcknowledgeProblem marks the current problem of the trigger assignment as acknowledged
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func (s *MemoryStore) AcknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement) error {
+	Acknowledgement.Action = models.ProblemAcknowledged
+
+	return s.updateProblem(ctx, AgentID, TriggerID, Acknowledgement, func(Assignment *models.TriggerAssignment) {
+		Assignment.Acknowledged = true
+		if Acknowledgement.Severity != nil {
+			severity := *Acknowledgement.Severity
+			Assignment.SeverityOverride = &severity
+		}
+	})
+}
+
+//UnacknowledgeProblem revokes the acknowledgement of the current problem of the trigger assignment
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func (s *MemoryStore) UnacknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return s.updateProblem(ctx, AgentID, TriggerID, models.Acknowledgement{
+		User:    User,
+		Action:  models.ProblemUnacknowledged,
+		Comment: Comment,
+	}, func(Assignment *models.TriggerAssignment) {
+		Assignment.Acknowledged = false
+	})
+}
+
+//CloseProblem manually closes the current problem of the trigger assignment and stores a TriggerEvent for it
+//ErrNoProblem is returned if the trigger assignment isn't problematic
+func (s *MemoryStore) CloseProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return s.updateProblem(ctx, AgentID, TriggerID, models.Acknowledgement{
+		User:    User,
+		Action:  models.ProblemClosed,
+		Comment: Comment,
+	}, func(Assignment *models.TriggerAssignment) {
+		Assignment.Problematic = false
+		Assignment.ManuallyClosed = true
+		Assignment.Error = ""
+
+		event := s.newTriggerEvent(AgentID, TriggerID, false, "")
+		event.User = User
+		s.events = append(s.events, event)
+	})
+}
+
+//updateProblem applies the update to the problematic trigger assignment and records the acknowledgement
+//Update is called while holding the write lock
+func (s *MemoryStore) updateProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement, Update func(Assignment *models.TriggerAssignment)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	Acknowledgement.Time = time.Now()
+	if err := Acknowledgement.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, found := s.agents[AgentID]
+	if !found {
+		return ErrNotFound
+	}
+
+	for i, k := range agent.TriggerMappings {
+		if k.TriggerID != TriggerID {
+			continue
+		}
+
+		if !k.Problematic {
+			return ErrNoProblem
+		}
+
+		Update(&k)
+		k.Acknowledgements = append(k.Acknowledgements, Acknowledgement)
+		agent.TriggerMappings[i] = k
+		s.agents[AgentID] = agent
+
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+//newTriggerEvent creates a trigger event with the severity of the stored trigger
+//The store has to be locked
+func (s *MemoryStore) newTriggerEvent(AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) models.TriggerEvent {
+	event := models.TriggerEvent{
+		ID:          primitive.NewObjectID(),
+		AgentID:     AgentID,
+		TriggerID:   TriggerID,
+		Time:        time.Now(),
+		Problematic: Problematic,
+		Error:       Error,
+	}
+	if trigger, found := s.triggers[TriggerID]; found {
+		event.Severity = trigger.Severity
+	}
+
+	return event
+}
+
+//GetAllNotificationRules returns all stored notification rules
+func (s *MemoryStore) GetAllNotificationRules(ctx context.Context) ([]models.NotificationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rules := make([]models.NotificationRule, 0, len(s.notificationRules))
+	for _, k := range s.notificationRules {
+		rules = append(rules, k)
+	}
+	sort.Slice(rules, func(i, j int) bool { return lessObjectID(rules[i].ID, rules[j].ID) })
+
+	return rules, nil
+}
+
+//CreateNotificationRule validates and persists a new notification rule
+func (s *MemoryStore) CreateNotificationRule(ctx context.Context, Rule models.NotificationRule) (models.NotificationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return models.NotificationRule{}, err
+	}
+
+	if err := validateNotificationRule(Rule); err != nil {
+		return models.NotificationRule{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.notificationRules {
+		if k.Name == Rule.Name {
+			return models.NotificationRule{}, ErrNameInUse
+		}
+	}
+
+	Rule.ID = primitive.NewObjectID()
+	s.notificationRules[Rule.ID] = Rule
+
+	return Rule, nil
+}
+
+//UpdateNotificationRule validates and persists the changes of an existing notification rule
+func (s *MemoryStore) UpdateNotificationRule(ctx context.Context, Rule models.NotificationRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := validateNotificationRule(Rule); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.notificationRules[Rule.ID]; !found {
+		return ErrNotFound
+	}
+	for _, k := range s.notificationRules {
+		if k.Name == Rule.Name && k.ID != Rule.ID {
+			return ErrNameInUse
+		}
+	}
+	s.notificationRules[Rule.ID] = Rule
+
+	return nil
+}
+
+//DeleteNotificationRule removes the specified notification rule
+func (s *MemoryStore) DeleteNotificationRule(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.notificationRules[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.notificationRules, ID)
+
+	return nil
+}
+
+//InsertDelivery persists a new entry of the delivery log
+func (s *MemoryStore) InsertDelivery(ctx context.Context, Delivery models.Delivery) (models.Delivery, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Delivery{}, err
+	}
+
+	Delivery.ID = primitive.NewObjectID()
+	if Delivery.Created.IsZero() {
+		Delivery.Created = time.Now()
+	}
+	Delivery.Updated = Delivery.Created
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deliveries = append(s.deliveries, Delivery)
+
+	return Delivery, nil
+}
+
+//UpdateDelivery persists the status of an existing entry of the delivery log
+func (s *MemoryStore) UpdateDelivery(ctx context.Context, Delivery models.Delivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	Delivery.Updated = time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, k := range s.deliveries {
+		if k.ID == Delivery.ID {
+			s.deliveries[i] = Delivery
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+//GetDeliveries returns all deliveries matching the filter ordered newest-first
+func (s *MemoryStore) GetDeliveries(ctx context.Context, Filter DeliveryFilter) ([]models.Delivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	deliveries := make([]models.Delivery, 0)
+	for _, k := range s.deliveries {
+		if Filter.matches(k) {
+			deliveries = append(deliveries, k)
+		}
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].Created.After(deliveries[j].Created) })
+	if Filter.Limit > 0 && len(deliveries) > Filter.Limit {
+		deliveries = deliveries[:Filter.Limit]
+	}
+
+	return deliveries, nil
+}
+
+//GetAllEscalationPolicies returns all stored escalation policies
+func (s *MemoryStore) GetAllEscalationPolicies(ctx context.Context) ([]models.EscalationPolicy, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	policies := make([]models.EscalationPolicy, 0, len(s.escalationPolicies))
+	for _, k := range s.escalationPolicies {
+		policies = append(policies, k)
+	}
+	sort.Slice(policies, func(i, j int) bool { return lessObjectID(policies[i].ID, policies[j].ID) })
+
+	return policies, nil
+}
+
+//CreateEscalationPolicy validates and persists a new escalation policy
+func (s *MemoryStore) CreateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) (models.EscalationPolicy, error) {
+	if err := ctx.Err(); err != nil {
+		return models.EscalationPolicy{}, err
+	}
+
+	if err := Policy.Validate(); err != nil {
+		return models.EscalationPolicy{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.escalationPolicies {
+		if k.Name == Policy.Name {
+			return models.EscalationPolicy{}, ErrNameInUse
+		}
+	}
+
+	Policy.ID = primitive.NewObjectID()
+	s.escalationPolicies[Policy.ID] = Policy
+
+	return Policy, nil
+}
+
+//UpdateEscalationPolicy validates and persists the changes of an existing escalation policy
+func (s *MemoryStore) UpdateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Policy.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.escalationPolicies[Policy.ID]; !found {
+		return ErrNotFound
+	}
+	for _, k := range s.escalationPolicies {
+		if k.Name == Policy.Name && k.ID != Policy.ID {
+			return ErrNameInUse
+		}
+	}
+	s.escalationPolicies[Policy.ID] = Policy
+
+	return nil
+}
+
+//DeleteEscalationPolicy removes the specified escalation policy
+func (s *MemoryStore) DeleteEscalationPolicy(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.escalationPolicies[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.escalationPolicies, ID)
+
+	return nil
+}
+
+//GetAllSilences returns all stored silences
+func (s *MemoryStore) GetAllSilences(ctx context.Context) ([]models.Silence, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	silences := make([]models.Silence, 0, len(s.silences))
+	for _, k := range s.silences {
+		silences = append(silences, k)
+	}
+	sort.Slice(silences, func(i, j int) bool { return lessObjectID(silences[i].ID, silences[j].ID) })
+
+	return silences, nil
+}
+
+//GetActiveSilences returns all silences which are active at the specified time
+func (s *MemoryStore) GetActiveSilences(ctx context.Context, At time.Time) ([]models.Silence, error) {
+	silences, err := s.GetAllSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ActiveSilences(silences, At), nil
+}
+
+//CreateSilence validates and persists a new silence
+func (s *MemoryStore) CreateSilence(ctx context.Context, Silence models.Silence) (models.Silence, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Silence{}, err
+	}
+
+	if err := Silence.Validate(); err != nil {
+		return models.Silence{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	Silence.ID = primitive.NewObjectID()
+	Silence.Created = time.Now()
+	s.silences[Silence.ID] = Silence
+
+	return Silence, nil
+}
+
+//UpdateSilence validates and persists the changes of an existing silence
+func (s *MemoryStore) UpdateSilence(ctx context.Context, Silence models.Silence) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Silence.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.silences[Silence.ID]; !found {
+		return ErrNotFound
+	}
+	s.silences[Silence.ID] = Silence
+
+	return nil
+}
+
+//ExpireSilence ends the silence immediately, silences which haven't started yet are deleted
+func (s *MemoryStore) ExpireSilence(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	silence, found := s.silences[ID]
+	if !found {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	if !silence.Start.Before(now) {
+		delete(s.silences, ID)
+	} else if silence.End.After(now) {
+		silence.End = now
+		s.silences[ID] = silence
+	}
+
+	return nil
+}
+
+//DeleteSilence removes the specified silence
+func (s *MemoryStore) DeleteSilence(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.silences[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.silences, ID)
+
+	return nil
+}
+
+//RegisterAgent creates a new agent or updates the existing agent with the same uuid
+//The returned bool is true if a new agent was created
+func (s *MemoryStore) RegisterAgent(ctx context.Context, Registration models.Registration, Options EnrollmentOptions) (models.Agent, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Agent{}, false, err
+	}
+
+	if !Options.validToken(Registration.Token) {
+		return models.Agent{}, false, ErrInvalidToken
+	}
+
+	if err := Registration.Validate(); err != nil {
+		return models.Agent{}, false, err
+	}
+
+	os, err := models.AgentosFromString(Registration.OS)
+	if err != nil {
+		return models.Agent{}, false, err
+	}
+
+	agent := Options.newAgent(Registration, os)
+	if err := agent.Validate(); err != nil {
+		return models.Agent{}, false, err
+	}
+
+	registered, created, metadataChanged, err := s.registerAgent(agent)
+	if err != nil {
+		return models.Agent{}, false, err
+	}
+
+	if Options.AutoRegistration && (created || metadataChanged) {
+		applied, err := s.ApplyAutoRegistration(ctx, registered.ID)
+		if err != nil {
+			return registered, created, err
+		}
+		registered.TemplateIDs = applied.Agent.TemplateIDs
+		registered.Tags = applied.Agent.Tags
+		registered.ScrapeInterval = applied.Agent.ScrapeInterval
+	}
+
+	return registered, created, nil
+}
+
+func (s *MemoryStore) registerAgent(Agent models.Agent) (models.Agent, bool, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, k := range s.agents {
+		if k.AgentUUID != Agent.AgentUUID {
+			continue
+		}
+
+		if k.Lifecycle() == models.LifecycleDeleted {
+			return models.Agent{}, false, false, ErrAgentDeleted
+		}
+
+		metadataChanged := !equalMetadata(k.Metadata, Agent.Metadata)
+		k.OS = Agent.OS
+		k.Endpoint = Agent.Endpoint
+		k.Metadata = Agent.Metadata
+		k.LastSeen = Agent.LastSeen
+		s.agents[id] = cloneAgent(k)
+
+		return cloneAgent(k), false, metadataChanged, nil
+	}
+
+	s.agents[Agent.ID] = cloneAgent(Agent)
+
+	return Agent, true, false, nil
+}
+
+//ApproveAgent approves a pending agent, so it becomes active and is scraped
+func (s *MemoryStore) ApproveAgent(ctx context.Context, ID primitive.ObjectID) error {
+	return s.transitionAgent(ctx, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		if Agent.Lifecycle() != models.LifecyclePending {
+			return models.LifecycleTransition{}, ErrNotFound
+		}
+
+		return Agent.TransitionTo(models.LifecycleActive, "", time.Now())
+	})
+}
+
+//GetAllAutoRegistrationRules returns all stored auto registration rules ordered by their priority
+func (s *MemoryStore) GetAllAutoRegistrationRules(ctx context.Context) ([]models.AutoRegistrationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rules := make([]models.AutoRegistrationRule, 0, len(s.autoRegistrationRules))
+	for _, k := range s.autoRegistrationRules {
+		rules = append(rules, k)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return lessObjectID(rules[i].ID, rules[j].ID)
+	})
+
+	return rules, nil
+}
+
+//CreateAutoRegistrationRule validates and persists a new auto registration rule
+func (s *MemoryStore) CreateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) (models.AutoRegistrationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return models.AutoRegistrationRule{}, err
+	}
+
+	if err := Rule.Validate(); err != nil {
+		return models.AutoRegistrationRule{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, k := range s.autoRegistrationRules {
+		if k.Name == Rule.Name {
+			return models.AutoRegistrationRule{}, ErrNameInUse
+		}
+	}
+
+	Rule.ID = primitive.NewObjectID()
+	s.autoRegistrationRules[Rule.ID] = Rule
+
+	return Rule, nil
+}
+
+//UpdateAutoRegistrationRule validates and persists the changes of an existing auto registration rule
+func (s *MemoryStore) UpdateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := Rule.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.autoRegistrationRules[Rule.ID]; !found {
+		return ErrNotFound
+	}
+	for _, k := range s.autoRegistrationRules {
+		if k.Name == Rule.Name && k.ID != Rule.ID {
+			return ErrNameInUse
+		}
+	}
+	s.autoRegistrationRules[Rule.ID] = Rule
+
+	return nil
+}
+
+//DeleteAutoRegistrationRule removes the specified auto registration rule
+func (s *MemoryStore) DeleteAutoRegistrationRule(ctx context.Context, ID primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.autoRegistrationRules[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.autoRegistrationRules, ID)
+
+	return nil
+}
+
+//DryRunAutoRegistration returns which rules match the agent and how they would change it without persisting anything
+func (s *MemoryStore) DryRunAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	agent, err := s.GetAgent(ctx, AgentID)
+	if err != nil {
+		return models.AutoRegistrationResult{}, err
+	}
+
+	rules, err := s.GetAllAutoRegistrationRules(ctx)
+	if err != nil {
+		return models.AutoRegistrationResult{}, err
+	}
+
+	return models.ApplyAutoRegistrationRules(rules, agent), nil
+}
+
+//ApplyAutoRegistration applies all matching auto registration rules to the agent
+func (s *MemoryStore) ApplyAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	result, err := s.DryRunAutoRegistration(ctx, AgentID)
+	if err != nil || !result.Changed() {
+		return result, err
+	}
+
+	s.mutex.Lock()
+	agent, found := s.agents[AgentID]
+	if !found {
+		s.mutex.Unlock()
+		return result, ErrNotFound
+	}
+
+	for _, k := range result.AddedTemplateIDs {
+		if !containsObjectID(agent.TemplateIDs, k) {
+			agent.TemplateIDs = append(agent.TemplateIDs, k)
+		}
+	}
+	for _, k := range result.AddedTags {
+		if !agent.HasTag(k) {
+			agent.Tags = append(agent.Tags, k)
+		}
+	}
+	if result.ScrapeInterval > 0 {
+		agent.ScrapeInterval = result.ScrapeInterval
+	}
+	s.agents[AgentID] = agent
+	s.mutex.Unlock()
+
+	if len(result.AddedTemplateIDs) > 0 {
+		if _, err := s.ReconcileTriggerAssignments(ctx, AgentID); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+//HeartbeatMember registers the member or refreshes its heartbeat, so it's regarded alive for TTL
+func (s *MemoryStore) HeartbeatMember(ctx context.Context, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ClusterMember{}, err
+	}
+
+	if Member.ID == uuid.Nil {
+		return models.ClusterMember{}, errors.New("member id can't be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	member, found := s.members[Member.ID]
+	if !found {
+		member = models.ClusterMember{ID: Member.ID, Started: now}
+	}
+	member.Hostname = Member.Hostname
+	member.Heartbeat = now
+	member.Expires = now.Add(TTL)
+	s.members[Member.ID] = member
+
+	return member, nil
+}
+
+//RemoveMember removes the member from the cluster
+func (s *MemoryStore) RemoveMember(ctx context.Context, ID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.members[ID]; !found {
+		return ErrNotFound
+	}
+	delete(s.members, ID)
+
+	return nil
+}
+
+//GetLiveMembers returns all members whose heartbeat didn't expire at the specified time
+func (s *MemoryStore) GetLiveMembers(ctx context.Context, At time.Time) ([]models.ClusterMember, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	members := make([]models.ClusterMember, 0)
+	for _, k := range s.members {
+		if k.Alive(At) {
+			members = append(members, k)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i].ID[:], members[j].ID[:]) < 0 })
+
+	return members, nil
+}
+
+//PruneMembers removes all members whose heartbeat expired before the specified time
+func (s *MemoryStore) PruneMembers(ctx context.Context, Before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var removed int64
+	for id, k := range s.members {
+		if !k.Expires.After(Before) {
+			delete(s.members, id)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+//AcquireLeadership makes the member the leader of the election if there is no leader or the leadership expired
+func (s *MemoryStore) AcquireLeadership(ctx context.Context, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Leadership{}, err
+	}
+
+	if Member == uuid.Nil {
+		return models.Leadership{}, errors.New("member id can't be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	leadership := s.leaderships[Name]
+	if !leadership.Free(now) && leadership.Leader != Member {
+		return models.Leadership{}, ErrLeadershipHeld
+	}
+
+	leadership = models.Leadership{Name: Name, Leader: Member, Acquired: now, Expires: now.Add(Duration), Term: leadership.Term + 1}
+	s.leaderships[Name] = leadership
+
+	return leadership, nil
+}
+
+//RenewLeadership extends the leadership of the leader by Duration
+func (s *MemoryStore) RenewLeadership(ctx context.Context, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Leadership{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	leadership, found := s.leaderships[Leadership.Name]
+	if !found || leadership.Leader != Leadership.Leader || leadership.Term != Leadership.Term {
+		return models.Leadership{}, ErrLeadershipLost
+	}
+
+	leadership.Expires = time.Now().Add(Duration)
+	s.leaderships[Leadership.Name] = leadership
+
+	return leadership, nil
+}
+
+//ResignLeadership gives up the leadership, so another member can take over right away
+func (s *MemoryStore) ResignLeadership(ctx context.Context, Leadership models.Leadership) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	leadership, found := s.leaderships[Leadership.Name]
+	if !found || leadership.Leader != Leadership.Leader || leadership.Term != Leadership.Term {
+		return ErrLeadershipLost
+	}
+
+	leadership.Leader = uuid.Nil
+	leadership.Expires = time.Time{}
+	s.leaderships[Leadership.Name] = leadership
+
+	return nil
+}
+
+//onlyObjectID returns true if the slice only contains the ID
+func onlyObjectID(Slice []primitive.ObjectID, ID primitive.ObjectID) bool {
+	return len(Slice) == 1 && Slice[0] == ID
+}
+
+func removeObjectID(Slice []primitive.ObjectID, ID primitive.ObjectID) []primitive.ObjectID {
+	if Slice == nil {
+		return nil
+	}
+
+	cleaned := make([]primitive.ObjectID, 0, len(Slice))
+	for _, k := range Slice {
+		if k != ID {
+			cleaned = append(cleaned, k)
+		}
+	}
+
+	return cleaned
+}
+
+func containsObjectID(Slice []primitive.ObjectID, ID primitive.ObjectID) bool {
+	for _, k := range Slice {
+		if k == ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lessObjectID(A, B primitive.ObjectID) bool {
+	return bytes.Compare(A[:], B[:]) < 0
+}
+
+//The sorted* helpers return the map values ordered by ID, which mimics the natural order of MongoDB for ObjectIDs
+func sortedAgents(Map map[primitive.ObjectID]models.Agent) []models.Agent {
+	values := make([]models.Agent, 0, len(Map))
+	for _, k := range Map {
+		values = append(values, k)
+	}
+	sort.Slice(values, func(i, j int) bool { return lessObjectID(values[i].ID, values[j].ID) })
+
+	return values
+}
+
+func sortedTemplates(Map map[primitive.ObjectID]models.Template) []models.Template {
+	values := make([]models.Template, 0, len(Map))
+	for _, k := range Map {
+		values = append(values, k)
+	}
+	sort.Slice(values, func(i, j int) bool { return lessObjectID(values[i].ID, values[j].ID) })
+
+	return values
+}
+
+func sortedItems(Map map[primitive.ObjectID]models.Item) []models.Item {
+	values := make([]models.Item, 0, len(Map))
+	for _, k := range Map {
+		values = append(values, k)
+	}
+	sort.Slice(values, func(i, j int) bool { return lessObjectID(values[i].ID, values[j].ID) })
+
+	return values
+}
+
+func sortedTriggers(Map map[primitive.ObjectID]models.Trigger) []models.Trigger {
+	values := make([]models.Trigger, 0, len(Map))
+	for _, k := range Map {
+		values = append(values, k)
+	}
+	sort.Slice(values, func(i, j int) bool { return lessObjectID(values[i].ID, values[j].ID) })
+
+	return values
+}
+
+func cloneObjectIDs(Slice []primitive.ObjectID) []primitive.ObjectID {
+	if Slice == nil {
+		return nil
+	}
+
+	return append(make([]primitive.ObjectID, 0, len(Slice)), Slice...)
+}
+
+func cloneAgent(Agent models.Agent) models.Agent {
+	Agent.TemplateIDs = cloneObjectIDs(Agent.TemplateIDs)
+	if Agent.Tags != nil {
+		Agent.Tags = append(make([]string, 0, len(Agent.Tags)), Agent.Tags...)
+	}
+	Agent.ItemSchedules = cloneItemSchedules(Agent.ItemSchedules)
+	if Agent.LifecycleTransitions != nil {
+		Agent.LifecycleTransitions = append(make([]models.LifecycleTransition, 0, len(Agent.LifecycleTransitions)), Agent.LifecycleTransitions...)
+	}
+	Agent.Metadata = cloneStringMap(Agent.Metadata)
+	Agent.Macros = cloneStringMap(Agent.Macros)
+	if Agent.TriggerMappings != nil {
+		mappings := make([]models.TriggerAssignment, len(Agent.TriggerMappings))
+		for i, k := range Agent.TriggerMappings {
+			if k.History != nil {
+				k.History = append(make([]models.TriggerHistoryEntry, 0, len(k.History)), k.History...)
+			}
+			if k.Acknowledgements != nil {
+				k.Acknowledgements = append(make([]models.Acknowledgement, 0, len(k.Acknowledgements)), k.Acknowledgements...)
+			}
+			if k.SeverityOverride != nil {
+				severity := *k.SeverityOverride
+				k.SeverityOverride = &severity
+			}
+			mappings[i] = k
+		}
+		Agent.TriggerMappings = mappings
+	}
+
+	return Agent
+}
+
+func cloneStringMap(Map map[string]string) map[string]string {
+	if Map == nil {
+		return nil
+	}
+
+	clone := make(map[string]string, len(Map))
+	for k, v := range Map {
+		clone[k] = v
+	}
+
+	return clone
+}
+
+func cloneItemSchedules(Slice []models.ItemSchedule) []models.ItemSchedule {
+	if Slice == nil {
+		return nil
+	}
+
+	schedules := make([]models.ItemSchedule, len(Slice))
+	for i, k := range Slice {
+		k.Schedule = cloneSchedule(k.Schedule)
+		schedules[i] = k
+	}
+
+	return schedules
+}
+
+func cloneSchedule(Schedule models.Schedule) models.Schedule {
+	if Schedule.Overrides != nil {
+		overrides := make([]models.IntervalOverride, len(Schedule.Overrides))
+		for i, k := range Schedule.Overrides {
+			if k.Weekdays != nil {
+				k.Weekdays = append(make([]time.Weekday, 0, len(k.Weekdays)), k.Weekdays...)
+			}
+			overrides[i] = k
+		}
+		Schedule.Overrides = overrides
+	}
+
+	return Schedule
+}
+
+func cloneItem(Item models.Item) models.Item {
+	Item.IntervalOverrides = cloneSchedule(Item.Schedule()).Overrides
+
+	return Item
+}
+
+func cloneTemplate(Template models.Template) models.Template {
+	Template.ItemIDs = cloneObjectIDs(Template.ItemIDs)
+	Template.TriggerIDs = cloneObjectIDs(Template.TriggerIDs)
+	Template.Macros = cloneStringMap(Template.Macros)
+
+	return Template
+}
+
+func cloneTrigger(Trigger models.Trigger) models.Trigger {
+	Trigger.DependsOn = cloneObjectIDs(Trigger.DependsOn)
+
+	return Trigger
+}
+
+func cloneMaintenance(Maintenance models.Maintenance) models.Maintenance {
+	Maintenance.Scope.AgentIDs = cloneObjectIDs(Maintenance.Scope.AgentIDs)
+	Maintenance.Scope.TemplateIDs = cloneObjectIDs(Maintenance.Scope.TemplateIDs)
+	if Maintenance.Scope.Tags != nil {
+		Maintenance.Scope.Tags = append(make([]string, 0, len(Maintenance.Scope.Tags)), Maintenance.Scope.Tags...)
+	}
+	if Maintenance.Recurrence.Weekdays != nil {
+		Maintenance.Recurrence.Weekdays = append(make([]time.Weekday, 0, len(Maintenance.Recurrence.Weekdays)), Maintenance.Recurrence.Weekdays...)
+	}
+	if Maintenance.Recurrence.DaysOfMonth != nil {
+		Maintenance.Recurrence.DaysOfMonth = append(make([]int, 0, len(Maintenance.Recurrence.DaysOfMonth)), Maintenance.Recurrence.DaysOfMonth...)
+	}
+
+	return Maintenance
+}
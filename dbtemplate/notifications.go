@@ -0,0 +1,256 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/FlowKeeper/FlowUtils/v2/templating"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//DeliveryFilter specifies which deliveries should be returned by GetDeliveries
+//Empty fields aren't used for filtering
+type DeliveryFilter struct {
+	EventIDs   []primitive.ObjectID
+	AgentIDs   []primitive.ObjectID
+	TriggerIDs []primitive.ObjectID
+	Statuses   []models.DeliveryStatus
+	From, To   time.Time //Both inclusive, compared with the creation time
+	Limit      int
+}
+
+func (f DeliveryFilter) bson() bson.M {
+	filter := bson.M{}
+	if len(f.EventIDs) > 0 {
+		filter["eventid"] = bson.M{"$in": f.EventIDs}
+	}
+	if len(f.AgentIDs) > 0 {
+		filter["agentid"] = bson.M{"$in": f.AgentIDs}
+	}
+	if len(f.TriggerIDs) > 0 {
+		filter["triggerid"] = bson.M{"$in": f.TriggerIDs}
+	}
+	if len(f.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": f.Statuses}
+	}
+
+	timeFilter := bson.M{}
+	if !f.From.IsZero() {
+		timeFilter["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		timeFilter["$lte"] = f.To
+	}
+	if len(timeFilter) > 0 {
+		filter["created"] = timeFilter
+	}
+
+	return filter
+}
+
+func (f DeliveryFilter) matches(Delivery models.Delivery) bool {
+	if len(f.EventIDs) > 0 && !containsObjectID(f.EventIDs, Delivery.EventID) {
+		return false
+	}
+	if len(f.AgentIDs) > 0 && !containsObjectID(f.AgentIDs, Delivery.AgentID) {
+		return false
+	}
+	if len(f.TriggerIDs) > 0 && !containsObjectID(f.TriggerIDs, Delivery.TriggerID) {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, k := range f.Statuses {
+			if k == Delivery.Status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.From.IsZero() && Delivery.Created.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && Delivery.Created.After(f.To) {
+		return false
+	}
+
+	return true
+}
+
+//GetAllNotificationRules returns all notification rules from the database
+func GetAllNotificationRules(Client *mongo.Database) ([]models.NotificationRule, error) {
+	return GetAllNotificationRulesContext(context.Background(), Client)
+}
+
+//GetAllNotificationRulesContext returns all notification rules from the database
+func GetAllNotificationRulesContext(ctx context.Context, Client *mongo.Database) ([]models.NotificationRule, error) {
+	rules := make([]models.NotificationRule, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("notificationrules").Find(ctx, bson.M{})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read notification rules:", err)
+		return rules, err
+	}
+
+	if err := cursor.All(ctx, &rules); err != nil {
+		logger.Error(loggingArea, "Couldn't decode notification rules:", err)
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+//CreateNotificationRule validates and persists a new notification rule
+//The returned rule contains the generated ID
+func CreateNotificationRule(Client *mongo.Database, Rule models.NotificationRule) (models.NotificationRule, error) {
+	return CreateNotificationRuleContext(context.Background(), Client, Rule)
+}
+
+//CreateNotificationRuleContext validates and persists a new notification rule
+//The returned rule contains the generated ID
+func CreateNotificationRuleContext(ctx context.Context, Client *mongo.Database, Rule models.NotificationRule) (models.NotificationRule, error) {
+	if err := validateNotificationRule(Rule); err != nil {
+		return models.NotificationRule{}, err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("notificationrules"), Rule.Name, primitive.NilObjectID); err != nil {
+		return models.NotificationRule{}, err
+	}
+
+	Rule.ID = primitive.NewObjectID()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("notificationrules").InsertOne(ctx, Rule); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.NotificationRule{}, ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't insert notification rule:", err)
+		return models.NotificationRule{}, err
+	}
+
+	return Rule, nil
+}
+
+//UpdateNotificationRule validates and persists the changes of an existing notification rule
+func UpdateNotificationRule(Client *mongo.Database, Rule models.NotificationRule) error {
+	return UpdateNotificationRuleContext(context.Background(), Client, Rule)
+}
+
+//UpdateNotificationRuleContext validates and persists the changes of an existing notification rule
+func UpdateNotificationRuleContext(ctx context.Context, Client *mongo.Database, Rule models.NotificationRule) error {
+	if err := validateNotificationRule(Rule); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("notificationrules"), Rule.Name, Rule.ID); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("notificationrules"), Rule.ID, Rule)
+}
+
+//DeleteNotificationRule removes the specified notification rule
+func DeleteNotificationRule(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteNotificationRuleContext(context.Background(), Client, ID)
+}
+
+//DeleteNotificationRuleContext removes the specified notification rule
+func DeleteNotificationRuleContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return deleteDocument(ctx, Client.Collection("notificationrules"), ID)
+}
+
+//validateNotificationRule checks the rule as well as its message templates
+func validateNotificationRule(Rule models.NotificationRule) error {
+	if err := Rule.Validate(); err != nil {
+		return err
+	}
+
+	for _, k := range []models.MessageTemplate{Rule.ProblemTemplate, Rule.RecoveryTemplate} {
+		if k.IsEmpty() {
+			continue
+		}
+		if err := templating.Validate(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//InsertDelivery persists a new entry of the delivery log
+func InsertDelivery(Client *mongo.Database, Delivery models.Delivery) (models.Delivery, error) {
+	return InsertDeliveryContext(context.Background(), Client, Delivery)
+}
+
+//InsertDeliveryContext persists a new entry of the delivery log
+func InsertDeliveryContext(ctx context.Context, Client *mongo.Database, Delivery models.Delivery) (models.Delivery, error) {
+	Delivery.ID = primitive.NewObjectID()
+	if Delivery.Created.IsZero() {
+		Delivery.Created = time.Now()
+	}
+	Delivery.Updated = Delivery.Created
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("deliveries").InsertOne(ctx, Delivery); err != nil {
+		logger.Error(loggingArea, "Couldn't insert delivery:", err)
+		return models.Delivery{}, err
+	}
+
+	return Delivery, nil
+}
+
+//UpdateDelivery persists the status of an existing entry of the delivery log
+func UpdateDelivery(Client *mongo.Database, Delivery models.Delivery) error {
+	return UpdateDeliveryContext(context.Background(), Client, Delivery)
+}
+
+//UpdateDeliveryContext persists the status of an existing entry of the delivery log
+func UpdateDeliveryContext(ctx context.Context, Client *mongo.Database, Delivery models.Delivery) error {
+	Delivery.Updated = time.Now()
+	return replaceDocument(ctx, Client.Collection("deliveries"), Delivery.ID, Delivery)
+}
+
+//GetDeliveries returns all deliveries matching the filter ordered newest-first
+func GetDeliveries(Client *mongo.Database, Filter DeliveryFilter) ([]models.Delivery, error) {
+	return GetDeliveriesContext(context.Background(), Client, Filter)
+}
+
+//GetDeliveriesContext returns all deliveries matching the filter ordered newest-first
+func GetDeliveriesContext(ctx context.Context, Client *mongo.Database, Filter DeliveryFilter) ([]models.Delivery, error) {
+	deliveries := make([]models.Delivery, 0)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created", Value: -1}})
+	if Filter.Limit > 0 {
+		findOptions.SetLimit(int64(Filter.Limit))
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("deliveries").Find(ctx, Filter.bson(), findOptions)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read deliveries:", err)
+		return deliveries, err
+	}
+
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		logger.Error(loggingArea, "Couldn't decode deliveries:", err)
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
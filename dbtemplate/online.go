@@ -0,0 +1,71 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//SetAgentState atomically sets the online state of the agent
+//A trigger event for models.UnreachableTriggerID is stored if the state actually changed, so the state history can be queried like the one of triggers
+//The returned bool is true if this call changed the state, so notifications can be sent exactly once even if multiple instances run the online detection
+//LastSeen is the time the caller saw the agent last, the agent is only marked offline if it wasn't seen after it in the meantime
+func SetAgentState(Client *mongo.Database, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error) {
+	return SetAgentStateContext(context.Background(), Client, AgentID, State, LastSeen, At, Error)
+}
+
+//SetAgentStateContext atomically sets the online state of the agent
+//A trigger event for models.UnreachableTriggerID is stored if the state actually changed, so the state history can be queried like the one of triggers
+//The returned bool is true if this call changed the state, so notifications can be sent exactly once even if multiple instances run the online detection
+//LastSeen is the time the caller saw the agent last, the agent is only marked offline if it wasn't seen after it in the meantime
+func SetAgentStateContext(ctx context.Context, Client *mongo.Database, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error) {
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	//Only matches if the state differs, so only one concurrent caller can win the transition
+	//Agents without state are regarded as online, they don't get a recovery event
+	match := bson.M{"$ne": State}
+	if State == models.Online {
+		match["$exists"] = true
+	}
+
+	filter := bson.M{"_id": AgentID, "state": match}
+	if State == models.Offline {
+		//A scrape after the caller read the agent proves it's online again
+		filter["lastseen"] = bson.M{"$lte": LastSeen}
+	}
+
+	result, err := Client.Collection("agents").UpdateOne(updateCtx, filter, bson.M{"$set": bson.M{
+		"state":        State,
+		"statechanged": At,
+	}})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't update agent state:", err)
+		return false, err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := Client.Collection("agents").CountDocuments(updateCtx, bson.M{"_id": AgentID})
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't check if agent exists:", err)
+			return false, err
+		}
+		if count == 0 {
+			return false, ErrNotFound
+		}
+
+		return false, nil
+	}
+
+	//The transition already happened, so the caller has to be told even if the event couldn't be stored
+	if _, err := InsertTriggerEventContext(ctx, Client, models.NewStateEvent(AgentID, State, At, Error)); err != nil {
+		logger.Error(loggingArea, "Couldn't store state event of agent", AgentID.Hex(), ":", err)
+	}
+	return true, nil
+}
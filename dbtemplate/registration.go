@@ -0,0 +1,214 @@
+package dbtemplate
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//ErrInvalidToken is returned if an agent tries to register with an unknown enrollment token
+var ErrInvalidToken = errors.New("invalid enrollment token")
+
+//ErrAgentDeleted is returned if a deleted agent tries to register again
+var ErrAgentDeleted = errors.New("agent was deleted")
+
+//EnrollmentOptions defines how agents are enrolled via RegisterAgent
+type EnrollmentOptions struct {
+	//Tokens contains all accepted pre-shared enrollment tokens, registration is disabled if it's empty
+	Tokens []string
+	//RequireApproval marks new agents as pending, they aren't scraped until they are approved via ApproveAgent
+	RequireApproval bool
+	//ScrapeInterval is used for new agents (in seconds)
+	ScrapeInterval int
+	//AutoRegistration applies the auto registration rules to new agents and agents whose metadata changed
+	AutoRegistration bool
+}
+
+//DefaultScrapeInterval is used for registered agents if EnrollmentOptions.ScrapeInterval isn't set
+var DefaultScrapeInterval = 60
+
+//validToken compares the token with all accepted tokens in constant time
+func (o EnrollmentOptions) validToken(Token string) bool {
+	valid := false
+	for _, k := range o.Tokens {
+		if k != "" && subtle.ConstantTimeCompare([]byte(k), []byte(Token)) == 1 {
+			valid = true
+		}
+	}
+
+	return valid
+}
+
+//newAgent returns the agent created for a new registration
+func (o EnrollmentOptions) newAgent(Registration models.Registration, OS models.AgentOS) models.Agent {
+	agent := models.Agent{
+		ID:              primitive.NewObjectID(),
+		Name:            Registration.Hostname,
+		AgentUUID:       Registration.UUID,
+		Enabled:         !o.RequireApproval,
+		Pending:         o.RequireApproval,
+		LastSeen:        time.Now(),
+		OS:              OS,
+		TemplateIDs:     make([]primitive.ObjectID, 0),
+		TriggerMappings: make([]models.TriggerAssignment, 0),
+		Endpoint:        Registration.Endpoint,
+		ScrapeInterval:  o.ScrapeInterval,
+		Tags:            make([]string, 0),
+		Metadata:        Registration.Metadata,
+	}
+	if agent.ScrapeInterval <= 0 {
+		agent.ScrapeInterval = DefaultScrapeInterval
+	}
+	if agent.Metadata == nil {
+		agent.Metadata = make(map[string]string)
+	}
+
+	return initLifecycle(agent)
+}
+
+//RegisterAgent creates a new agent or updates the existing agent with the same uuid
+//The registration is idempotent: Existing agents only get their os, endpoint and metadata updated, the name and configuration set by operators are kept
+//The returned bool is true if a new agent was created, the returned agent isn't populated
+func RegisterAgent(Client *mongo.Database, Registration models.Registration, Options EnrollmentOptions) (models.Agent, bool, error) {
+	return RegisterAgentContext(context.Background(), Client, Registration, Options)
+}
+
+//RegisterAgentContext creates a new agent or updates the existing agent with the same uuid
+//The registration is idempotent: Existing agents only get their os, endpoint and metadata updated, the name and configuration set by operators are kept
+//The returned bool is true if a new agent was created, the returned agent isn't populated
+func RegisterAgentContext(ctx context.Context, Client *mongo.Database, Registration models.Registration, Options EnrollmentOptions) (models.Agent, bool, error) {
+	if !Options.validToken(Registration.Token) {
+		return models.Agent{}, false, ErrInvalidToken
+	}
+
+	if err := Registration.Validate(); err != nil {
+		return models.Agent{}, false, err
+	}
+
+	os, err := models.AgentosFromString(Registration.OS)
+	if err != nil {
+		return models.Agent{}, false, err
+	}
+
+	agent := Options.newAgent(Registration, os)
+	if err := agent.Validate(); err != nil {
+		return models.Agent{}, false, err
+	}
+
+	updateCtx, cancel := withDefaultTimeout(ctx, AgentTimeout)
+	defer cancel()
+
+	//Deleted agents are excluded, so the upsert fails with a duplicate key error instead of reviving them
+	filter := bson.M{"agentuuid": Registration.UUID, "deleted": bson.M{"$ne": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"os":       agent.OS,
+			"endpoint": agent.Endpoint,
+			"metadata": agent.Metadata,
+			"lastseen": agent.LastSeen,
+		},
+		"$setOnInsert": bson.M{
+			"_id":                  agent.ID,
+			"name":                 agent.Name,
+			"description":          agent.Description,
+			"agentuuid":            agent.AgentUUID,
+			"enabled":              agent.Enabled,
+			"deleted":              false,
+			"pending":              agent.Pending,
+			"lifecyclestate":       agent.LifecycleState,
+			"lifecyclechanged":     agent.LifecycleChanged,
+			"lifecycletransitions": agent.LifecycleTransitions,
+			"state":                agent.State,
+			"templateids":          agent.TemplateIDs,
+			"triggermappings":      agent.TriggerMappings,
+			"scrapeinterval":       agent.ScrapeInterval,
+			"tags":                 agent.Tags,
+		},
+	}
+
+	//The document before the update is returned, so changed metadata can be detected
+	result := Client.Collection("agents").FindOneAndUpdate(updateCtx, filter, update, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before))
+	if mongo.IsDuplicateKeyError(result.Err()) {
+		//Either the agent was deleted or a concurrent registration of the same agent won the insert
+		//Retrying without upsert updates the agent in the second case
+		result = Client.Collection("agents").FindOneAndUpdate(updateCtx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.Before))
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return models.Agent{}, false, ErrAgentDeleted
+		}
+	}
+
+	created, metadataChanged := false, false
+	registered := agent
+
+	if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+		//There was no agent before the upsert
+		created = true
+	} else if result.Err() != nil {
+		logger.Error(loggingArea, "Couldn't register agent:", result.Err())
+		return models.Agent{}, false, result.Err()
+	} else {
+		if err := result.Decode(&registered); err != nil {
+			logger.Error(loggingArea, "Couldn't decode registered agent:", err)
+			return models.Agent{}, false, err
+		}
+
+		metadataChanged = !equalMetadata(registered.Metadata, agent.Metadata)
+		registered.OS = agent.OS
+		registered.Endpoint = agent.Endpoint
+		registered.Metadata = agent.Metadata
+		registered.LastSeen = agent.LastSeen
+	}
+
+	if Options.AutoRegistration && (created || metadataChanged) {
+		applied, err := ApplyAutoRegistrationContext(ctx, Client, registered.ID)
+		if err != nil {
+			return registered, created, err
+		}
+		registered.TemplateIDs = applied.Agent.TemplateIDs
+		registered.Tags = applied.Agent.Tags
+		registered.ScrapeInterval = applied.Agent.ScrapeInterval
+	}
+
+	return registered, created, nil
+}
+
+//equalMetadata returns true if both maps contain the same key/value pairs
+func equalMetadata(A map[string]string, B map[string]string) bool {
+	if len(A) != len(B) {
+		return false
+	}
+
+	for k, v := range A {
+		if value, found := B[k]; !found || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+//ApproveAgent approves a pending agent, so it becomes active and is scraped
+//ErrNotFound is returned if there is no pending agent with the ID
+func ApproveAgent(Client *mongo.Database, ID primitive.ObjectID) error {
+	return ApproveAgentContext(context.Background(), Client, ID)
+}
+
+//ApproveAgentContext approves a pending agent, so it becomes active and is scraped
+//ErrNotFound is returned if there is no pending agent with the ID
+func ApproveAgentContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return transitionAgent(ctx, Client, ID, func(Agent models.Agent) (models.LifecycleTransition, error) {
+		if Agent.Lifecycle() != models.LifecyclePending {
+			return models.LifecycleTransition{}, ErrNotFound
+		}
+
+		return Agent.TransitionTo(models.LifecycleActive, "", time.Now())
+	})
+}
@@ -0,0 +1,220 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//InsertResult validates and persists a single result
+//If CapturedAt isn't set, the current time is used
+func InsertResult(Client *mongo.Database, Result models.Result) (models.Result, error) {
+	return InsertResultContext(context.Background(), Client, Result)
+}
+
+//InsertResultContext validates and persists a single result
+//If CapturedAt isn't set, the current time is used
+func InsertResultContext(ctx context.Context, Client *mongo.Database, Result models.Result) (models.Result, error) {
+	results, err := InsertResultsContext(ctx, Client, []models.Result{Result})
+	if err != nil {
+		return models.Result{}, err
+	}
+
+	return results[0], nil
+}
+
+//InsertResults validates and persists multiple results with a single database call
+//The returned slice contains the results with their generated IDs
+func InsertResults(Client *mongo.Database, Results []models.Result) ([]models.Result, error) {
+	return InsertResultsContext(context.Background(), Client, Results)
+}
+
+//InsertResultsContext validates and persists multiple results with a single database call
+//The returned slice contains the results with their generated IDs
+func InsertResultsContext(ctx context.Context, Client *mongo.Database, Results []models.Result) ([]models.Result, error) {
+	return insertResults(ctx, Client, Results, 0)
+}
+
+//insertResults persists the results with the fencing token, which is zero for results stored without a lease
+func insertResults(ctx context.Context, Client *mongo.Database, Results []models.Result, Token int64) ([]models.Result, error) {
+	if len(Results) == 0 {
+		return make([]models.Result, 0), nil
+	}
+
+	results, err := prepareResults(Results, Token)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]interface{}, len(results))
+	for i := range results {
+		documents[i] = results[i]
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("results").InsertMany(ctx, documents); err != nil {
+		logger.Error(loggingArea, "Couldn't insert results:", err)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+//GetLastResults returns the last N results of the item captured on the specified agent
+//If Limit is 0 all results are returned
+func GetLastResults(Client *mongo.Database, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error) {
+	return GetLastResultsContext(context.Background(), Client, ItemID, HostID, Limit)
+}
+
+//GetLastResultsContext returns the last N results of the item captured on the specified agent
+//If Limit is 0 all results are returned
+func GetLastResultsContext(ctx context.Context, Client *mongo.Database, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error) {
+	fresh, err := freshResults(ctx, Client, HostID)
+	if err != nil {
+		return models.ResultSet{}, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "capturedat", Value: -1}})
+	if Limit > 0 {
+		findOptions.SetLimit(int64(Limit))
+	}
+
+	return findResults(ctx, Client, bson.M{
+		"itemid": ItemID,
+		"hostid": HostID,
+		"$and":   []bson.M{fresh},
+	}, findOptions)
+}
+
+//GetResultsBetween returns all results of the item captured on the specified agent between From and To (both inclusive)
+func GetResultsBetween(Client *mongo.Database, ItemID primitive.ObjectID, HostID primitive.ObjectID, From time.Time, To time.Time) (models.ResultSet, error) {
+	return GetResultsBetweenContext(context.Background(), Client, ItemID, HostID, From, To)
+}
+
+//GetResultsBetweenContext returns all results of the item captured on the specified agent between From and To (both inclusive)
+func GetResultsBetweenContext(ctx context.Context, Client *mongo.Database, ItemID primitive.ObjectID, HostID primitive.ObjectID, From time.Time, To time.Time) (models.ResultSet, error) {
+	fresh, err := freshResults(ctx, Client, HostID)
+	if err != nil {
+		return models.ResultSet{}, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "capturedat", Value: -1}})
+
+	return findResults(ctx, Client, bson.M{
+		"itemid":     ItemID,
+		"hostid":     HostID,
+		"capturedat": bson.M{"$gte": From, "$lte": To},
+		"$and":       []bson.M{fresh},
+	}, findOptions)
+}
+
+//GetLatestResultPerItem returns the newest result of every item captured on the specified agent
+func GetLatestResultPerItem(Client *mongo.Database, HostID primitive.ObjectID) (models.ResultSet, error) {
+	return GetLatestResultPerItemContext(context.Background(), Client, HostID)
+}
+
+//GetLatestResultPerItemContext returns the newest result of every item captured on the specified agent
+func GetLatestResultPerItemContext(ctx context.Context, Client *mongo.Database, HostID primitive.ObjectID) (models.ResultSet, error) {
+	set := models.ResultSet{Results: make([]models.Result, 0)}
+
+	fresh, err := freshResults(ctx, Client, HostID)
+	if err != nil {
+		return set, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"hostid": HostID, "$and": []bson.M{fresh}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "capturedat", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$itemid", "result": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$result"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "capturedat", Value: -1}}}},
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("results").Aggregate(ctx, pipeline)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read latest results:", err)
+		return set, err
+	}
+
+	if err := cursor.All(ctx, &set.Results); err != nil {
+		logger.Error(loggingArea, "Couldn't decode results:", err)
+		return set, err
+	}
+
+	return set, nil
+}
+
+func findResults(ctx context.Context, Client *mongo.Database, Filter bson.M, Options *options.FindOptions) (models.ResultSet, error) {
+	set := models.ResultSet{Results: make([]models.Result, 0)}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("results").Find(ctx, Filter, Options)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read results:", err)
+		return set, err
+	}
+
+	if err := cursor.All(ctx, &set.Results); err != nil {
+		logger.Error(loggingArea, "Couldn't decode results:", err)
+		return set, err
+	}
+
+	return set, nil
+}
+
+//freshResults returns a filter, which excludes the stale results of the agent (see models.ScraperLease.Stale)
+func freshResults(ctx context.Context, Client *mongo.Database, HostID primitive.ObjectID) (bson.M, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	var agent models.Agent
+	err := Client.Collection("agents").FindOne(ctx, bson.M{"_id": HostID}, options.FindOne().SetProjection(bson.M{"scraper": 1})).Decode(&agent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		//Results of missing agents can't be stale, as there is no lease
+		return bson.M{}, nil
+	}
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read scraper lease:", err)
+		return nil, err
+	}
+
+	return bson.M{"$or": []bson.M{
+		{"fencingtoken": bson.M{"$in": bson.A{0, nil}}},
+		{"fencingtoken": bson.M{"$gte": agent.Scraper.Token}},
+		{"capturedat": bson.M{"$lt": agent.Scraper.Acquired}},
+	}}, nil
+}
+
+//prepareResults validates the results and fills in the ID, the fencing token and missing timestamps
+func prepareResults(Results []models.Result, Token int64) ([]models.Result, error) {
+	results := make([]models.Result, len(Results))
+	now := time.Now()
+
+	for i, k := range Results {
+		if err := k.Validate(); err != nil {
+			return nil, err
+		}
+
+		k.ID = primitive.NewObjectID()
+		k.FencingToken = Token
+		if k.CapturedAt.IsZero() {
+			k.CapturedAt = now
+		}
+		results[i] = k
+	}
+
+	return results, nil
+}
@@ -0,0 +1,149 @@
+package dbtemplate
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//GetAllSilences returns all silences from the database (including expired ones)
+func GetAllSilences(Client *mongo.Database) ([]models.Silence, error) {
+	return GetAllSilencesContext(context.Background(), Client)
+}
+
+//GetAllSilencesContext returns all silences from the database (including expired ones)
+func GetAllSilencesContext(ctx context.Context, Client *mongo.Database) ([]models.Silence, error) {
+	return findSilences(ctx, Client, bson.M{})
+}
+
+//GetActiveSilences returns all silences which are active at the specified time
+func GetActiveSilences(Client *mongo.Database, At time.Time) ([]models.Silence, error) {
+	return GetActiveSilencesContext(context.Background(), Client, At)
+}
+
+//GetActiveSilencesContext returns all silences which are active at the specified time
+func GetActiveSilencesContext(ctx context.Context, Client *mongo.Database, At time.Time) ([]models.Silence, error) {
+	return findSilences(ctx, Client, bson.M{
+		"start": bson.M{"$lte": At},
+		"end":   bson.M{"$gt": At},
+	})
+}
+
+//CreateSilence validates and persists a new silence
+//The returned silence contains the generated ID
+func CreateSilence(Client *mongo.Database, Silence models.Silence) (models.Silence, error) {
+	return CreateSilenceContext(context.Background(), Client, Silence)
+}
+
+//CreateSilenceContext validates and persists a new silence
+//The returned silence contains the generated ID
+func CreateSilenceContext(ctx context.Context, Client *mongo.Database, Silence models.Silence) (models.Silence, error) {
+	if err := Silence.Validate(); err != nil {
+		return models.Silence{}, err
+	}
+
+	Silence.ID = primitive.NewObjectID()
+	Silence.Created = time.Now()
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("silences").InsertOne(ctx, Silence); err != nil {
+		logger.Error(loggingArea, "Couldn't insert silence:", err)
+		return models.Silence{}, err
+	}
+
+	return Silence, nil
+}
+
+//UpdateSilence validates and persists the changes of an existing silence
+func UpdateSilence(Client *mongo.Database, Silence models.Silence) error {
+	return UpdateSilenceContext(context.Background(), Client, Silence)
+}
+
+//UpdateSilenceContext validates and persists the changes of an existing silence
+func UpdateSilenceContext(ctx context.Context, Client *mongo.Database, Silence models.Silence) error {
+	if err := Silence.Validate(); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("silences"), Silence.ID, Silence)
+}
+
+//ExpireSilence ends the silence immediately, the silence itself is kept for auditing
+//Silences which haven't started yet never muted anything, so they are deleted instead
+func ExpireSilence(Client *mongo.Database, ID primitive.ObjectID) error {
+	return ExpireSilenceContext(context.Background(), Client, ID)
+}
+
+//ExpireSilenceContext ends the silence immediately, the silence itself is kept for auditing
+//Silences which haven't started yet never muted anything, so they are deleted instead
+func ExpireSilenceContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	//A silence starting now would end when it starts, which isn't a valid silence either
+	now := time.Now()
+	deleted, err := Client.Collection("silences").DeleteOne(ctx, bson.M{"_id": ID, "start": bson.M{"$gte": now}})
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't delete silence:", err)
+		return err
+	}
+	if deleted.DeletedCount > 0 {
+		return nil
+	}
+
+	result, err := Client.Collection("silences").UpdateOne(ctx, bson.M{"_id": ID, "end": bson.M{"$gt": now}}, bson.M{"$set": bson.M{"end": now}})
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't expire silence:", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		//The silence is either missing or already expired
+		count, err := Client.Collection("silences").CountDocuments(ctx, bson.M{"_id": ID})
+		if err != nil {
+			logger.Error(loggingArea, "Couldn't read silence:", err)
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+//DeleteSilence removes the specified silence
+func DeleteSilence(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteSilenceContext(context.Background(), Client, ID)
+}
+
+//DeleteSilenceContext removes the specified silence
+func DeleteSilenceContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	return deleteDocument(ctx, Client.Collection("silences"), ID)
+}
+
+func findSilences(ctx context.Context, Client *mongo.Database, Filter bson.M) ([]models.Silence, error) {
+	silences := make([]models.Silence, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	cursor, err := Client.Collection("silences").Find(ctx, Filter)
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read silences:", err)
+		return silences, err
+	}
+
+	if err := cursor.All(ctx, &silences); err != nil {
+		logger.Error(loggingArea, "Couldn't decode silences:", err)
+		return silences, err
+	}
+
+	return silences, nil
+}
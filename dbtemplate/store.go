@@ -0,0 +1,636 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//ErrNotFound is returned by every Store implementation if the requested document doesn't exist
+//It is the same error as mongo.ErrNoDocuments, so existing errors.Is checks keep working
+var ErrNotFound = mongo.ErrNoDocuments
+
+//ErrNameInUse is returned if an item or trigger should be stored with a name which is already used by another document
+var ErrNameInUse = errors.New("name is already in use")
+
+//ErrAgentExists is returned if an agent should be created with an uuid which is already used by another agent
+var ErrAgentExists = errors.New("an agent with this uuid already exists")
+
+//ErrNoProblem is returned if a problem should be acknowledged / closed, but the trigger assignment isn't problematic
+var ErrNoProblem = errors.New("trigger assignment isn't problematic")
+
+//Store abstracts the storage of agents, templates, items, triggers and trigger assignments
+//MongoStore is backed by a MongoDB database, MemoryStore keeps everything in memory (e.g. for unit tests)
+type Store interface {
+	GetAgent(ctx context.Context, ID primitive.ObjectID) (models.Agent, error)
+	GetAgentByUUID(ctx context.Context, UUID uuid.UUID) (models.Agent, error)
+	GetAllAgents(ctx context.Context) ([]models.Agent, error)
+	CreateAgent(ctx context.Context, Agent models.Agent) (models.Agent, error)
+	UpdateAgent(ctx context.Context, Agent models.Agent) error
+	DeleteAgent(ctx context.Context, ID primitive.ObjectID) error
+
+	GetTemplates(ctx context.Context, IDs []primitive.ObjectID) ([]models.Template, error)
+	GetAllTemplates(ctx context.Context) ([]models.Template, error)
+	CreateTemplate(ctx context.Context, Template models.Template) (models.Template, error)
+	UpdateTemplate(ctx context.Context, Template models.Template) error
+	DeleteTemplate(ctx context.Context, ID primitive.ObjectID) error
+
+	GetItems(ctx context.Context, IDs []primitive.ObjectID) ([]models.Item, error)
+	GetItemByName(ctx context.Context, Name string) (models.Item, error)
+	CreateItem(ctx context.Context, Item models.Item) (models.Item, error)
+	UpdateItem(ctx context.Context, Item models.Item) error
+	DeleteItem(ctx context.Context, ID primitive.ObjectID) error
+
+	GetTrigger(ctx context.Context, ID primitive.ObjectID) (models.Trigger, error)
+	GetTriggerByName(ctx context.Context, Name string) (models.Trigger, error)
+	GetTriggers(ctx context.Context, IDs []primitive.ObjectID) ([]models.Trigger, error)
+	GetAllTriggers(ctx context.Context) ([]models.Trigger, error)
+	CreateTrigger(ctx context.Context, Trigger models.Trigger) (models.Trigger, error)
+	UpdateTrigger(ctx context.Context, Trigger models.Trigger) error
+	DeleteTrigger(ctx context.Context, ID primitive.ObjectID) error
+
+	AddTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID) error
+	ReconcileTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID) (ReconcileReport, error)
+	SetTriggerState(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error)
+
+	AcknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement) error
+	UnacknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error
+	CloseProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error
+}
+
+//ResultStore abstracts the storage of item results
+//All returned ResultSets are ordered newest-first
+type ResultStore interface {
+	InsertResult(ctx context.Context, Result models.Result) (models.Result, error)
+	InsertResults(ctx context.Context, Results []models.Result) ([]models.Result, error)
+	GetLastResults(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error)
+	GetResultsBetween(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, From time.Time, To time.Time) (models.ResultSet, error)
+	GetLatestResultPerItem(ctx context.Context, HostID primitive.ObjectID) (models.ResultSet, error)
+}
+
+//TriggerEventStore abstracts the storage of trigger events (state changes of trigger assignments)
+//All returned events are ordered newest-first
+type TriggerEventStore interface {
+	InsertTriggerEvent(ctx context.Context, Event models.TriggerEvent) (models.TriggerEvent, error)
+	GetTriggerEvents(ctx context.Context, Filter TriggerEventFilter) ([]models.TriggerEvent, error)
+	PruneTriggerEvents(ctx context.Context, Retention TriggerEventRetention) (int64, error)
+}
+
+//MaintenanceStore abstracts the storage of maintenances
+type MaintenanceStore interface {
+	GetMaintenance(ctx context.Context, ID primitive.ObjectID) (models.Maintenance, error)
+	GetAllMaintenances(ctx context.Context) ([]models.Maintenance, error)
+	GetActiveMaintenances(ctx context.Context, At time.Time) ([]models.Maintenance, error)
+	CreateMaintenance(ctx context.Context, Maintenance models.Maintenance) (models.Maintenance, error)
+	UpdateMaintenance(ctx context.Context, Maintenance models.Maintenance) error
+	DeleteMaintenance(ctx context.Context, ID primitive.ObjectID) error
+}
+
+//NotificationStore abstracts the storage of notification rules and the delivery log
+//All returned deliveries are ordered newest-first
+type NotificationStore interface {
+	GetAllNotificationRules(ctx context.Context) ([]models.NotificationRule, error)
+	CreateNotificationRule(ctx context.Context, Rule models.NotificationRule) (models.NotificationRule, error)
+	UpdateNotificationRule(ctx context.Context, Rule models.NotificationRule) error
+	DeleteNotificationRule(ctx context.Context, ID primitive.ObjectID) error
+
+	InsertDelivery(ctx context.Context, Delivery models.Delivery) (models.Delivery, error)
+	UpdateDelivery(ctx context.Context, Delivery models.Delivery) error
+	GetDeliveries(ctx context.Context, Filter DeliveryFilter) ([]models.Delivery, error)
+}
+
+//EscalationStore abstracts the storage of escalation policies
+type EscalationStore interface {
+	GetAllEscalationPolicies(ctx context.Context) ([]models.EscalationPolicy, error)
+	CreateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) (models.EscalationPolicy, error)
+	UpdateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) error
+	DeleteEscalationPolicy(ctx context.Context, ID primitive.ObjectID) error
+}
+
+//SilenceStore abstracts the storage of silences
+type SilenceStore interface {
+	GetAllSilences(ctx context.Context) ([]models.Silence, error)
+	GetActiveSilences(ctx context.Context, At time.Time) ([]models.Silence, error)
+	CreateSilence(ctx context.Context, Silence models.Silence) (models.Silence, error)
+	UpdateSilence(ctx context.Context, Silence models.Silence) error
+	ExpireSilence(ctx context.Context, ID primitive.ObjectID) error
+	DeleteSilence(ctx context.Context, ID primitive.ObjectID) error
+}
+
+//RegistrationStore abstracts the enrollment of agents
+type RegistrationStore interface {
+	RegisterAgent(ctx context.Context, Registration models.Registration, Options EnrollmentOptions) (models.Agent, bool, error)
+	ApproveAgent(ctx context.Context, ID primitive.ObjectID) error
+}
+
+//AutoRegistrationStore abstracts the storage and application of auto registration rules
+type AutoRegistrationStore interface {
+	GetAllAutoRegistrationRules(ctx context.Context) ([]models.AutoRegistrationRule, error)
+	CreateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) (models.AutoRegistrationRule, error)
+	UpdateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) error
+	DeleteAutoRegistrationRule(ctx context.Context, ID primitive.ObjectID) error
+	DryRunAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error)
+	ApplyAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error)
+}
+
+//LifecycleStore abstracts the lifecycle management of agents
+type LifecycleStore interface {
+	GetAgents(ctx context.Context, Filter AgentFilter) ([]models.Agent, error)
+	SetAgentLifecycle(ctx context.Context, ID primitive.ObjectID, State models.LifecycleState, User string) error
+	RestoreAgent(ctx context.Context, ID primitive.ObjectID, User string) error
+	PurgeAgent(ctx context.Context, ID primitive.ObjectID, GracePeriod time.Duration) error
+	PurgeDeletedAgents(ctx context.Context, GracePeriod time.Duration) ([]primitive.ObjectID, error)
+}
+
+//AgentStateStore abstracts the storage of the online state of agents
+type AgentStateStore interface {
+	SetAgentState(ctx context.Context, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error)
+}
+
+//LeaseStore abstracts the scraper leases of agents and the writes fenced by them
+type LeaseStore interface {
+	AcquireScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration) (models.ScraperLease, error)
+	StealScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Timeout time.Duration) (models.ScraperLease, error)
+	RenewScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease, Duration time.Duration) (models.ScraperLease, error)
+	ReleaseScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease) error
+
+	InsertResultsFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, Results []models.Result) ([]models.Result, error)
+	SetTriggerStateFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error)
+}
+
+//ClusterStore abstracts the membership and leader election of FlowKeeper servers
+type ClusterStore interface {
+	HeartbeatMember(ctx context.Context, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error)
+	RemoveMember(ctx context.Context, ID uuid.UUID) error
+	GetLiveMembers(ctx context.Context, At time.Time) ([]models.ClusterMember, error)
+	PruneMembers(ctx context.Context, Before time.Time) (int64, error)
+
+	AcquireLeadership(ctx context.Context, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error)
+	RenewLeadership(ctx context.Context, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error)
+	ResignLeadership(ctx context.Context, Leadership models.Leadership) error
+}
+
+//MongoStore implements the Store interface using the package level functions of dbtemplate
+type MongoStore struct {
+	Client *mongo.Database
+}
+
+var _ Store = MongoStore{}
+var _ ResultStore = MongoStore{}
+var _ TriggerEventStore = MongoStore{}
+var _ MaintenanceStore = MongoStore{}
+var _ NotificationStore = MongoStore{}
+var _ EscalationStore = MongoStore{}
+var _ SilenceStore = MongoStore{}
+var _ RegistrationStore = MongoStore{}
+var _ AutoRegistrationStore = MongoStore{}
+var _ LifecycleStore = MongoStore{}
+var _ AgentStateStore = MongoStore{}
+var _ LeaseStore = MongoStore{}
+var _ ClusterStore = MongoStore{}
+
+//NewMongoStore returns a Store which uses the specified database
+func NewMongoStore(Client *mongo.Database) MongoStore {
+	return MongoStore{Client: Client}
+}
+
+//GetAgent returns the appropriate agent for the given ID
+func (s MongoStore) GetAgent(ctx context.Context, ID primitive.ObjectID) (models.Agent, error) {
+	return GetAgentContext(ctx, s.Client, ID)
+}
+
+//GetAgentByUUID returns the appropriate agent for the given UUID
+func (s MongoStore) GetAgentByUUID(ctx context.Context, UUID uuid.UUID) (models.Agent, error) {
+	return GetAgentByUUIDContext(ctx, s.Client, UUID)
+}
+
+//GetAllAgents returns all agents from the database
+func (s MongoStore) GetAllAgents(ctx context.Context) ([]models.Agent, error) {
+	return GetAllAgentsContext(ctx, s.Client)
+}
+
+//GetTemplates returns one or multiple template structs for the specified IDs
+func (s MongoStore) GetTemplates(ctx context.Context, IDs []primitive.ObjectID) ([]models.Template, error) {
+	return GetTemplatesContext(ctx, s.Client, IDs)
+}
+
+//GetAllTemplates returns all templates from the database
+func (s MongoStore) GetAllTemplates(ctx context.Context) ([]models.Template, error) {
+	return GetAllTemplatesContext(ctx, s.Client)
+}
+
+//GetItems returns one or multiple item structs for the specified IDs
+func (s MongoStore) GetItems(ctx context.Context, IDs []primitive.ObjectID) ([]models.Item, error) {
+	return GetItemsContext(ctx, s.Client, IDs)
+}
+
+//GetItemByName gets the appropriate item which matches the specified Name
+func (s MongoStore) GetItemByName(ctx context.Context, Name string) (models.Item, error) {
+	return GetItemByNameContext(ctx, s.Client, Name)
+}
+
+//GetTrigger gets the appropriate trigger which matches the specified ID
+func (s MongoStore) GetTrigger(ctx context.Context, ID primitive.ObjectID) (models.Trigger, error) {
+	return GetTriggerContext(ctx, s.Client, ID)
+}
+
+//GetTriggerByName gets the appropriate trigger which matches the specified Name
+func (s MongoStore) GetTriggerByName(ctx context.Context, Name string) (models.Trigger, error) {
+	return GetTriggerByNameContext(ctx, s.Client, Name)
+}
+
+//GetTriggers returns one or multiple trigger structs for the specified IDs
+func (s MongoStore) GetTriggers(ctx context.Context, IDs []primitive.ObjectID) ([]models.Trigger, error) {
+	return GetTriggersContext(ctx, s.Client, IDs)
+}
+
+//AddTriggerAssignments persist a mapping between an agent and one or multiple triggers
+func (s MongoStore) AddTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID) error {
+	return AddTriggerAssignmentsContext(ctx, s.Client, AgentID, TriggerIDs)
+}
+
+//ReconcileTriggerAssignments brings the trigger assignments of the agent in line with the triggers assigned via its templates
+func (s MongoStore) ReconcileTriggerAssignments(ctx context.Context, AgentID primitive.ObjectID) (ReconcileReport, error) {
+	return ReconcileTriggerAssignmentsContext(ctx, s.Client, AgentID)
+}
+
+//SetTriggerState atomically sets the problem state and error of a single trigger assignment
+func (s MongoStore) SetTriggerState(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return SetTriggerStateContext(ctx, s.Client, AgentID, TriggerID, Problematic, Error)
+}
+
+//AcknowledgeProblem marks the current problem of the trigger assignment as acknowledged
+func (s MongoStore) AcknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Acknowledgement models.Acknowledgement) error {
+	return AcknowledgeProblemContext(ctx, s.Client, AgentID, TriggerID, Acknowledgement)
+}
+
+//UnacknowledgeProblem revokes the acknowledgement of the current problem of the trigger assignment
+func (s MongoStore) UnacknowledgeProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return UnacknowledgeProblemContext(ctx, s.Client, AgentID, TriggerID, User, Comment)
+}
+
+//CloseProblem manually closes the current problem of the trigger assignment
+func (s MongoStore) CloseProblem(ctx context.Context, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, User string, Comment string) error {
+	return CloseProblemContext(ctx, s.Client, AgentID, TriggerID, User, Comment)
+}
+
+//CreateAgent validates and persists a new agent
+func (s MongoStore) CreateAgent(ctx context.Context, Agent models.Agent) (models.Agent, error) {
+	return CreateAgentContext(ctx, s.Client, Agent)
+}
+
+//UpdateAgent validates and persists the changes of an existing agent
+func (s MongoStore) UpdateAgent(ctx context.Context, Agent models.Agent) error {
+	return UpdateAgentContext(ctx, s.Client, Agent)
+}
+
+//DeleteAgent marks the specified agent as deleted
+func (s MongoStore) DeleteAgent(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteAgentContext(ctx, s.Client, ID)
+}
+
+//CreateTemplate validates and persists a new template
+func (s MongoStore) CreateTemplate(ctx context.Context, Template models.Template) (models.Template, error) {
+	return CreateTemplateContext(ctx, s.Client, Template)
+}
+
+//UpdateTemplate validates and persists the changes of an existing template
+func (s MongoStore) UpdateTemplate(ctx context.Context, Template models.Template) error {
+	return UpdateTemplateContext(ctx, s.Client, Template)
+}
+
+//DeleteTemplate removes the specified template and unlinks it from all agents, auto registration rules, maintenances, notification rules and escalation policies
+func (s MongoStore) DeleteTemplate(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteTemplateContext(ctx, s.Client, ID)
+}
+
+//CreateItem validates and persists a new item
+func (s MongoStore) CreateItem(ctx context.Context, Item models.Item) (models.Item, error) {
+	return CreateItemContext(ctx, s.Client, Item)
+}
+
+//UpdateItem validates and persists the changes of an existing item
+func (s MongoStore) UpdateItem(ctx context.Context, Item models.Item) error {
+	return UpdateItemContext(ctx, s.Client, Item)
+}
+
+//DeleteItem removes the specified item and unlinks it from all templates
+func (s MongoStore) DeleteItem(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteItemContext(ctx, s.Client, ID)
+}
+
+//GetAllTriggers returns all triggers from the database
+func (s MongoStore) GetAllTriggers(ctx context.Context) ([]models.Trigger, error) {
+	return GetAllTriggersContext(ctx, s.Client)
+}
+
+//CreateTrigger validates and persists a new trigger
+func (s MongoStore) CreateTrigger(ctx context.Context, Trigger models.Trigger) (models.Trigger, error) {
+	return CreateTriggerContext(ctx, s.Client, Trigger)
+}
+
+//UpdateTrigger validates and persists the changes of an existing trigger
+func (s MongoStore) UpdateTrigger(ctx context.Context, Trigger models.Trigger) error {
+	return UpdateTriggerContext(ctx, s.Client, Trigger)
+}
+
+//DeleteTrigger removes the specified trigger and all references to it
+func (s MongoStore) DeleteTrigger(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteTriggerContext(ctx, s.Client, ID)
+}
+
+//InsertResult validates and persists a single result
+func (s MongoStore) InsertResult(ctx context.Context, Result models.Result) (models.Result, error) {
+	return InsertResultContext(ctx, s.Client, Result)
+}
+
+//InsertResults validates and persists multiple results
+func (s MongoStore) InsertResults(ctx context.Context, Results []models.Result) ([]models.Result, error) {
+	return InsertResultsContext(ctx, s.Client, Results)
+}
+
+//GetLastResults returns the last N results of the item captured on the specified agent
+func (s MongoStore) GetLastResults(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error) {
+	return GetLastResultsContext(ctx, s.Client, ItemID, HostID, Limit)
+}
+
+//GetResultsBetween returns all results of the item captured on the specified agent between From and To
+func (s MongoStore) GetResultsBetween(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, From time.Time, To time.Time) (models.ResultSet, error) {
+	return GetResultsBetweenContext(ctx, s.Client, ItemID, HostID, From, To)
+}
+
+//GetLatestResultPerItem returns the newest result of every item captured on the specified agent
+func (s MongoStore) GetLatestResultPerItem(ctx context.Context, HostID primitive.ObjectID) (models.ResultSet, error) {
+	return GetLatestResultPerItemContext(ctx, s.Client, HostID)
+}
+
+//InsertTriggerEvent persists a single trigger event
+func (s MongoStore) InsertTriggerEvent(ctx context.Context, Event models.TriggerEvent) (models.TriggerEvent, error) {
+	return InsertTriggerEventContext(ctx, s.Client, Event)
+}
+
+//GetTriggerEvents returns all trigger events matching the filter ordered newest-first
+func (s MongoStore) GetTriggerEvents(ctx context.Context, Filter TriggerEventFilter) ([]models.TriggerEvent, error) {
+	return GetTriggerEventsContext(ctx, s.Client, Filter)
+}
+
+//PruneTriggerEvents removes all trigger events exceeding the retention limits
+func (s MongoStore) PruneTriggerEvents(ctx context.Context, Retention TriggerEventRetention) (int64, error) {
+	return PruneTriggerEventsContext(ctx, s.Client, Retention)
+}
+
+//GetMaintenance returns the maintenance with the specified ID
+func (s MongoStore) GetMaintenance(ctx context.Context, ID primitive.ObjectID) (models.Maintenance, error) {
+	return GetMaintenanceContext(ctx, s.Client, ID)
+}
+
+//GetAllMaintenances returns all maintenances from the database
+func (s MongoStore) GetAllMaintenances(ctx context.Context) ([]models.Maintenance, error) {
+	return GetAllMaintenancesContext(ctx, s.Client)
+}
+
+//GetActiveMaintenances returns all maintenances which are active at the specified time
+func (s MongoStore) GetActiveMaintenances(ctx context.Context, At time.Time) ([]models.Maintenance, error) {
+	return GetActiveMaintenancesContext(ctx, s.Client, At)
+}
+
+//CreateMaintenance validates and persists a new maintenance
+func (s MongoStore) CreateMaintenance(ctx context.Context, Maintenance models.Maintenance) (models.Maintenance, error) {
+	return CreateMaintenanceContext(ctx, s.Client, Maintenance)
+}
+
+//UpdateMaintenance validates and persists the changes of an existing maintenance
+func (s MongoStore) UpdateMaintenance(ctx context.Context, Maintenance models.Maintenance) error {
+	return UpdateMaintenanceContext(ctx, s.Client, Maintenance)
+}
+
+//DeleteMaintenance removes the specified maintenance
+func (s MongoStore) DeleteMaintenance(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteMaintenanceContext(ctx, s.Client, ID)
+}
+
+//GetAllNotificationRules returns all notification rules from the database
+func (s MongoStore) GetAllNotificationRules(ctx context.Context) ([]models.NotificationRule, error) {
+	return GetAllNotificationRulesContext(ctx, s.Client)
+}
+
+//CreateNotificationRule validates and persists a new notification rule
+func (s MongoStore) CreateNotificationRule(ctx context.Context, Rule models.NotificationRule) (models.NotificationRule, error) {
+	return CreateNotificationRuleContext(ctx, s.Client, Rule)
+}
+
+//UpdateNotificationRule validates and persists the changes of an existing notification rule
+func (s MongoStore) UpdateNotificationRule(ctx context.Context, Rule models.NotificationRule) error {
+	return UpdateNotificationRuleContext(ctx, s.Client, Rule)
+}
+
+//DeleteNotificationRule removes the specified notification rule
+func (s MongoStore) DeleteNotificationRule(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteNotificationRuleContext(ctx, s.Client, ID)
+}
+
+//InsertDelivery persists a new entry of the delivery log
+func (s MongoStore) InsertDelivery(ctx context.Context, Delivery models.Delivery) (models.Delivery, error) {
+	return InsertDeliveryContext(ctx, s.Client, Delivery)
+}
+
+//UpdateDelivery persists the status of an existing entry of the delivery log
+func (s MongoStore) UpdateDelivery(ctx context.Context, Delivery models.Delivery) error {
+	return UpdateDeliveryContext(ctx, s.Client, Delivery)
+}
+
+//GetDeliveries returns all deliveries matching the filter
+func (s MongoStore) GetDeliveries(ctx context.Context, Filter DeliveryFilter) ([]models.Delivery, error) {
+	return GetDeliveriesContext(ctx, s.Client, Filter)
+}
+
+//GetAllEscalationPolicies returns all escalation policies from the database
+func (s MongoStore) GetAllEscalationPolicies(ctx context.Context) ([]models.EscalationPolicy, error) {
+	return GetAllEscalationPoliciesContext(ctx, s.Client)
+}
+
+//CreateEscalationPolicy validates and persists a new escalation policy
+func (s MongoStore) CreateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) (models.EscalationPolicy, error) {
+	return CreateEscalationPolicyContext(ctx, s.Client, Policy)
+}
+
+//UpdateEscalationPolicy validates and persists the changes of an existing escalation policy
+func (s MongoStore) UpdateEscalationPolicy(ctx context.Context, Policy models.EscalationPolicy) error {
+	return UpdateEscalationPolicyContext(ctx, s.Client, Policy)
+}
+
+//DeleteEscalationPolicy removes the specified escalation policy
+func (s MongoStore) DeleteEscalationPolicy(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteEscalationPolicyContext(ctx, s.Client, ID)
+}
+
+//GetAllSilences returns all silences from the database
+func (s MongoStore) GetAllSilences(ctx context.Context) ([]models.Silence, error) {
+	return GetAllSilencesContext(ctx, s.Client)
+}
+
+//GetActiveSilences returns all silences which are active at the specified time
+func (s MongoStore) GetActiveSilences(ctx context.Context, At time.Time) ([]models.Silence, error) {
+	return GetActiveSilencesContext(ctx, s.Client, At)
+}
+
+//CreateSilence validates and persists a new silence
+func (s MongoStore) CreateSilence(ctx context.Context, Silence models.Silence) (models.Silence, error) {
+	return CreateSilenceContext(ctx, s.Client, Silence)
+}
+
+//UpdateSilence validates and persists the changes of an existing silence
+func (s MongoStore) UpdateSilence(ctx context.Context, Silence models.Silence) error {
+	return UpdateSilenceContext(ctx, s.Client, Silence)
+}
+
+//ExpireSilence ends the silence immediately, silences which haven't started yet are deleted
+func (s MongoStore) ExpireSilence(ctx context.Context, ID primitive.ObjectID) error {
+	return ExpireSilenceContext(ctx, s.Client, ID)
+}
+
+//DeleteSilence removes the specified silence
+func (s MongoStore) DeleteSilence(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteSilenceContext(ctx, s.Client, ID)
+}
+
+//RegisterAgent creates a new agent or updates the existing agent with the same uuid
+func (s MongoStore) RegisterAgent(ctx context.Context, Registration models.Registration, Options EnrollmentOptions) (models.Agent, bool, error) {
+	return RegisterAgentContext(ctx, s.Client, Registration, Options)
+}
+
+//ApproveAgent approves a pending agent, so it is enabled and scraped
+func (s MongoStore) ApproveAgent(ctx context.Context, ID primitive.ObjectID) error {
+	return ApproveAgentContext(ctx, s.Client, ID)
+}
+
+//GetAllAutoRegistrationRules returns all auto registration rules ordered by their priority
+func (s MongoStore) GetAllAutoRegistrationRules(ctx context.Context) ([]models.AutoRegistrationRule, error) {
+	return GetAllAutoRegistrationRulesContext(ctx, s.Client)
+}
+
+//CreateAutoRegistrationRule validates and persists a new auto registration rule
+func (s MongoStore) CreateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) (models.AutoRegistrationRule, error) {
+	return CreateAutoRegistrationRuleContext(ctx, s.Client, Rule)
+}
+
+//UpdateAutoRegistrationRule validates and persists the changes of an existing auto registration rule
+func (s MongoStore) UpdateAutoRegistrationRule(ctx context.Context, Rule models.AutoRegistrationRule) error {
+	return UpdateAutoRegistrationRuleContext(ctx, s.Client, Rule)
+}
+
+//DeleteAutoRegistrationRule removes the specified auto registration rule
+func (s MongoStore) DeleteAutoRegistrationRule(ctx context.Context, ID primitive.ObjectID) error {
+	return DeleteAutoRegistrationRuleContext(ctx, s.Client, ID)
+}
+
+//DryRunAutoRegistration returns which rules match the agent and how they would change it
+func (s MongoStore) DryRunAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	return DryRunAutoRegistrationContext(ctx, s.Client, AgentID)
+}
+
+//ApplyAutoRegistration applies all matching auto registration rules to the agent
+func (s MongoStore) ApplyAutoRegistration(ctx context.Context, AgentID primitive.ObjectID) (models.AutoRegistrationResult, error) {
+	return ApplyAutoRegistrationContext(ctx, s.Client, AgentID)
+}
+
+//GetAgents returns all agents matching the filter
+func (s MongoStore) GetAgents(ctx context.Context, Filter AgentFilter) ([]models.Agent, error) {
+	return GetAgentsContext(ctx, s.Client, Filter)
+}
+
+//SetAgentLifecycle moves the agent into the specified lifecycle state
+func (s MongoStore) SetAgentLifecycle(ctx context.Context, ID primitive.ObjectID, State models.LifecycleState, User string) error {
+	return SetAgentLifecycleContext(ctx, s.Client, ID, State, User)
+}
+
+//RestoreAgent moves a deleted agent back into the state it had before it was deleted
+func (s MongoStore) RestoreAgent(ctx context.Context, ID primitive.ObjectID, User string) error {
+	return RestoreAgentContext(ctx, s.Client, ID, User)
+}
+
+//PurgeAgent permanently removes a deleted agent after the grace period
+func (s MongoStore) PurgeAgent(ctx context.Context, ID primitive.ObjectID, GracePeriod time.Duration) error {
+	return PurgeAgentContext(ctx, s.Client, ID, GracePeriod)
+}
+
+//PurgeDeletedAgents permanently removes all agents which were deleted more than GracePeriod ago
+func (s MongoStore) PurgeDeletedAgents(ctx context.Context, GracePeriod time.Duration) ([]primitive.ObjectID, error) {
+	return PurgeDeletedAgentsContext(ctx, s.Client, GracePeriod)
+}
+
+//SetAgentState atomically sets the online state of the agent and stores a trigger event if it changed
+//The agent is only marked offline if it wasn't seen after LastSeen
+func (s MongoStore) SetAgentState(ctx context.Context, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error) {
+	return SetAgentStateContext(ctx, s.Client, AgentID, State, LastSeen, At, Error)
+}
+
+//AcquireScraperLease acquires the lease of the agent for the scraper if it's free or expired
+func (s MongoStore) AcquireScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration) (models.ScraperLease, error) {
+	return AcquireScraperLeaseContext(ctx, s.Client, AgentID, Scraper, Duration)
+}
+
+//StealScraperLease acquires the lease of the agent, even if it wasn't renewed within Timeout by its holder
+func (s MongoStore) StealScraperLease(ctx context.Context, AgentID primitive.ObjectID, Scraper uuid.UUID, Duration time.Duration, Timeout time.Duration) (models.ScraperLease, error) {
+	return StealScraperLeaseContext(ctx, s.Client, AgentID, Scraper, Duration, Timeout)
+}
+
+//RenewScraperLease extends the lease of the scraper by Duration
+func (s MongoStore) RenewScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease, Duration time.Duration) (models.ScraperLease, error) {
+	return RenewScraperLeaseContext(ctx, s.Client, AgentID, Lease, Duration)
+}
+
+//ReleaseScraperLease releases the lease of the scraper
+func (s MongoStore) ReleaseScraperLease(ctx context.Context, AgentID primitive.ObjectID, Lease models.ScraperLease) error {
+	return ReleaseScraperLeaseContext(ctx, s.Client, AgentID, Lease)
+}
+
+//InsertResultsFenced persists the results of the agent if the fencing token belongs to its current lease
+func (s MongoStore) InsertResultsFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, Results []models.Result) ([]models.Result, error) {
+	return InsertResultsFencedContext(ctx, s.Client, AgentID, Token, Results)
+}
+
+//SetTriggerStateFenced sets the state of the trigger assignment if the fencing token belongs to the current lease of the agent
+func (s MongoStore) SetTriggerStateFenced(ctx context.Context, AgentID primitive.ObjectID, Token int64, TriggerID primitive.ObjectID, Problematic bool, Error string) (bool, error) {
+	return SetTriggerStateFencedContext(ctx, s.Client, AgentID, Token, TriggerID, Problematic, Error)
+}
+
+//HeartbeatMember registers the member or refreshes its heartbeat
+func (s MongoStore) HeartbeatMember(ctx context.Context, Member models.ClusterMember, TTL time.Duration) (models.ClusterMember, error) {
+	return HeartbeatMemberContext(ctx, s.Client, Member, TTL)
+}
+
+//RemoveMember removes the member from the cluster
+func (s MongoStore) RemoveMember(ctx context.Context, ID uuid.UUID) error {
+	return RemoveMemberContext(ctx, s.Client, ID)
+}
+
+//GetLiveMembers returns all members whose heartbeat didn't expire at the specified time
+func (s MongoStore) GetLiveMembers(ctx context.Context, At time.Time) ([]models.ClusterMember, error) {
+	return GetLiveMembersContext(ctx, s.Client, At)
+}
+
+//PruneMembers removes all members whose heartbeat expired before the specified time
+func (s MongoStore) PruneMembers(ctx context.Context, Before time.Time) (int64, error) {
+	return PruneMembersContext(ctx, s.Client, Before)
+}
+
+//AcquireLeadership makes the member the leader of the election if there is no leader or the leadership expired
+func (s MongoStore) AcquireLeadership(ctx context.Context, Name string, Member uuid.UUID, Duration time.Duration) (models.Leadership, error) {
+	return AcquireLeadershipContext(ctx, s.Client, Name, Member, Duration)
+}
+
+//RenewLeadership extends the leadership of the leader by Duration
+func (s MongoStore) RenewLeadership(ctx context.Context, Leadership models.Leadership, Duration time.Duration) (models.Leadership, error) {
+	return RenewLeadershipContext(ctx, s.Client, Leadership, Duration)
+}
+
+//ResignLeadership gives up the leadership
+func (s MongoStore) ResignLeadership(ctx context.Context, Leadership models.Leadership) error {
+	return ResignLeadershipContext(ctx, s.Client, Leadership)
+}
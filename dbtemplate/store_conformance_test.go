@@ -0,0 +1,981 @@
+package dbtemplate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dependency"
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//mongoURIEnv points to a MongoDB instance the conformance suite is additionally run against
+//Every run uses a new database, which is dropped afterwards
+const mongoURIEnv = "FLOWUTILS_TEST_MONGO_URI"
+
+//conformanceStore is implemented by every store the conformance suite runs against
+type conformanceStore interface {
+	Store
+	ResultStore
+	TriggerEventStore
+	MaintenanceStore
+	NotificationStore
+	EscalationStore
+	AutoRegistrationStore
+	AgentStateStore
+	SilenceStore
+	LifecycleStore
+	LeaseStore
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, s conformanceStore)
+}
+
+var conformanceCases = []conformanceCase{
+	{"get agent", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := fixtures.Item("cpu.load")
+		trigger := fixtures.Trigger("high load")
+		template := fixtures.Template("linux", []models.Item{item}, []models.Trigger{trigger})
+		agent := fixtures.Agent("web1", template)
+		put(t, s, item, trigger, template, agent)
+
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil {
+			t.Fatal("get:", err)
+		}
+		if stored.Name != agent.Name || len(stored.Templates) != 1 || len(stored.GetAllItems()) != 1 || len(stored.GetAllTriggers()) != 1 {
+			t.Fatalf("agent wasn't populated: %+v", stored)
+		}
+		if byUUID, err := s.GetAgentByUUID(ctx, agent.AgentUUID); err != nil || byUUID.ID != agent.ID {
+			t.Fatal("get by uuid:", byUUID, err)
+		}
+	}},
+	{"get all agents", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		active := fixtures.Agent("web1")
+		deleted := fixtures.Agent("web2")
+		deleted.Deleted = true
+		put(t, s, active, deleted)
+
+		agents, err := s.GetAllAgents(ctx)
+		if err != nil || len(agents) != 1 || agents[0].ID != active.ID {
+			t.Fatal("deleted agent is returned:", agents, err)
+		}
+	}},
+	{"get templates", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := fixtures.Item("uptime")
+		template := fixtures.Template("base", []models.Item{item}, nil)
+		other := fixtures.Template("other", nil, nil)
+		put(t, s, item, template, other)
+
+		templates, err := s.GetTemplates(ctx, []primitive.ObjectID{template.ID, primitive.NewObjectID()})
+		if err != nil || len(templates) != 1 {
+			t.Fatal("get:", templates, err)
+		}
+		if len(templates[0].Items) != 1 || templates[0].Items[0].ID != item.ID {
+			t.Fatal("template wasn't populated:", templates[0].Items)
+		}
+		if all, err := s.GetAllTemplates(ctx); err != nil || len(all) != 2 {
+			t.Fatal("get all:", all, err)
+		}
+	}},
+	{"get items and triggers", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := fixtures.Item("disk.free")
+		trigger := fixtures.Trigger("disk full")
+		put(t, s, item, trigger)
+
+		if items, err := s.GetItems(ctx, []primitive.ObjectID{item.ID}); err != nil || len(items) != 1 {
+			t.Fatal("get items:", items, err)
+		}
+		if byName, err := s.GetItemByName(ctx, "disk.free"); err != nil || byName.ID != item.ID {
+			t.Fatal("get item by name:", byName, err)
+		}
+		if stored, err := s.GetTrigger(ctx, trigger.ID); err != nil || stored.Name != trigger.Name {
+			t.Fatal("get trigger:", stored, err)
+		}
+		if byName, err := s.GetTriggerByName(ctx, "disk full"); err != nil || byName.ID != trigger.ID {
+			t.Fatal("get trigger by name:", byName, err)
+		}
+		if triggers, err := s.GetTriggers(ctx, []primitive.ObjectID{trigger.ID}); err != nil || len(triggers) != 1 {
+			t.Fatal("get triggers:", triggers, err)
+		}
+	}},
+	{"not found", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		if _, err := s.GetAgent(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get agent:", err)
+		}
+		if _, err := s.GetAgentByUUID(ctx, uuid.New()); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get agent by uuid:", err)
+		}
+		if _, err := s.GetItemByName(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get item by name:", err)
+		}
+		if _, err := s.GetTrigger(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get trigger:", err)
+		}
+		if _, err := s.GetTriggerByName(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get trigger by name:", err)
+		}
+		if items, err := s.GetItems(ctx, []primitive.ObjectID{primitive.NewObjectID()}); err != nil || len(items) != 0 {
+			t.Fatal("get items:", items, err)
+		}
+	}},
+	{"reconcile trigger assignments", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		cpu := mustCreateTrigger(t, ctx, s, "cpu", nil)
+		memory := mustCreateTrigger(t, ctx, s, "memory", nil)
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "server", TriggerIDs: []primitive.ObjectID{cpu.ID, memory.ID}})
+		agent := mustCreateAgent(t, ctx, s, "srv1", template.ID)
+
+		report, err := s.ReconcileTriggerAssignments(ctx, agent.ID)
+		if err != nil || len(report.Added) != 2 || len(report.Removed) != 0 {
+			t.Fatal("first reconcile:", report, err)
+		}
+		if report, err := s.ReconcileTriggerAssignments(ctx, agent.ID); err != nil || report.Changed() {
+			t.Fatal("second reconcile:", report, err)
+		}
+
+		template.TriggerIDs = []primitive.ObjectID{cpu.ID}
+		if err := s.UpdateTemplate(ctx, template); err != nil {
+			t.Fatal("update template:", err)
+		}
+		report, err = s.ReconcileTriggerAssignments(ctx, agent.ID)
+		if err != nil || len(report.Added) != 0 || len(report.Removed) != 1 || report.Removed[0].TriggerID != memory.ID {
+			t.Fatal("reconcile after unlink:", report, err)
+		}
+
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil || len(stored.TriggerMappings) != 1 || stored.TriggerMappings[0].TriggerID != cpu.ID {
+			t.Fatal("assignments:", stored.TriggerMappings, err)
+		}
+	}},
+	{"add trigger assignments", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		trigger := fixtures.Trigger("manual")
+		agent := fixtures.Agent("srv2")
+		put(t, s, trigger, agent)
+
+		if err := s.AddTriggerAssignments(ctx, agent.ID, []primitive.ObjectID{trigger.ID}); err != nil {
+			t.Fatal("add:", err)
+		}
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil {
+			t.Fatal("get:", err)
+		}
+		if mapping, err := stored.GetTriggerMappingByTriggerID(trigger.ID); err != nil || mapping.Problematic {
+			t.Fatal("assignment:", mapping, err)
+		}
+		if err := s.AddTriggerAssignments(ctx, primitive.NewObjectID(), []primitive.ObjectID{trigger.ID}); !errors.Is(err, ErrNotFound) {
+			t.Fatal("unknown agent:", err)
+		}
+	}},
+	{"item crud", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := mustCreateItem(t, ctx, s, "cpu.load")
+
+		item.Command = "cat /proc/loadavg"
+		if err := s.UpdateItem(ctx, item); err != nil {
+			t.Fatal("update:", err)
+		}
+		stored, err := s.GetItemByName(ctx, "cpu.load")
+		if err != nil {
+			t.Fatal("get:", err)
+		}
+		if stored.ID != item.ID || stored.Command != item.Command {
+			t.Fatalf("got %+v, want %+v", stored, item)
+		}
+
+		if err := s.DeleteItem(ctx, item.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		if _, err := s.GetItemByName(ctx, "cpu.load"); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get after delete:", err)
+		}
+	}},
+	{"item validation", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := fixtures.Item("invalid")
+		item.Interval = 0
+		if _, err := s.CreateItem(ctx, item); err == nil {
+			t.Fatal("item without interval was accepted")
+		}
+	}},
+	{"item name in use", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		mustCreateItem(t, ctx, s, "disk.free")
+		other := mustCreateItem(t, ctx, s, "disk.used")
+
+		if _, err := s.CreateItem(ctx, fixtures.Item("disk.free")); !errors.Is(err, ErrNameInUse) {
+			t.Fatal("create:", err)
+		}
+		other.Name = "disk.free"
+		if err := s.UpdateItem(ctx, other); !errors.Is(err, ErrNameInUse) {
+			t.Fatal("update:", err)
+		}
+	}},
+	{"item not found", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := fixtures.Item("missing")
+		if err := s.UpdateItem(ctx, item); !errors.Is(err, ErrNotFound) {
+			t.Fatal("update:", err)
+		}
+		if err := s.DeleteItem(ctx, item.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatal("delete:", err)
+		}
+	}},
+	{"delete item unlinks templates", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := mustCreateItem(t, ctx, s, "mem.free")
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "linux", ItemIDs: []primitive.ObjectID{item.ID}})
+
+		if err := s.DeleteItem(ctx, item.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		templates, err := s.GetTemplates(ctx, []primitive.ObjectID{template.ID})
+		if err != nil || len(templates) != 1 {
+			t.Fatal("get template:", templates, err)
+		}
+		if len(templates[0].ItemIDs) != 0 || len(templates[0].Items) != 0 {
+			t.Fatal("item is still linked:", templates[0].ItemIDs)
+		}
+	}},
+	{"trigger crud", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		trigger := mustCreateTrigger(t, ctx, s, "high load", nil)
+
+		trigger.Severity = models.HIGH
+		if err := s.UpdateTrigger(ctx, trigger); err != nil {
+			t.Fatal("update:", err)
+		}
+		stored, err := s.GetTrigger(ctx, trigger.ID)
+		if err != nil || stored.Severity != models.HIGH {
+			t.Fatal("get:", stored, err)
+		}
+		if byName, err := s.GetTriggerByName(ctx, "high load"); err != nil || byName.ID != trigger.ID {
+			t.Fatal("get by name:", byName, err)
+		}
+
+		if err := s.DeleteTrigger(ctx, trigger.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		if _, err := s.GetTrigger(ctx, trigger.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatal("get after delete:", err)
+		}
+		if err := s.DeleteTrigger(ctx, trigger.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatal("delete twice:", err)
+		}
+	}},
+	{"trigger validation", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		if _, err := s.CreateTrigger(ctx, models.Trigger{Name: "empty"}); err == nil {
+			t.Fatal("trigger without expression was accepted")
+		}
+		if _, err := s.CreateTrigger(ctx, models.Trigger{Name: "broken", Expression: "last(cpu.load) >"}); err == nil {
+			t.Fatal("invalid expression was accepted")
+		}
+		if _, err := s.CreateTrigger(ctx, models.Trigger{Name: "orphan", Expression: "last(cpu.load) > 1", DependsOn: []primitive.ObjectID{primitive.NewObjectID()}}); err == nil {
+			t.Fatal("unknown dependency was accepted")
+		}
+	}},
+	{"trigger dependency cycle", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		parent := mustCreateTrigger(t, ctx, s, "unreachable", nil)
+		child := mustCreateTrigger(t, ctx, s, "slow", []primitive.ObjectID{parent.ID})
+
+		parent.DependsOn = []primitive.ObjectID{child.ID}
+		var cycle dependency.CycleError
+		if err := s.UpdateTrigger(ctx, parent); !errors.As(err, &cycle) {
+			t.Fatal("cycle wasn't rejected:", err)
+		}
+	}},
+	{"trigger name in use", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		mustCreateTrigger(t, ctx, s, "disk full", nil)
+		other := mustCreateTrigger(t, ctx, s, "disk almost full", nil)
+
+		if _, err := s.CreateTrigger(ctx, fixtures.Trigger("disk full")); !errors.Is(err, ErrNameInUse) {
+			t.Fatal("create:", err)
+		}
+		other.Name = "disk full"
+		if err := s.UpdateTrigger(ctx, other); !errors.Is(err, ErrNameInUse) {
+			t.Fatal("update:", err)
+		}
+	}},
+	{"delete trigger unlinks references", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		parent := mustCreateTrigger(t, ctx, s, "unreachable", nil)
+		child := mustCreateTrigger(t, ctx, s, "slow", []primitive.ObjectID{parent.ID})
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "network", TriggerIDs: []primitive.ObjectID{parent.ID, child.ID}})
+		agent := mustCreateAgent(t, ctx, s, "web1", template.ID)
+		if err := s.AddTriggerAssignments(ctx, agent.ID, []primitive.ObjectID{parent.ID}); err != nil {
+			t.Fatal("add assignment:", err)
+		}
+
+		if err := s.DeleteTrigger(ctx, parent.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+
+		if stored, err := s.GetTrigger(ctx, child.ID); err != nil || len(stored.DependsOn) != 0 {
+			t.Fatal("dependency is still linked:", stored.DependsOn, err)
+		}
+		if templates, err := s.GetTemplates(ctx, []primitive.ObjectID{template.ID}); err != nil || len(templates[0].TriggerIDs) != 1 {
+			t.Fatal("trigger is still linked to template:", templates, err)
+		}
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil {
+			t.Fatal("get agent:", err)
+		}
+		if _, err := stored.GetTriggerMappingByTriggerID(parent.ID); err == nil {
+			t.Fatal("trigger assignment wasn't removed")
+		}
+	}},
+	{"template crud", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := mustCreateItem(t, ctx, s, "uptime")
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "base"})
+
+		template.ItemIDs = []primitive.ObjectID{item.ID}
+		if err := s.UpdateTemplate(ctx, template); err != nil {
+			t.Fatal("update:", err)
+		}
+		templates, err := s.GetAllTemplates(ctx)
+		if err != nil || len(templates) != 1 {
+			t.Fatal("get all:", templates, err)
+		}
+		if len(templates[0].Items) != 1 || templates[0].Items[0].ID != item.ID {
+			t.Fatal("template wasn't populated:", templates[0].Items)
+		}
+
+		if err := s.DeleteTemplate(ctx, template.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		if err := s.UpdateTemplate(ctx, template); !errors.Is(err, ErrNotFound) {
+			t.Fatal("update after delete:", err)
+		}
+	}},
+	{"delete template unlinks agents", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "windows"})
+		agent := mustCreateAgent(t, ctx, s, "win1", template.ID)
+
+		if err := s.DeleteTemplate(ctx, template.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		if stored, err := s.GetAgent(ctx, agent.ID); err != nil || len(stored.TemplateIDs) != 0 {
+			t.Fatal("template is still linked:", stored.TemplateIDs, err)
+		}
+	}},
+	{"delete template unlinks rules and maintenances", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "solaris"})
+		other := mustCreateTemplate(t, ctx, s, models.Template{Name: "aix"})
+
+		maintenance, err := s.CreateMaintenance(ctx, models.Maintenance{Name: "patching", Scope: models.MaintenanceScope{TemplateIDs: []primitive.ObjectID{template.ID, other.ID}}, Start: time.Now(), End: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal("create maintenance:", err)
+		}
+		onlyRule, err := s.CreateNotificationRule(ctx, models.NotificationRule{Name: "only", Enabled: true, Channels: []string{"mail"}, TemplateIDs: []primitive.ObjectID{template.ID}})
+		if err != nil {
+			t.Fatal("create notification rule:", err)
+		}
+		sharedRule, err := s.CreateNotificationRule(ctx, models.NotificationRule{Name: "shared", Enabled: true, Channels: []string{"mail"}, TemplateIDs: []primitive.ObjectID{template.ID, other.ID}})
+		if err != nil {
+			t.Fatal("create notification rule:", err)
+		}
+		policy, err := s.CreateEscalationPolicy(ctx, models.EscalationPolicy{Name: "only", Enabled: true, TemplateIDs: []primitive.ObjectID{template.ID}, Steps: []models.EscalationStep{{Channels: []string{"oncall"}}}})
+		if err != nil {
+			t.Fatal("create escalation policy:", err)
+		}
+		registration, err := s.CreateAutoRegistrationRule(ctx, models.AutoRegistrationRule{Name: "only", Enabled: true, TemplateIDs: []primitive.ObjectID{template.ID}})
+		if err != nil {
+			t.Fatal("create auto registration rule:", err)
+		}
+
+		if err := s.DeleteTemplate(ctx, template.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+
+		if stored, err := s.GetMaintenance(ctx, maintenance.ID); err != nil || len(stored.Scope.TemplateIDs) != 1 || stored.Scope.TemplateIDs[0] != other.ID {
+			t.Fatal("template is still in the maintenance scope:", stored.Scope.TemplateIDs, err)
+		}
+
+		rules, err := s.GetAllNotificationRules(ctx)
+		if err != nil {
+			t.Fatal("get notification rules:", err)
+		}
+		for _, k := range rules {
+			switch k.ID {
+			case onlyRule.ID:
+				//A rule without templates matches everything, so it has to be disabled
+				if k.Enabled || len(k.TemplateIDs) != 0 {
+					t.Fatalf("rule scoped to the template wasn't disabled: %+v", k)
+				}
+			case sharedRule.ID:
+				if !k.Enabled || len(k.TemplateIDs) != 1 || k.TemplateIDs[0] != other.ID {
+					t.Fatalf("rule scoped to another template wasn't unlinked: %+v", k)
+				}
+			}
+		}
+
+		policies, err := s.GetAllEscalationPolicies(ctx)
+		if err != nil || len(policies) != 1 || policies[0].ID != policy.ID || policies[0].Enabled || len(policies[0].TemplateIDs) != 0 {
+			t.Fatalf("policy scoped to the template wasn't disabled: %+v %v", policies, err)
+		}
+
+		registrations, err := s.GetAllAutoRegistrationRules(ctx)
+		if err != nil || len(registrations) != 1 || registrations[0].ID != registration.ID || registrations[0].Enabled || len(registrations[0].TemplateIDs) != 0 {
+			t.Fatalf("auto registration rule without actions wasn't disabled: %+v %v", registrations, err)
+		}
+	}},
+	{"agent state", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		seen := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+		agent := fixtures.Agent("app1")
+		agent.LastSeen = seen
+		agent, err := s.CreateAgent(ctx, agent)
+		if err != nil {
+			t.Fatal("create agent:", err)
+		}
+
+		//The agent was seen after the caller read it
+		if changed, err := s.SetAgentState(ctx, agent.ID, models.Offline, seen.Add(-time.Hour), time.Now(), "timeout"); err != nil || changed {
+			t.Fatal("agent seen in the meantime was marked offline:", changed, err)
+		}
+		if changed, err := s.SetAgentState(ctx, agent.ID, models.Offline, seen, time.Now(), "timeout"); err != nil || !changed {
+			t.Fatal("agent wasn't marked offline:", changed, err)
+		}
+		if changed, err := s.SetAgentState(ctx, agent.ID, models.Offline, seen, time.Now(), "timeout"); err != nil || changed {
+			t.Fatal("agent was marked offline twice:", changed, err)
+		}
+		if changed, err := s.SetAgentState(ctx, agent.ID, models.Online, seen, time.Now(), ""); err != nil || !changed {
+			t.Fatal("agent wasn't marked online:", changed, err)
+		}
+		if _, err := s.SetAgentState(ctx, primitive.NewObjectID(), models.Offline, seen, time.Now(), ""); !errors.Is(err, ErrNotFound) {
+			t.Fatal("expected ErrNotFound, got", err)
+		}
+
+		events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{AgentIDs: []primitive.ObjectID{agent.ID}})
+		if err != nil || len(events) != 2 {
+			t.Fatal("expected one event per transition:", events, err)
+		}
+	}},
+	{"purge agent", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		agent := mustCreateAgent(t, ctx, s, "old1")
+		other := mustCreateAgent(t, ctx, s, "web1")
+
+		onlyRule, err := s.CreateNotificationRule(ctx, models.NotificationRule{Name: "only", Enabled: true, Channels: []string{"mail"}, AgentIDs: []primitive.ObjectID{agent.ID}})
+		if err != nil {
+			t.Fatal("create notification rule:", err)
+		}
+		sharedRule, err := s.CreateNotificationRule(ctx, models.NotificationRule{Name: "shared", Enabled: true, Channels: []string{"mail"}, AgentIDs: []primitive.ObjectID{agent.ID, other.ID}})
+		if err != nil {
+			t.Fatal("create notification rule:", err)
+		}
+
+		if err := s.PurgeAgent(ctx, agent.ID, 0); !errors.Is(err, ErrNotPurgeable) {
+			t.Fatal("expected ErrNotPurgeable for an active agent, got", err)
+		}
+		if err := s.SetAgentLifecycle(ctx, agent.ID, models.LifecycleDeleted, "test"); err != nil {
+			t.Fatal("delete:", err)
+		}
+		if err := s.PurgeAgent(ctx, agent.ID, time.Hour); !errors.Is(err, ErrNotPurgeable) {
+			t.Fatal("expected ErrNotPurgeable within the grace period, got", err)
+		}
+		if err := s.PurgeAgent(ctx, agent.ID, 0); err != nil {
+			t.Fatal("purge:", err)
+		}
+
+		if _, err := s.GetAgent(ctx, agent.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatal("purged agent still exists:", err)
+		}
+
+		rules, err := s.GetAllNotificationRules(ctx)
+		if err != nil {
+			t.Fatal("get notification rules:", err)
+		}
+		for _, k := range rules {
+			switch k.ID {
+			case onlyRule.ID:
+				//A rule without agents matches everything, so it has to be disabled
+				if k.Enabled || len(k.AgentIDs) != 0 {
+					t.Fatalf("rule scoped to the agent wasn't disabled: %+v", k)
+				}
+			case sharedRule.ID:
+				if !k.Enabled || len(k.AgentIDs) != 1 || k.AgentIDs[0] != other.ID {
+					t.Fatalf("rule scoped to another agent wasn't unlinked: %+v", k)
+				}
+			}
+		}
+	}},
+	{"agent crud", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		item := mustCreateItem(t, ctx, s, "ping")
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "icmp", ItemIDs: []primitive.ObjectID{item.ID}})
+		agent := mustCreateAgent(t, ctx, s, "db1")
+
+		agent.TemplateIDs = []primitive.ObjectID{template.ID}
+		agent.Description = "database"
+		if err := s.UpdateAgent(ctx, agent); err != nil {
+			t.Fatal("update:", err)
+		}
+		stored, err := s.GetAgentByUUID(ctx, agent.AgentUUID)
+		if err != nil {
+			t.Fatal("get by uuid:", err)
+		}
+		if stored.ID != agent.ID || stored.Description != "database" || len(stored.GetAllItems()) != 1 {
+			t.Fatalf("agent wasn't updated / populated: %+v", stored)
+		}
+
+		if err := s.DeleteAgent(ctx, agent.ID); err != nil {
+			t.Fatal("delete:", err)
+		}
+		agents, err := s.GetAllAgents(ctx)
+		if err != nil || len(agents) != 0 {
+			t.Fatal("deleted agent is still returned:", agents, err)
+		}
+	}},
+	{"agent errors", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		agent := mustCreateAgent(t, ctx, s, "app1")
+
+		duplicate := fixtures.Agent("app1 copy")
+		duplicate.AgentUUID = agent.AgentUUID
+		if _, err := s.CreateAgent(ctx, duplicate); !errors.Is(err, ErrAgentExists) {
+			t.Fatal("duplicate uuid:", err)
+		}
+		if err := s.UpdateAgent(ctx, fixtures.Agent("missing")); !errors.Is(err, ErrNotFound) {
+			t.Fatal("update:", err)
+		}
+		if err := s.DeleteAgent(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+			t.Fatal("delete:", err)
+		}
+	}},
+	{"set trigger state", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		trigger := mustCreateTrigger(t, ctx, s, "load", nil)
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "load", TriggerIDs: []primitive.ObjectID{trigger.ID}})
+		agent := mustCreateAgent(t, ctx, s, "srv3", template.ID)
+		if _, err := s.ReconcileTriggerAssignments(ctx, agent.ID); err != nil {
+			t.Fatal("reconcile:", err)
+		}
+
+		steps := []struct {
+			problematic bool
+			error       string
+			changed     bool
+		}{
+			{false, "", false},
+			{true, "", true},
+			{true, "still high", false},
+			{false, "", true},
+			{false, "", false},
+		}
+		for i, k := range steps {
+			changed, err := s.SetTriggerState(ctx, agent.ID, trigger.ID, k.problematic, k.error)
+			if err != nil || changed != k.changed {
+				t.Fatalf("step %d: changed %v, %v", i, changed, err)
+			}
+		}
+
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil {
+			t.Fatal("get:", err)
+		}
+		if mapping, _ := stored.GetTriggerMappingByTriggerID(trigger.ID); mapping.Problematic {
+			t.Fatal("assignment is still problematic")
+		}
+
+		//Only the two transitions are recorded as events
+		events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{AgentIDs: []primitive.ObjectID{agent.ID}})
+		if err != nil || len(events) != 2 {
+			t.Fatal("events:", events, err)
+		}
+		if events[0].Problematic || !events[1].Problematic {
+			t.Fatal("events aren't ordered newest-first:", events)
+		}
+
+		if _, err := s.SetTriggerState(ctx, agent.ID, primitive.NewObjectID(), true, ""); !errors.Is(err, ErrNotFound) {
+			t.Fatal("unknown trigger:", err)
+		}
+		if _, err := s.SetTriggerState(ctx, primitive.NewObjectID(), trigger.ID, true, ""); !errors.Is(err, ErrNotFound) {
+			t.Fatal("unknown agent:", err)
+		}
+	}},
+	{"acknowledge and close problem", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		trigger := mustCreateTrigger(t, ctx, s, "swap", nil)
+		template := mustCreateTemplate(t, ctx, s, models.Template{Name: "swap", TriggerIDs: []primitive.ObjectID{trigger.ID}})
+		agent := mustCreateAgent(t, ctx, s, "srv4", template.ID)
+		if _, err := s.ReconcileTriggerAssignments(ctx, agent.ID); err != nil {
+			t.Fatal("reconcile:", err)
+		}
+
+		if err := s.AcknowledgeProblem(ctx, agent.ID, trigger.ID, models.Acknowledgement{User: "alice"}); !errors.Is(err, ErrNoProblem) {
+			t.Fatal("acknowledge without problem:", err)
+		}
+		if _, err := s.SetTriggerState(ctx, agent.ID, trigger.ID, true, ""); err != nil {
+			t.Fatal("set state:", err)
+		}
+
+		severity := models.HIGH
+		if err := s.AcknowledgeProblem(ctx, agent.ID, trigger.ID, models.Acknowledgement{User: "alice", Severity: &severity}); err != nil {
+			t.Fatal("acknowledge:", err)
+		}
+		if err := s.AcknowledgeProblem(ctx, agent.ID, trigger.ID, models.Acknowledgement{}); err == nil {
+			t.Fatal("acknowledgement without user was accepted")
+		}
+		stored, err := s.GetAgent(ctx, agent.ID)
+		if err != nil {
+			t.Fatal("get:", err)
+		}
+		mapping, _ := stored.GetTriggerMappingByTriggerID(trigger.ID)
+		if !mapping.Acknowledged || mapping.EffectiveSeverity(trigger) != models.HIGH || len(mapping.Acknowledgements) != 1 || len(stored.AcknowledgedProblems()) != 1 {
+			t.Fatalf("problem wasn't acknowledged: %+v", mapping)
+		}
+
+		if err := s.UnacknowledgeProblem(ctx, agent.ID, trigger.ID, "bob", "not fixed"); err != nil {
+			t.Fatal("unacknowledge:", err)
+		}
+		if err := s.CloseProblem(ctx, agent.ID, trigger.ID, "bob", "false alarm"); err != nil {
+			t.Fatal("close:", err)
+		}
+		stored, _ = s.GetAgent(ctx, agent.ID)
+		mapping, _ = stored.GetTriggerMappingByTriggerID(trigger.ID)
+		if mapping.Problematic || mapping.Acknowledged || !mapping.ManuallyClosed || len(mapping.Acknowledgements) != 3 {
+			t.Fatalf("problem wasn't closed: %+v", mapping)
+		}
+		events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{AgentIDs: []primitive.ObjectID{agent.ID}})
+		if err != nil || len(events) != 2 {
+			t.Fatal("events:", events, err)
+		}
+		closed := false
+		for _, k := range events {
+			closed = closed || !k.Problematic && k.User == "bob"
+		}
+		if !closed {
+			t.Fatal("closing event wasn't stored:", events)
+		}
+
+		//The closed problem isn't reopened until the expression recovers
+		if changed, err := s.SetTriggerState(ctx, agent.ID, trigger.ID, true, ""); err != nil || changed {
+			t.Fatal("closed problem was reopened:", changed, err)
+		}
+		if _, err := s.SetTriggerState(ctx, agent.ID, trigger.ID, false, ""); err != nil {
+			t.Fatal("recover:", err)
+		}
+		if changed, err := s.SetTriggerState(ctx, agent.ID, trigger.ID, true, ""); err != nil || !changed {
+			t.Fatal("new problem wasn't detected:", changed, err)
+		}
+		stored, _ = s.GetAgent(ctx, agent.ID)
+		if mapping, _ := stored.GetTriggerMappingByTriggerID(trigger.ID); len(mapping.Acknowledgements) != 0 || mapping.SeverityOverride != nil {
+			t.Fatalf("new problem kept the acknowledgements of the previous one: %+v", mapping)
+		}
+
+		if err := s.CloseProblem(ctx, agent.ID, primitive.NewObjectID(), "bob", ""); !errors.Is(err, ErrNotFound) {
+			t.Fatal("unknown trigger:", err)
+		}
+	}},
+	{"trigger events", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		agent, cpu, disk := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now().Truncate(time.Millisecond)
+
+		for i := 0; i < 4; i++ {
+			event := models.TriggerEvent{AgentID: agent, TriggerID: cpu, Severity: models.LOW, Time: now.Add(time.Duration(i-4) * time.Minute), Problematic: i%2 == 0}
+			if _, err := s.InsertTriggerEvent(ctx, event); err != nil {
+				t.Fatal("insert:", err)
+			}
+		}
+		if _, err := s.InsertTriggerEvent(ctx, models.TriggerEvent{AgentID: agent, TriggerID: disk, Severity: models.HIGH, Time: now.Add(-48 * time.Hour), Problematic: true}); err != nil {
+			t.Fatal("insert:", err)
+		}
+
+		events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{AgentIDs: []primitive.ObjectID{agent}, Limit: 2})
+		if err != nil || len(events) != 2 || !events[0].Time.Equal(now.Add(-time.Minute)) {
+			t.Fatal("events aren't limited / ordered newest-first:", events, err)
+		}
+		if events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{Severities: []models.TriggerSeverity{models.HIGH}}); err != nil || len(events) != 1 || events[0].TriggerID != disk {
+			t.Fatal("severity filter:", events, err)
+		}
+		if events, err := s.GetTriggerEvents(ctx, TriggerEventFilter{TriggerIDs: []primitive.ObjectID{cpu}, From: now.Add(-3 * time.Minute), To: now.Add(-2 * time.Minute)}); err != nil || len(events) != 2 {
+			t.Fatal("time filter isn't inclusive:", events, err)
+		}
+
+		//The event of the disk trigger is too old, only the two newest events of the cpu trigger are kept
+		pruned, err := s.PruneTriggerEvents(ctx, TriggerEventRetention{MaxAge: 24 * time.Hour, MaxEventsPerAssignment: 2})
+		if err != nil || pruned != 3 {
+			t.Fatal("pruned", pruned, "events:", err)
+		}
+		events, err = s.GetTriggerEvents(ctx, TriggerEventFilter{})
+		if err != nil || len(events) != 2 || events[1].Time.Before(now.Add(-2*time.Minute)) {
+			t.Fatal("remaining events:", events, err)
+		}
+	}},
+	{"results", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		host, cpu, mem := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		at := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+		if _, err := s.InsertResult(ctx, models.Result{ItemID: cpu, Type: models.Numeric}); err == nil {
+			t.Fatal("result without agent was accepted")
+		}
+
+		results := make([]models.Result, 0)
+		for i := 0; i < 3; i++ {
+			results = append(results, models.Result{ItemID: cpu, HostID: host, Type: models.Numeric, CapturedAt: at.Add(time.Duration(i) * time.Minute), ValueNumeric: float64(i)})
+		}
+		if _, err := s.InsertResults(ctx, results); err != nil {
+			t.Fatal("insert:", err)
+		}
+		if _, err := s.InsertResult(ctx, models.Result{ItemID: mem, HostID: host, Type: models.Numeric, CapturedAt: at}); err != nil {
+			t.Fatal("insert:", err)
+		}
+
+		last, err := s.GetLastResults(ctx, cpu, host, 2)
+		if err != nil || len(last.Results) != 2 || last.Results[0].ValueNumeric != 2 || last.Results[1].ValueNumeric != 1 {
+			t.Fatal("last results aren't ordered newest-first:", last, err)
+		}
+
+		between, err := s.GetResultsBetween(ctx, cpu, host, at, at.Add(time.Minute))
+		if err != nil || len(between.Results) != 2 || between.Results[1].ValueNumeric != 0 {
+			t.Fatal("results between aren't inclusive:", between, err)
+		}
+
+		latest, err := s.GetLatestResultPerItem(ctx, host)
+		if err != nil || len(latest.Results) != 2 || latest.Results[0].ItemID != cpu || latest.Results[0].ValueNumeric != 2 {
+			t.Fatal("latest results:", latest, err)
+		}
+	}},
+	{"expire silence", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		newSilence := func(Start time.Time, End time.Time) models.Silence {
+			silence, err := s.CreateSilence(ctx, models.Silence{Matchers: []models.Matcher{{Field: models.MatchSeverity, Value: "HIGH"}}, Start: Start, End: End, CreatedBy: "test"})
+			if err != nil {
+				t.Fatal("create silence:", err)
+			}
+			return silence
+		}
+		now := time.Now()
+		running := newSilence(now.Add(-time.Hour), now.Add(time.Hour))
+		upcoming := newSilence(now.Add(time.Hour), now.Add(2*time.Hour))
+		expired := newSilence(now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+		for _, k := range []models.Silence{running, upcoming, expired} {
+			if err := s.ExpireSilence(ctx, k.ID); err != nil {
+				t.Fatal("expire:", err)
+			}
+		}
+		if err := s.ExpireSilence(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+			t.Fatal("expected ErrNotFound, got", err)
+		}
+
+		silences, err := s.GetAllSilences(ctx)
+		if err != nil {
+			t.Fatal("get silences:", err)
+		}
+		if len(silences) != 2 {
+			t.Fatalf("silence which never started wasn't deleted: %+v", silences)
+		}
+		for _, k := range silences {
+			if err := k.Validate(); err != nil {
+				t.Fatal("expired silence isn't valid:", err)
+			}
+			switch k.ID {
+			case running.ID:
+				if k.End.After(time.Now()) || k.End.Before(now.Truncate(time.Millisecond)) {
+					t.Fatal("running silence wasn't ended:", k.End)
+				}
+			case expired.ID:
+				if !k.End.Equal(expired.End.Truncate(time.Millisecond)) && !k.End.Equal(expired.End) {
+					t.Fatal("expired silence was changed:", k.End)
+				}
+			}
+		}
+	}},
+	{"fenced results", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		agent := mustCreateAgent(t, ctx, s, "web1")
+		item := primitive.NewObjectID()
+		result := func(CapturedAt time.Time, Value float64) models.Result {
+			return models.Result{ItemID: item, HostID: agent.ID, Type: models.Numeric, CapturedAt: CapturedAt, ValueNumeric: Value}
+		}
+
+		old, err := s.AcquireScraperLease(ctx, agent.ID, uuid.New(), time.Minute)
+		if err != nil {
+			t.Fatal("acquire:", err)
+		}
+		before := time.Now().Add(-time.Second)
+		if err := s.ReleaseScraperLease(ctx, agent.ID, old); err != nil {
+			t.Fatal("release:", err)
+		}
+		current, err := s.AcquireScraperLease(ctx, agent.ID, uuid.New(), time.Minute)
+		if err != nil {
+			t.Fatal("acquire:", err)
+		}
+
+		if _, err := s.InsertResultsFenced(ctx, agent.ID, old.Token, []models.Result{result(time.Now(), 0)}); !errors.Is(err, ErrStaleToken) {
+			t.Fatal("expected ErrStaleToken, got", err)
+		}
+		stored, err := s.InsertResultsFenced(ctx, agent.ID, current.Token, []models.Result{result(time.Now(), 1)})
+		if err != nil || len(stored) != 1 || stored[0].FencingToken != current.Token {
+			t.Fatal("results weren't stored with the fencing token:", stored, err)
+		}
+
+		//The old scraper lost its lease while storing the result, results it captured before are still valid
+		stale := result(time.Now().Add(time.Second), 2)
+		stale.FencingToken = old.Token
+		valid := result(before, 3)
+		valid.FencingToken = old.Token
+		put(t, s, stale, valid)
+
+		last, err := s.GetLastResults(ctx, item, agent.ID, 0)
+		if err != nil || len(last.Results) != 2 || last.Results[0].ValueNumeric != 1 || last.Results[1].ValueNumeric != 3 {
+			t.Fatal("stale results weren't hidden:", last, err)
+		}
+		between, err := s.GetResultsBetween(ctx, item, agent.ID, before, time.Now().Add(time.Minute))
+		if err != nil || len(between.Results) != 2 {
+			t.Fatal("stale results weren't hidden:", between, err)
+		}
+		latest, err := s.GetLatestResultPerItem(ctx, agent.ID)
+		if err != nil || len(latest.Results) != 1 || latest.Results[0].ValueNumeric != 1 {
+			t.Fatal("stale results weren't hidden:", latest, err)
+		}
+	}},
+	{"canceled context", func(t *testing.T, ctx context.Context, s conformanceStore) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := s.GetAllAgents(canceled); err == nil {
+			t.Fatal("canceled context was ignored")
+		}
+	}},
+}
+
+func TestStoreConformance(t *testing.T) {
+	stores := map[string]func(t *testing.T) conformanceStore{
+		"memory": func(t *testing.T) conformanceStore { return NewMemoryStore() },
+	}
+	if uri := os.Getenv(mongoURIEnv); uri != "" {
+		stores["mongo"] = func(t *testing.T) conformanceStore { return newTestMongoStore(t, uri) }
+	}
+
+	for name, newStore := range stores {
+		for _, k := range conformanceCases {
+			k := k
+			t.Run(name+"/"+k.name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+
+				k.run(t, ctx, newStore(t))
+			})
+		}
+	}
+}
+
+//newTestMongoStore returns a MongoStore using a new database, which is dropped when the test finishes
+func newTestMongoStore(t *testing.T, URI string) conformanceStore {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(URI))
+	if err != nil {
+		t.Fatal("couldn't connect to mongodb:", err)
+	}
+
+	database := client.Database("flowutils_conformance_" + primitive.NewObjectID().Hex())
+	if err := EnsureIndexesContext(ctx, database); err != nil {
+		t.Fatal("couldn't create indexes:", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	return NewMongoStore(database)
+}
+
+func mustCreateItem(t *testing.T, ctx context.Context, s conformanceStore, Name string) models.Item {
+	t.Helper()
+
+	item, err := s.CreateItem(ctx, fixtures.Item(Name))
+	if err != nil {
+		t.Fatal("create item:", err)
+	}
+
+	return item
+}
+
+func mustCreateTrigger(t *testing.T, ctx context.Context, s conformanceStore, Name string, DependsOn []primitive.ObjectID) models.Trigger {
+	t.Helper()
+
+	trigger := fixtures.Trigger(Name)
+	if DependsOn != nil {
+		trigger.DependsOn = DependsOn
+	}
+
+	trigger, err := s.CreateTrigger(ctx, trigger)
+	if err != nil {
+		t.Fatal("create trigger:", err)
+	}
+
+	return trigger
+}
+
+func mustCreateTemplate(t *testing.T, ctx context.Context, s conformanceStore, Template models.Template) models.Template {
+	t.Helper()
+
+	template, err := s.CreateTemplate(ctx, Template)
+	if err != nil {
+		t.Fatal("create template:", err)
+	}
+
+	return template
+}
+
+func mustCreateAgent(t *testing.T, ctx context.Context, s conformanceStore, Name string, TemplateIDs ...primitive.ObjectID) models.Agent {
+	t.Helper()
+
+	agent := fixtures.Agent(Name)
+	agent.TemplateIDs = append(agent.TemplateIDs, TemplateIDs...)
+
+	agent, err := s.CreateAgent(ctx, agent)
+	if err != nil {
+		t.Fatal("create agent:", err)
+	}
+
+	return agent
+}
+
+//put stores the documents as they are, so the read functions can be tested without the write functions of the store
+func put(t *testing.T, s conformanceStore, Documents ...interface{}) {
+	t.Helper()
+
+	for _, k := range Documents {
+		switch store := s.(type) {
+		case *MemoryStore:
+			switch document := k.(type) {
+			case models.Agent:
+				store.PutAgent(document)
+			case models.Template:
+				store.PutTemplate(document)
+			case models.Item:
+				store.PutItem(document)
+			case models.Trigger:
+				store.PutTrigger(document)
+			case models.Result:
+				store.PutResult(document)
+			default:
+				t.Fatalf("can't put %T", k)
+			}
+		case MongoStore:
+			if _, err := store.Client.Collection(collectionOf(t, k)).InsertOne(context.Background(), k); err != nil {
+				t.Fatal("couldn't insert document:", err)
+			}
+		}
+	}
+}
+
+func collectionOf(t *testing.T, Document interface{}) string {
+	switch Document.(type) {
+	case models.Agent:
+		return "agents"
+	case models.Template:
+		return "templates"
+	case models.Item:
+		return "items"
+	case models.Trigger:
+		return "triggers"
+	case models.Result:
+		return "results"
+	}
+
+	t.Fatalf("no collection for %T", Document)
+	return ""
+}
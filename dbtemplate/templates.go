@@ -2,7 +2,6 @@ package dbtemplate
 
 import (
 	"context"
-	"time"
 
 	"github.com/FlowKeeper/FlowUtils/v2/models"
 	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
@@ -15,23 +14,33 @@ import (
 //If a template id isn't found in the database, no error is caused
 //Instead the missing template is omitted from the returned item slice
 func GetTemplates(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Template, error) {
+	return GetTemplatesContext(context.Background(), Client, IDs)
+}
+
+//GetTemplatesContext returns one or multiple template structs for the specified IDs
+//If a template id isn't found in the database, no error is caused
+//Instead the missing template is omitted from the returned item slice
+func GetTemplatesContext(ctx context.Context, Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Template, error) {
 	templates := make([]models.Template, 0)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	queryCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
-	result, err := Client.Collection("templates").Find(ctx, bson.M{"_id": bson.M{"$in": IDs}})
+	result, err := Client.Collection("templates").Find(queryCtx, bson.M{"_id": bson.M{"$in": IDs}})
 
 	if err != nil {
 		logger.Error(loggingArea, "Couldn't read template:", err)
 		return templates, err
 	}
 
-	if err := result.All(ctx, &templates); err != nil {
+	if err := result.All(queryCtx, &templates); err != nil {
 		logger.Error(loggingArea, "Couldn't decode template array:", err)
 	}
 
+	store := NewMongoStore(Client)
 	for i := range templates {
-		populateTemplateFields(Client, &templates[i])
+		if err := populateTemplateFields(ctx, store, &templates[i]); err != nil {
+			return templates, err
+		}
 	}
 
 	return templates, nil
@@ -39,29 +48,132 @@ func GetTemplates(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Te
 
 //GetAllTemplates returns all templates from the datbase
 func GetAllTemplates(Client *mongo.Database) ([]models.Template, error) {
+	return GetAllTemplatesContext(context.Background(), Client)
+}
+
+//GetAllTemplatesContext returns all templates from the datbase
+func GetAllTemplatesContext(ctx context.Context, Client *mongo.Database) ([]models.Template, error) {
 	templates := make([]models.Template, 0)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	queryCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
-	result, err := Client.Collection("templates").Find(ctx, bson.M{})
+	result, err := Client.Collection("templates").Find(queryCtx, bson.M{})
 
 	if err != nil {
 		logger.Error(loggingArea, "Couldn't read template:", err)
 		return templates, err
 	}
 
-	if err := result.All(ctx, &templates); err != nil {
+	if err := result.All(queryCtx, &templates); err != nil {
 		logger.Error(loggingArea, "Couldn't decode template array:", err)
 	}
 
+	store := NewMongoStore(Client)
 	for i := range templates {
-		populateTemplateFields(Client, &templates[i])
+		if err := populateTemplateFields(ctx, store, &templates[i]); err != nil {
+			return templates, err
+		}
 	}
 
 	return templates, nil
 }
 
-func populateTemplateFields(Client *mongo.Database, Template *models.Template) {
+//CreateTemplate validates and persists a new template
+//The returned template contains the generated ID
+func CreateTemplate(Client *mongo.Database, Template models.Template) (models.Template, error) {
+	return CreateTemplateContext(context.Background(), Client, Template)
+}
+
+//CreateTemplateContext validates and persists a new template
+//The returned template contains the generated ID
+func CreateTemplateContext(ctx context.Context, Client *mongo.Database, Template models.Template) (models.Template, error) {
+	if err := Template.Validate(); err != nil {
+		return models.Template{}, err
+	}
+
+	Template.ID = primitive.NewObjectID()
+	fixTemplateArrays(&Template)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("templates").InsertOne(ctx, Template); err != nil {
+		logger.Error(loggingArea, "Couldn't insert template:", err)
+		return models.Template{}, err
+	}
+
+	return Template, nil
+}
+
+//UpdateTemplate validates and persists the changes of an existing template
+func UpdateTemplate(Client *mongo.Database, Template models.Template) error {
+	return UpdateTemplateContext(context.Background(), Client, Template)
+}
+
+//UpdateTemplateContext validates and persists the changes of an existing template
+func UpdateTemplateContext(ctx context.Context, Client *mongo.Database, Template models.Template) error {
+	if err := Template.Validate(); err != nil {
+		return err
+	}
+
+	fixTemplateArrays(&Template)
+
+	return replaceDocument(ctx, Client.Collection("templates"), Template.ID, Template)
+}
+
+//DeleteTemplate removes the specified template and unlinks it from all agents, auto registration rules, maintenances, notification rules and escalation policies
+//Rules and policies which were only scoped to / only linked the template are disabled, as they would otherwise match every agent / have no action left
+//References are removed before the template itself, so a failed cleanup can be retried by calling DeleteTemplate again
+func DeleteTemplate(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteTemplateContext(context.Background(), Client, ID)
+}
+
+//DeleteTemplateContext removes the specified template and unlinks it from all agents, auto registration rules, maintenances, notification rules and escalation policies
+//Rules and policies which were only scoped to / only linked the template are disabled, as they would otherwise match every agent / have no action left
+//References are removed before the template itself, so a failed cleanup can be retried by calling DeleteTemplate again
+func DeleteTemplateContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	only := bson.A{ID}
+	if err := disableDocuments(ctx, Client.Collection("notificationrules"), bson.M{"templateids": only}); err != nil {
+		return err
+	}
+	if err := disableDocuments(ctx, Client.Collection("escalationpolicies"), bson.M{"templateids": only}); err != nil {
+		return err
+	}
+	if err := disableDocuments(ctx, Client.Collection("autoregistrationrules"), bson.M{
+		"templateids":    only,
+		"scrapeinterval": bson.M{"$lte": 0},
+		"$or": []bson.M{
+			{"tags": nil},
+			{"tags": bson.M{"$size": 0}},
+		},
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range []struct{ collection, field string }{
+		{"agents", "templateids"},
+		{"autoregistrationrules", "templateids"},
+		{"maintenances", "scope.templateids"},
+		{"notificationrules", "templateids"},
+		{"escalationpolicies", "templateids"},
+	} {
+		if err := pullReferences(ctx, Client.Collection(k.collection), k.field, ID); err != nil {
+			return err
+		}
+	}
+
+	return deleteDocument(ctx, Client.Collection("templates"), ID)
+}
+
+func fixTemplateArrays(Template *models.Template) {
+	if Template.ItemIDs == nil {
+		Template.ItemIDs = make([]primitive.ObjectID, 0)
+	}
+	if Template.TriggerIDs == nil {
+		Template.TriggerIDs = make([]primitive.ObjectID, 0)
+	}
+}
+
+func populateTemplateFields(ctx context.Context, Store Store, Template *models.Template) error {
 	//Ensure all arrays != nil
 	if Template.ItemIDs == nil {
 		Template.ItemIDs = make([]primitive.ObjectID, 0)
@@ -78,15 +190,19 @@ func populateTemplateFields(Client *mongo.Database, Template *models.Template) {
 
 	var err error
 	if len(Template.ItemIDs) > 0 {
-		Template.Items, err = GetItems(Client, Template.ItemIDs)
+		Template.Items, err = Store.GetItems(ctx, Template.ItemIDs)
 		if err != nil {
 			logger.Error(loggingArea, "Couldn't get items for template", Template.ID, ":", err)
+			return err
 		}
 	}
 	if len(Template.TriggerIDs) > 0 {
-		Template.Triggers, err = GetTriggers(Client, Template.TriggerIDs)
+		Template.Triggers, err = Store.GetTriggers(ctx, Template.TriggerIDs)
 		if err != nil {
 			logger.Error(loggingArea, "Couldn't get triggers for template", Template.ID, ":", err)
+			return err
 		}
 	}
+
+	return nil
 }
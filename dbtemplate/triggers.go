@@ -3,8 +3,10 @@ package dbtemplate
 import (
 	"context"
 	"errors"
-	"time"
+	"fmt"
 
+	"github.com/FlowKeeper/FlowUtils/v2/dependency"
+	"github.com/FlowKeeper/FlowUtils/v2/expression"
 	"github.com/FlowKeeper/FlowUtils/v2/models"
 	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,7 +16,12 @@ import (
 
 //GetTrigger gets the appropriate trigger which matches the specified ID
 func GetTrigger(Client *mongo.Database, ID primitive.ObjectID) (models.Trigger, error) {
-	triggers, err := GetTriggers(Client, []primitive.ObjectID{ID})
+	return GetTriggerContext(context.Background(), Client, ID)
+}
+
+//GetTriggerContext gets the appropriate trigger which matches the specified ID
+func GetTriggerContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) (models.Trigger, error) {
+	triggers, err := GetTriggersContext(ctx, Client, []primitive.ObjectID{ID})
 	if err != nil {
 		return models.Trigger{}, err
 	}
@@ -28,7 +35,12 @@ func GetTrigger(Client *mongo.Database, ID primitive.ObjectID) (models.Trigger,
 
 //GetTriggerByName gets the appropriate trigger which matches the specified Name
 func GetTriggerByName(Client *mongo.Database, Name string) (models.Trigger, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return GetTriggerByNameContext(context.Background(), Client, Name)
+}
+
+//GetTriggerByNameContext gets the appropriate trigger which matches the specified Name
+func GetTriggerByNameContext(ctx context.Context, Client *mongo.Database, Name string) (models.Trigger, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
 	result := Client.Collection("triggers").FindOne(ctx, bson.M{"name": Name})
 
@@ -53,9 +65,16 @@ func GetTriggerByName(Client *mongo.Database, Name string) (models.Trigger, erro
 //If a trigger id isn't found in the database, no error is caused
 //Instead the missing trigger is omitted from the returned item slice
 func GetTriggers(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Trigger, error) {
+	return GetTriggersContext(context.Background(), Client, IDs)
+}
+
+//GetTriggersContext returns one or multiple trigger structs for the specified IDs
+//If a trigger id isn't found in the database, no error is caused
+//Instead the missing trigger is omitted from the returned item slice
+func GetTriggersContext(ctx context.Context, Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Trigger, error) {
 	triggers := make([]models.Trigger, 0)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
 	defer cancel()
 	result, err := Client.Collection("triggers").Find(ctx, bson.M{"_id": bson.M{"$in": IDs}})
 
@@ -70,3 +89,173 @@ func GetTriggers(Client *mongo.Database, IDs []primitive.ObjectID) ([]models.Tri
 
 	return triggers, nil
 }
+
+//GetAllTriggers returns all triggers from the database
+func GetAllTriggers(Client *mongo.Database) ([]models.Trigger, error) {
+	return GetAllTriggersContext(context.Background(), Client)
+}
+
+//GetAllTriggersContext returns all triggers from the database
+func GetAllTriggersContext(ctx context.Context, Client *mongo.Database) ([]models.Trigger, error) {
+	triggers := make([]models.Trigger, 0)
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	result, err := Client.Collection("triggers").Find(ctx, bson.M{})
+
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't read triggers:", err)
+		return triggers, err
+	}
+
+	if err := result.All(ctx, &triggers); err != nil {
+		logger.Error(loggingArea, "Couldn't decode trigger array:", err)
+	}
+
+	return triggers, nil
+}
+
+//CreateTrigger validates and persists a new trigger
+//The returned trigger contains the generated ID
+func CreateTrigger(Client *mongo.Database, Trigger models.Trigger) (models.Trigger, error) {
+	return CreateTriggerContext(context.Background(), Client, Trigger)
+}
+
+//CreateTriggerContext validates and persists a new trigger
+//The returned trigger contains the generated ID
+func CreateTriggerContext(ctx context.Context, Client *mongo.Database, Trigger models.Trigger) (models.Trigger, error) {
+	if err := validateTrigger(Trigger); err != nil {
+		return models.Trigger{}, err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("triggers"), Trigger.Name, primitive.NilObjectID); err != nil {
+		return models.Trigger{}, err
+	}
+
+	Trigger.ID = primitive.NewObjectID()
+	if Trigger.DependsOn == nil {
+		Trigger.DependsOn = make([]primitive.ObjectID, 0)
+	}
+
+	if err := checkTriggerDependenciesInDB(ctx, Client, Trigger); err != nil {
+		return models.Trigger{}, err
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("triggers").InsertOne(ctx, Trigger); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Trigger{}, ErrNameInUse
+		}
+
+		logger.Error(loggingArea, "Couldn't insert trigger:", err)
+		return models.Trigger{}, err
+	}
+
+	return Trigger, nil
+}
+
+//UpdateTrigger validates and persists the changes of an existing trigger
+func UpdateTrigger(Client *mongo.Database, Trigger models.Trigger) error {
+	return UpdateTriggerContext(context.Background(), Client, Trigger)
+}
+
+//UpdateTriggerContext validates and persists the changes of an existing trigger
+func UpdateTriggerContext(ctx context.Context, Client *mongo.Database, Trigger models.Trigger) error {
+	if err := validateTrigger(Trigger); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueName(ctx, Client.Collection("triggers"), Trigger.Name, Trigger.ID); err != nil {
+		return err
+	}
+
+	if Trigger.DependsOn == nil {
+		Trigger.DependsOn = make([]primitive.ObjectID, 0)
+	}
+
+	if err := checkTriggerDependenciesInDB(ctx, Client, Trigger); err != nil {
+		return err
+	}
+
+	return replaceDocument(ctx, Client.Collection("triggers"), Trigger.ID, Trigger)
+}
+
+//DeleteTrigger removes the specified trigger
+//The trigger is also unlinked from all templates, dependent triggers and agents (trigger assignments)
+//References are removed before the trigger itself, so a failed cleanup can be retried by calling DeleteTrigger again
+func DeleteTrigger(Client *mongo.Database, ID primitive.ObjectID) error {
+	return DeleteTriggerContext(context.Background(), Client, ID)
+}
+
+//DeleteTriggerContext removes the specified trigger
+//The trigger is also unlinked from all templates, dependent triggers and agents (trigger assignments)
+//References are removed before the trigger itself, so a failed cleanup can be retried by calling DeleteTrigger again
+func DeleteTriggerContext(ctx context.Context, Client *mongo.Database, ID primitive.ObjectID) error {
+	if err := pullReferences(ctx, Client.Collection("templates"), "triggerids", ID); err != nil {
+		return err
+	}
+
+	if err := pullReferences(ctx, Client.Collection("triggers"), "dependson", ID); err != nil {
+		return err
+	}
+
+	pullCtx, cancel := withDefaultTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	if _, err := Client.Collection("agents").UpdateMany(pullCtx, bson.M{"triggermappings.triggerid": ID}, bson.M{"$pull": bson.M{"triggermappings": bson.M{"triggerid": ID}}}); err != nil {
+		logger.Error(loggingArea, "Couldn't remove trigger assignments of deleted trigger:", err)
+		return err
+	}
+
+	return deleteDocument(ctx, Client.Collection("triggers"), ID)
+}
+
+//validateTrigger checks the trigger fields and the syntax of the expression
+func validateTrigger(Trigger models.Trigger) error {
+	if err := Trigger.Validate(); err != nil {
+		return err
+	}
+
+	return expression.Validate(Trigger.Expression)
+}
+
+func checkTriggerDependenciesInDB(ctx context.Context, Client *mongo.Database, Trigger models.Trigger) error {
+	if len(Trigger.DependsOn) == 0 {
+		return nil
+	}
+
+	existing, err := GetAllTriggersContext(ctx, Client)
+	if err != nil {
+		return err
+	}
+
+	return checkTriggerDependencies(Trigger, existing)
+}
+
+//checkTriggerDependencies returns an error if the trigger depends on unknown triggers or if storing it would create a dependency cycle
+//Depending on models.UnreachableTriggerID is always allowed
+func checkTriggerDependencies(Trigger models.Trigger, Existing []models.Trigger) error {
+	if len(Trigger.DependsOn) == 0 {
+		return nil
+	}
+
+	triggers := make([]models.Trigger, 0, len(Existing)+1)
+	//The synthetic unreachable trigger isn't stored, but can be depended on
+	known := map[primitive.ObjectID]bool{models.UnreachableTriggerID: true}
+	for _, k := range Existing {
+		known[k.ID] = true
+		if k.ID != Trigger.ID {
+			triggers = append(triggers, k)
+		}
+	}
+	triggers = append(triggers, Trigger)
+
+	for _, k := range Trigger.DependsOn {
+		if !known[k] {
+			return fmt.Errorf("trigger depends on unknown trigger %s", k.Hex())
+		}
+	}
+
+	_, err := dependency.Build(triggers)
+	return err
+}
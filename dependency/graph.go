@@ -0,0 +1,202 @@
+package dependency
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//CycleError is returned if the DependsOn fields of the triggers form a cycle
+type CycleError struct {
+	//Path contains the IDs of the triggers forming the cycle, the first ID is repeated at the end
+	Path []primitive.ObjectID
+}
+
+func (e CycleError) Error() string {
+	ids := make([]string, len(e.Path))
+	for i, k := range e.Path {
+		ids[i] = k.Hex()
+	}
+
+	return fmt.Sprintf("trigger dependencies form a cycle: %s", strings.Join(ids, " -> "))
+}
+
+//Graph stores the dependencies (DependsOn) between a set of triggers
+//Dependencies on triggers which aren't part of the graph are kept, but don't influence the evaluation order
+type Graph struct {
+	triggers map[primitive.ObjectID]models.Trigger
+	order    []primitive.ObjectID
+}
+
+//Build builds the dependency graph for the specified triggers
+//A CycleError is returned if the dependencies contain a cycle
+func Build(Triggers []models.Trigger) (*Graph, error) {
+	g := &Graph{
+		triggers: make(map[primitive.ObjectID]models.Trigger),
+		order:    make([]primitive.ObjectID, 0, len(Triggers)),
+	}
+
+	for _, k := range Triggers {
+		g.triggers[k.ID] = k
+	}
+
+	//Depth first search in a stable order, so that the evaluation order is deterministic
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[primitive.ObjectID]int)
+	stack := make([]primitive.ObjectID, 0)
+
+	var visit func(ID primitive.ObjectID) error
+	visit = func(ID primitive.ObjectID) error {
+		switch state[ID] {
+		case visited:
+			return nil
+		case visiting:
+			for i, k := range stack {
+				if k == ID {
+					path := append(append(make([]primitive.ObjectID, 0), stack[i:]...), ID)
+					return CycleError{Path: path}
+				}
+			}
+		}
+
+		state[ID] = visiting
+		stack = append(stack, ID)
+
+		for _, parent := range sortedIDs(g.triggers[ID].DependsOn) {
+			if _, known := g.triggers[parent]; !known {
+				continue
+			}
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[ID] = visited
+		g.order = append(g.order, ID)
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(g.triggers))
+	for id := range g.triggers {
+		ids = append(ids, id)
+	}
+
+	for _, id := range sortedIDs(ids) {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+//ForAgent builds the dependency graph for all triggers assigned to the agent
+//The agent has to be populated (Templates have to be set)
+func ForAgent(Agent models.Agent) (*Graph, error) {
+	return Build(Agent.GetAllTriggers())
+}
+
+//Order returns all triggers of the graph in evaluation order
+//Every trigger is returned after all the triggers it depends on
+func (g *Graph) Order() []models.Trigger {
+	triggers := make([]models.Trigger, len(g.order))
+	for i, k := range g.order {
+		triggers[i] = g.triggers[k]
+	}
+
+	return triggers
+}
+
+//Ancestors returns the IDs of all triggers the specified trigger depends on (directly or transitively)
+func (g *Graph) Ancestors(ID primitive.ObjectID) []primitive.ObjectID {
+	ancestors := make([]primitive.ObjectID, 0)
+	seen := map[primitive.ObjectID]bool{ID: true}
+
+	queue := append(make([]primitive.ObjectID, 0), g.triggers[ID].DependsOn...)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		ancestors = append(ancestors, current)
+
+		if trigger, known := g.triggers[current]; known {
+			queue = append(queue, trigger.DependsOn...)
+		}
+	}
+
+	return ancestors
+}
+
+//IsSuppressed returns true if any trigger the specified trigger depends on is problematic
+//Problematic contains the problem state of the triggers, missing triggers are regarded as unproblematic
+func (g *Graph) IsSuppressed(ID primitive.ObjectID, Problematic map[primitive.ObjectID]bool) bool {
+	for _, k := range g.Ancestors(ID) {
+		if Problematic[k] {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Suppressed returns the IDs of all triggers of the graph which are suppressed by a problematic parent
+func (g *Graph) Suppressed(Problematic map[primitive.ObjectID]bool) map[primitive.ObjectID]bool {
+	suppressed := make(map[primitive.ObjectID]bool)
+	for _, k := range g.order {
+		if g.IsSuppressed(k, Problematic) {
+			suppressed[k] = true
+		}
+	}
+
+	return suppressed
+}
+
+//ProblemStates returns the problem state of all trigger assignments of the agent
+//The synthetic unreachable trigger (models.UnreachableTriggerID) is problematic while the agent is offline, so triggers depending on it are suppressed
+func ProblemStates(Agent models.Agent) map[primitive.ObjectID]bool {
+	states := map[primitive.ObjectID]bool{models.UnreachableTriggerID: Agent.Unreachable()}
+	for _, k := range Agent.TriggerMappings {
+		states[k.TriggerID] = k.Problematic
+	}
+
+	return states
+}
+
+//ReportableProblems returns all problematic trigger assignments of the agent, which aren't suppressed by a problematic parent
+//The agent has to be populated (Templates have to be set)
+func ReportableProblems(Agent models.Agent) ([]models.TriggerAssignment, error) {
+	g, err := ForAgent(Agent)
+	if err != nil {
+		return nil, err
+	}
+
+	suppressed := g.Suppressed(ProblemStates(Agent))
+	problems := make([]models.TriggerAssignment, 0)
+	for _, k := range Agent.ProblematicTriggers() {
+		if !suppressed[k.TriggerID] {
+			problems = append(problems, k)
+		}
+	}
+
+	return problems, nil
+}
+
+func sortedIDs(IDs []primitive.ObjectID) []primitive.ObjectID {
+	sorted := append(make([]primitive.ObjectID, 0, len(IDs)), IDs...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	return sorted
+}
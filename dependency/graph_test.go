@@ -0,0 +1,128 @@
+package dependency
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//chain returns triggers where every trigger depends on the previous one
+func chain(Names ...string) []models.Trigger {
+	triggers := make([]models.Trigger, 0, len(Names))
+	for i, k := range Names {
+		trigger := fixtures.Trigger(k)
+		if i > 0 {
+			trigger.DependsOn = []primitive.ObjectID{triggers[i-1].ID}
+		}
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers
+}
+
+func TestBuildOrder(t *testing.T) {
+	triggers := chain("router", "switch", "server")
+	unrelated := fixtures.Trigger("disk full")
+	//Dependencies on triggers which aren't part of the graph are ignored
+	unrelated.DependsOn = []primitive.ObjectID{primitive.NewObjectID()}
+
+	//Reverse the input, the order mustn't depend on it
+	g, err := Build([]models.Trigger{triggers[2], unrelated, triggers[1], triggers[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	position := make(map[primitive.ObjectID]int)
+	for i, k := range g.Order() {
+		position[k.ID] = i
+	}
+	if len(position) != 4 {
+		t.Fatal("got", len(position), "triggers")
+	}
+	for _, k := range triggers[1:] {
+		if position[k.DependsOn[0]] > position[k.ID] {
+			t.Fatalf("%s is ordered before its parent", k.Name)
+		}
+	}
+}
+
+func TestBuildCycle(t *testing.T) {
+	cases := []struct {
+		name   string
+		length int
+	}{
+		{"self", 1},
+		{"pair", 2},
+		{"long", 4},
+	}
+
+	for _, k := range cases {
+		t.Run(k.name, func(t *testing.T) {
+			triggers := chain("a", "b", "c", "d")[:k.length]
+			triggers[0].DependsOn = []primitive.ObjectID{triggers[k.length-1].ID}
+			//A trigger depending on the cycle isn't part of it
+			outside := fixtures.Trigger("outside")
+			outside.DependsOn = []primitive.ObjectID{triggers[0].ID}
+
+			_, err := Build(append(triggers, outside))
+			var cycle CycleError
+			if !errors.As(err, &cycle) {
+				t.Fatal("cycle wasn't detected:", err)
+			}
+
+			if len(cycle.Path) != k.length+1 || cycle.Path[0] != cycle.Path[len(cycle.Path)-1] {
+				t.Fatal("path doesn't describe the cycle:", cycle.Path)
+			}
+			members := make(map[primitive.ObjectID]bool)
+			for _, id := range cycle.Path {
+				members[id] = true
+			}
+			if len(members) != k.length || members[outside.ID] {
+				t.Fatal("path contains the wrong triggers:", cycle.Path)
+			}
+			if cycle.Error() == "" {
+				t.Fatal("cycle error has no message")
+			}
+		})
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	triggers := chain("router", "switch", "server")
+	g, err := Build(triggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ancestors := g.Ancestors(triggers[2].ID); len(ancestors) != 2 {
+		t.Fatal("transitive parents weren't returned:", ancestors)
+	}
+
+	suppressed := g.Suppressed(map[primitive.ObjectID]bool{triggers[0].ID: true, triggers[2].ID: true})
+	if suppressed[triggers[0].ID] || !suppressed[triggers[1].ID] || !suppressed[triggers[2].ID] {
+		t.Fatal("unexpected suppressed triggers:", suppressed)
+	}
+	if g.IsSuppressed(triggers[2].ID, map[primitive.ObjectID]bool{triggers[2].ID: true}) {
+		t.Fatal("trigger is suppressed by itself")
+	}
+}
+
+func TestReportableProblems(t *testing.T) {
+	triggers := chain("router", "server")
+	agent := fixtures.Agent("web1", fixtures.Template("network", nil, triggers))
+	agent.TriggerMappings = []models.TriggerAssignment{
+		{TriggerID: triggers[0].ID, Enabled: true, Problematic: true},
+		{TriggerID: triggers[1].ID, Enabled: true, Problematic: true},
+	}
+
+	problems, err := ReportableProblems(agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].TriggerID != triggers[0].ID {
+		t.Fatal("only the problem of the parent should be reported:", problems)
+	}
+}
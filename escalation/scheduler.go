@@ -0,0 +1,198 @@
+package escalation
+
+import (
+	"context"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/clock"
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/FlowKeeper/FlowUtils/v2/notification"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const loggingArea = "ESCALATION"
+
+//Store is used to load the escalation policies, the trigger events the problems started with and the already sent notifications
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type Store interface {
+	GetAllEscalationPolicies(ctx context.Context) ([]models.EscalationPolicy, error)
+	GetTriggerEvents(ctx context.Context, Filter dbtemplate.TriggerEventFilter) ([]models.TriggerEvent, error)
+	GetDeliveries(ctx context.Context, Filter dbtemplate.DeliveryFilter) ([]models.Delivery, error)
+}
+
+//Sender sends the escalation notifications
+//It is implemented by notification.Dispatcher
+type Sender interface {
+	SendTo(ctx context.Context, Notification notification.Notification, Channels []string, Prototype models.Delivery) ([]models.Delivery, error)
+}
+
+//Scheduler sends the notifications of the escalation policies for all unacknowledged problems
+//It doesn't keep any state, already sent notifications are looked up in the delivery log
+type Scheduler struct {
+	Store  Store
+	Sender Sender
+	Clock  clock.Clock
+}
+
+//NewScheduler returns a scheduler using the clock.SystemClock
+func NewScheduler(Store Store, Sender Sender) *Scheduler {
+	return &Scheduler{
+		Store:  Store,
+		Sender: Sender,
+		Clock:  clock.SystemClock,
+	}
+}
+
+//Pending is a single escalation notification which is due
+type Pending struct {
+	Agent        models.Agent
+	Trigger      models.Trigger
+	Event        models.TriggerEvent
+	Policy       models.EscalationPolicy
+	Notification models.EscalationNotification
+}
+
+//Due returns all escalation notifications which are due and weren't sent yet as well as the time the next notification becomes due (zero if there is none)
+//Acknowledged, resolved and suppressed problems aren't escalated, the agents have to be populated
+func (s *Scheduler) Due(ctx context.Context, Agents []models.Agent, Options models.ProblemOptions) ([]Pending, time.Time, error) {
+	now := s.Clock.Now()
+	Options.At = now
+
+	policies, err := s.Store.GetAllEscalationPolicies(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	due := make([]Pending, 0)
+	var next time.Time
+
+	for _, agent := range Agents {
+		for _, problem := range agent.Problems(Options) {
+			if problem.Suppressed() || problem.Assignment.Acknowledged {
+				continue
+			}
+
+			trigger, err := agent.GetTrigger(problem.Assignment.TriggerID)
+			if err != nil {
+				logger.Error(loggingArea, "Couldn't find trigger", problem.Assignment.TriggerID.Hex(), "on agent", agent.Name, ":", err)
+				continue
+			}
+
+			severity := problem.Assignment.EffectiveSeverity(trigger)
+			matching := make([]models.EscalationPolicy, 0)
+			for _, k := range policies {
+				if k.Matches(agent, trigger.ID, severity) {
+					matching = append(matching, k)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+
+			//The newest event of the assignment is the start of the current problem
+			events, err := s.Store.GetTriggerEvents(ctx, dbtemplate.TriggerEventFilter{
+				AgentIDs:   []primitive.ObjectID{agent.ID},
+				TriggerIDs: []primitive.ObjectID{trigger.ID},
+				Limit:      1,
+			})
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			if len(events) == 0 || !events[0].Problematic {
+				continue
+			}
+			event := events[0]
+
+			sent, err := s.sentNotifications(ctx, event.ID)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+
+			for _, policy := range matching {
+				//Only the newest due notification of every step is sent, so missed repetitions (e.g. during a downtime of the scheduler) aren't sent in a burst
+				latest := make(map[int]models.EscalationNotification)
+				for _, k := range policy.Timeline(event.Time) {
+					if k.Due.After(now) {
+						if next.IsZero() || k.Due.Before(next) {
+							next = k.Due
+						}
+						continue
+					}
+
+					latest[k.Step] = k
+				}
+
+				for step := range policy.Steps {
+					k, found := latest[step]
+					if !found || sent[sentKey{policy: policy.ID, step: k.Step, repetition: k.Repetition}] {
+						continue
+					}
+
+					due = append(due, Pending{
+						Agent:        agent,
+						Trigger:      trigger,
+						Event:        event,
+						Policy:       policy,
+						Notification: k,
+					})
+				}
+			}
+		}
+	}
+
+	return due, next, nil
+}
+
+//Tick sends all escalation notifications which are due
+//It should be called periodically, the time returned by Due can be used to sleep until the next notification is due
+func (s *Scheduler) Tick(ctx context.Context, Agents []models.Agent, Options models.ProblemOptions) ([]models.Delivery, error) {
+	due, _, err := s.Due(ctx, Agents, Options)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]models.Delivery, 0)
+	for _, k := range due {
+		sent, err := s.Sender.SendTo(ctx, notification.Notification{
+			Agent:   k.Agent,
+			Trigger: k.Trigger,
+			Event:   k.Event,
+		}, k.Notification.Channels, models.Delivery{
+			PolicyID:   k.Policy.ID,
+			Step:       k.Notification.Step,
+			Repetition: k.Notification.Repetition,
+		})
+		if err != nil {
+			return deliveries, err
+		}
+
+		deliveries = append(deliveries, sent...)
+	}
+
+	return deliveries, nil
+}
+
+type sentKey struct {
+	policy     primitive.ObjectID
+	step       int
+	repetition int
+}
+
+//sentNotifications returns all escalation notifications which were already sent for the problem
+func (s *Scheduler) sentNotifications(ctx context.Context, EventID primitive.ObjectID) (map[sentKey]bool, error) {
+	deliveries, err := s.Store.GetDeliveries(ctx, dbtemplate.DeliveryFilter{EventIDs: []primitive.ObjectID{EventID}})
+	if err != nil {
+		return nil, err
+	}
+
+	sent := make(map[sentKey]bool)
+	for _, k := range deliveries {
+		if !k.PolicyID.IsZero() {
+			sent[sentKey{policy: k.PolicyID, step: k.Step, repetition: k.Repetition}] = true
+		}
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,227 @@
+package escalation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/clock"
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/FlowKeeper/FlowUtils/v2/notification"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//recordingSender logs every notification in the delivery log of the store instead of sending it
+type recordingSender struct {
+	store *dbtemplate.MemoryStore
+	sent  []models.Delivery
+}
+
+func (r *recordingSender) SendTo(ctx context.Context, Notification notification.Notification, Channels []string, Prototype models.Delivery) ([]models.Delivery, error) {
+	deliveries := make([]models.Delivery, 0, len(Channels))
+	for _, k := range Channels {
+		delivery := Prototype
+		delivery.EventID = Notification.Event.ID
+		delivery.AgentID = Notification.Agent.ID
+		delivery.TriggerID = Notification.Trigger.ID
+		delivery.Channel = k
+		delivery.Status = models.DeliverySent
+
+		delivery, err := r.store.InsertDelivery(ctx, delivery)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	r.sent = append(r.sent, deliveries...)
+	return deliveries, nil
+}
+
+//problemStart is the time the problem of every escalation test started
+var problemStart = time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+type escalationTest struct {
+	store     *dbtemplate.MemoryStore
+	sender    *recordingSender
+	clock     *clock.ManualClock
+	scheduler *Scheduler
+	agent     models.Agent
+	policy    models.EscalationPolicy
+}
+
+//newEscalationTest returns a scheduler and an agent with a HIGH problem, which started at problemStart
+//The policy notifies "oncall" every 5 minutes until "lead" is notified after 10 minutes, which is repeated once after another 10 minutes
+func newEscalationTest(t *testing.T) *escalationTest {
+	store := dbtemplate.NewMemoryStore()
+	manual := clock.NewManualClock(problemStart)
+	sender := &recordingSender{store: store}
+
+	trigger := fixtures.Trigger("disk full")
+	trigger.Severity = models.HIGH
+	template := fixtures.Template("linux", nil, []models.Trigger{trigger})
+	agent := fixtures.Agent("db1", template)
+	agent.TriggerMappings = []models.TriggerAssignment{
+		{TriggerID: trigger.ID, Enabled: true, Problematic: true, ProblemSince: problemStart},
+	}
+
+	if _, err := store.InsertTriggerEvent(context.Background(), models.TriggerEvent{AgentID: agent.ID, TriggerID: trigger.ID, Time: problemStart, Problematic: true, Severity: models.HIGH}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := store.CreateEscalationPolicy(context.Background(), models.EscalationPolicy{
+		Name:    "storage",
+		Enabled: true,
+		Steps: []models.EscalationStep{
+			{Delay: 0, Channels: []string{"oncall"}, Repeat: 5, RepeatInterval: 300},
+			{Delay: 600, Channels: []string{"lead"}, Repeat: 1, RepeatInterval: 600},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewScheduler(store, sender)
+	scheduler.Clock = manual
+
+	return &escalationTest{store: store, sender: sender, clock: manual, scheduler: scheduler, agent: agent, policy: policy}
+}
+
+//tick runs the scheduler and returns the sent notifications
+func (f *escalationTest) tick(t *testing.T, Options models.ProblemOptions) []models.Delivery {
+	t.Helper()
+
+	deliveries, err := f.scheduler.Tick(context.Background(), []models.Agent{f.agent}, Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+func expectSent(t *testing.T, Deliveries []models.Delivery, Expected ...models.Delivery) {
+	t.Helper()
+
+	if len(Deliveries) != len(Expected) {
+		t.Fatalf("sent %d notifications, want %d: %+v", len(Deliveries), len(Expected), Deliveries)
+	}
+	for i, k := range Expected {
+		if Deliveries[i].Step != k.Step || Deliveries[i].Repetition != k.Repetition || Deliveries[i].Channel != k.Channel {
+			t.Fatalf("notification %d is step %d / repetition %d via %s, want step %d / repetition %d via %s", i, Deliveries[i].Step, Deliveries[i].Repetition, Deliveries[i].Channel, k.Step, k.Repetition, k.Channel)
+		}
+	}
+}
+
+func TestSchedulerSteps(t *testing.T) {
+	f := newEscalationTest(t)
+
+	steps := []struct {
+		advance  time.Duration
+		expected []models.Delivery
+	}{
+		{0, []models.Delivery{{Step: 0, Repetition: 0, Channel: "oncall"}}},
+		{4 * time.Minute, nil},
+		{time.Minute, []models.Delivery{{Step: 0, Repetition: 1, Channel: "oncall"}}},
+		//The third repetition of the first step is cut off by the second step
+		{5 * time.Minute, []models.Delivery{{Step: 1, Repetition: 0, Channel: "lead"}}},
+		{5 * time.Minute, nil},
+		{5 * time.Minute, []models.Delivery{{Step: 1, Repetition: 1, Channel: "lead"}}},
+		{time.Hour, nil},
+	}
+
+	for i, k := range steps {
+		f.clock.Advance(k.advance)
+		t.Logf("step %d at %s", i, f.clock.Now().Sub(problemStart))
+		expectSent(t, f.tick(t, models.ProblemOptions{}), k.expected...)
+	}
+
+	for _, k := range f.sender.sent {
+		if k.PolicyID != f.policy.ID {
+			t.Fatal("delivery doesn't reference the policy:", k)
+		}
+	}
+}
+
+func TestSchedulerNoResend(t *testing.T) {
+	f := newEscalationTest(t)
+
+	expectSent(t, f.tick(t, models.ProblemOptions{}), models.Delivery{Step: 0, Repetition: 0, Channel: "oncall"})
+	for i := 0; i < 3; i++ {
+		expectSent(t, f.tick(t, models.ProblemOptions{}))
+	}
+
+	due, next, err := f.scheduler.Due(context.Background(), []models.Agent{f.agent}, models.ProblemOptions{})
+	if err != nil || len(due) != 0 {
+		t.Fatal("logged notification is still due:", due, err)
+	}
+	if !next.Equal(problemStart.Add(5 * time.Minute)) {
+		t.Fatal("next notification is due at", next)
+	}
+}
+
+func TestSchedulerMissedRepetitions(t *testing.T) {
+	f := newEscalationTest(t)
+
+	//Only the newest due notification of every step is sent after a downtime of the scheduler
+	f.clock.Advance(25 * time.Minute)
+	expectSent(t, f.tick(t, models.ProblemOptions{}),
+		models.Delivery{Step: 0, Repetition: 1, Channel: "oncall"},
+		models.Delivery{Step: 1, Repetition: 1, Channel: "lead"},
+	)
+}
+
+func TestSchedulerStops(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(t *testing.T, f *escalationTest) models.ProblemOptions
+	}{
+		{"acknowledged", func(t *testing.T, f *escalationTest) models.ProblemOptions {
+			f.agent.TriggerMappings[0].Acknowledged = true
+			return models.ProblemOptions{}
+		}},
+		{"resolved", func(t *testing.T, f *escalationTest) models.ProblemOptions {
+			f.agent.TriggerMappings[0].Problematic = false
+			return models.ProblemOptions{}
+		}},
+		{"resolved event", func(t *testing.T, f *escalationTest) models.ProblemOptions {
+			if _, err := f.store.InsertTriggerEvent(context.Background(), models.TriggerEvent{AgentID: f.agent.ID, TriggerID: f.agent.TriggerMappings[0].TriggerID, Time: f.clock.Now(), Problematic: false}); err != nil {
+				t.Fatal(err)
+			}
+			return models.ProblemOptions{}
+		}},
+		{"maintenance", func(t *testing.T, f *escalationTest) models.ProblemOptions {
+			return models.ProblemOptions{Maintenances: []models.Maintenance{{
+				Name:  "patching",
+				Scope: models.MaintenanceScope{AgentIDs: []primitive.ObjectID{f.agent.ID}},
+				Start: problemStart,
+				End:   problemStart.Add(24 * time.Hour),
+			}}}
+		}},
+		{"other severity", func(t *testing.T, f *escalationTest) models.ProblemOptions {
+			low := models.LOW
+			f.agent.TriggerMappings[0].SeverityOverride = &low
+			f.policy.Severities = []models.TriggerSeverity{models.HIGH}
+			if err := f.store.UpdateEscalationPolicy(context.Background(), f.policy); err != nil {
+				t.Fatal(err)
+			}
+			return models.ProblemOptions{}
+		}},
+	}
+
+	for _, k := range cases {
+		t.Run(k.name, func(t *testing.T) {
+			f := newEscalationTest(t)
+			expectSent(t, f.tick(t, models.ProblemOptions{}), models.Delivery{Step: 0, Repetition: 0, Channel: "oncall"})
+
+			f.clock.Advance(10 * time.Minute)
+			options := k.modify(t, f)
+			expectSent(t, f.tick(t, options))
+
+			if _, next, err := f.scheduler.Due(context.Background(), []models.Agent{f.agent}, options); err != nil || !next.IsZero() {
+				t.Fatal("further notifications are planned:", next, err)
+			}
+		})
+	}
+}
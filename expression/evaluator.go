@@ -0,0 +1,181 @@
+package expression
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//ResultSource is used to load the results of the items referenced by an expression
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type ResultSource interface {
+	GetLastResults(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error)
+}
+
+//State defines the outcome of an evaluated expression
+type State int
+
+const (
+	//OK is returned if the expression evaluated to false
+	OK State = iota
+	//Problem is returned if the expression evaluated to true
+	Problem
+	//Failed is returned if the expression couldn't be evaluated (e.g. missing results or unknown items)
+	Failed
+)
+
+//Outcome stores the result of an evaluated expression
+type Outcome struct {
+	State State
+	//Error is set if State is Failed and can be stored in TriggerAssignment.Error
+	Error string
+	//Values contains the newest result of every item which was loaded during the evaluation (indexed by item name)
+	Values map[string]models.Result
+}
+
+//IsProblematic returns true if the expression evaluated to true
+func (o Outcome) IsProblematic() bool {
+	return o.State == Problem
+}
+
+//MaxResults limits the number of results which are loaded by min, max or avg
+//It's used if they are called without a limit, larger limits are clamped to it
+var MaxResults = 1000
+
+type resultKey struct {
+	ItemID primitive.ObjectID
+	Limit  int
+}
+
+type evaluation struct {
+	ctx    context.Context
+	source ResultSource
+	agent  models.Agent
+	items  map[string]models.Item
+	cache  map[resultKey]models.ResultSet
+	values map[string]models.Result
+}
+
+//EvaluateTrigger parses and evaluates the expression of the trigger for the specified agent
+func EvaluateTrigger(ctx context.Context, Source ResultSource, Agent models.Agent, Trigger models.Trigger) Outcome {
+	parsed, err := Parse(Trigger.Expression)
+	if err != nil {
+		return Outcome{State: Failed, Error: err.Error(), Values: make(map[string]models.Result)}
+	}
+
+	return parsed.Evaluate(ctx, Source, Agent)
+}
+
+//Evaluate evaluates the expression for the specified agent
+//Item names are resolved against the items assigned to the agent (Agent.GetAllItems), so the agent has to be populated
+func (e *Expression) Evaluate(ctx context.Context, Source ResultSource, Agent models.Agent) Outcome {
+	run := evaluation{
+		ctx:    ctx,
+		source: Source,
+		agent:  Agent,
+		items:  make(map[string]models.Item),
+		cache:  make(map[resultKey]models.ResultSet),
+		values: make(map[string]models.Result),
+	}
+
+	for _, k := range Agent.GetAllItems() {
+		if _, found := run.items[k.Name]; !found {
+			run.items[k.Name] = k
+		}
+	}
+
+	value, err := e.root.eval(&run)
+	if err != nil {
+		return Outcome{State: Failed, Error: err.Error(), Values: run.values}
+	}
+
+	problematic, ok := value.(bool)
+	if !ok {
+		return Outcome{State: Failed, Error: fmt.Sprintf("expression evaluated to %v instead of a boolean", value), Values: run.values}
+	}
+
+	if problematic {
+		return Outcome{State: Problem, Values: run.values}
+	}
+
+	return Outcome{State: OK, Values: run.values}
+}
+
+func (e *evaluation) call(Function string, ItemName string, Limit float64) (interface{}, error) {
+	item, found := e.items[ItemName]
+	if !found {
+		return nil, fmt.Errorf("item %q isn't assigned to agent %s", ItemName, e.agent.Name)
+	}
+
+	fetch := int(Limit)
+	switch Function {
+	case "diff":
+		fetch = 2
+	case "last":
+		fetch = 1
+	default:
+		if fetch == 0 || fetch > MaxResults {
+			fetch = MaxResults
+		}
+	}
+
+	set, err := e.results(item, fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(set.Results) == 0 {
+		return nil, fmt.Errorf("%s(%s): %w", Function, ItemName, models.ErrNoResults)
+	}
+	if set.Results[0].Error != "" {
+		return nil, fmt.Errorf("%s(%s): last check failed: %s", Function, ItemName, set.Results[0].Error)
+	}
+
+	var value interface{}
+	switch Function {
+	case "min":
+		value, err = set.Min(Limit)
+	case "max":
+		value, err = set.Max(Limit)
+	case "avg":
+		value, err = set.Avg(Limit)
+	case "diff":
+		value, err = set.Diff()
+	case "last":
+		if set.Type() == models.Text {
+			value = set.Results[0].ValueString
+		} else {
+			value, err = set.LastNumeric()
+		}
+	default:
+		err = fmt.Errorf("unknown function %s", Function)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s(%s): %w", Function, ItemName, err)
+	}
+
+	return value, nil
+}
+
+//results loads the newest results of the item and caches them for the current evaluation
+func (e *evaluation) results(Item models.Item, Limit int) (models.ResultSet, error) {
+	key := resultKey{ItemID: Item.ID, Limit: Limit}
+	if set, found := e.cache[key]; found {
+		return set, nil
+	}
+
+	set, err := e.source.GetLastResults(e.ctx, Item.ID, e.agent.ID, Limit)
+	if err != nil {
+		return models.ResultSet{}, fmt.Errorf("couldn't load results of item %q: %w", Item.Name, err)
+	}
+
+	e.cache[key] = set
+	if len(set.Results) > 0 {
+		e.values[Item.Name] = set.Results[0]
+	}
+
+	return set, nil
+}
@@ -0,0 +1,211 @@
+package expression
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//fakeSource serves results from memory and records the limits it was called with
+type fakeSource struct {
+	results map[primitive.ObjectID][]models.Result
+	limits  []int
+}
+
+func (s *fakeSource) GetLastResults(ctx context.Context, ItemID primitive.ObjectID, HostID primitive.ObjectID, Limit int) (models.ResultSet, error) {
+	s.limits = append(s.limits, Limit)
+
+	results := s.results[ItemID]
+	if len(results) > Limit {
+		results = results[:Limit]
+	}
+
+	return models.ResultSet{Results: results}, nil
+}
+
+//agentWithResults returns an agent with the items cpu.load and hostname and a source with their results (newest first)
+func agentWithResults(Load ...float64) (models.Agent, *fakeSource) {
+	cpu := fixtures.Item("cpu.load")
+	hostname := fixtures.Item("hostname")
+	hostname.Returns = models.Text
+
+	source := &fakeSource{results: make(map[primitive.ObjectID][]models.Result)}
+	for _, k := range Load {
+		source.results[cpu.ID] = append(source.results[cpu.ID], models.Result{ItemID: cpu.ID, Type: models.Numeric, ValueNumeric: k})
+	}
+	source.results[hostname.ID] = []models.Result{{ItemID: hostname.ID, Type: models.Text, ValueString: "web1"}}
+
+	return fixtures.Agent("web1", fixtures.Template("linux", []models.Item{cpu, hostname}, nil)), source
+}
+
+func evaluate(t *testing.T, Expression string, Agent models.Agent, Source ResultSource) Outcome {
+	t.Helper()
+
+	return EvaluateTrigger(context.Background(), Source, Agent, models.Trigger{Expression: Expression})
+}
+
+func TestEvaluateFunctions(t *testing.T) {
+	//Results are ordered newest first
+	agent, source := agentWithResults(4, 9, 1, 6)
+
+	cases := []struct {
+		expression string
+		want       State
+	}{
+		{"last(cpu.load) == 4", Problem},
+		{"last(\"cpu.load\") == 4", Problem},
+		{"min(cpu.load) == 1", Problem},
+		{"min(cpu.load, 2) == 4", Problem},
+		{"max(cpu.load) == 9", Problem},
+		{"max(cpu.load, 1) == 4", Problem},
+		{"avg(cpu.load) == 5", Problem},
+		{"avg(cpu.load, 2) == 6.5", Problem},
+		{"diff(cpu.load) == 5", Problem},
+		{"LAST(cpu.load) > 4", OK},
+		{"last(hostname) == \"web1\"", Problem},
+		{"last(hostname) != 'web1'", OK},
+	}
+
+	for _, k := range cases {
+		if outcome := evaluate(t, k.expression, agent, source); outcome.State != k.want {
+			t.Errorf("%s: got state %d (%s), want %d", k.expression, outcome.State, outcome.Error, k.want)
+		}
+	}
+}
+
+func TestEvaluatePrecedence(t *testing.T) {
+	agent, source := agentWithResults(2)
+
+	cases := []struct {
+		expression string
+		want       State
+	}{
+		{"1 + 2 * 3 == 7", Problem},
+		{"(1 + 2) * 3 == 9", Problem},
+		{"10 - 4 - 3 == 3", Problem},
+		{"8 / 4 / 2 == 1", Problem},
+		{"-last(cpu.load) + 3 == 1", Problem},
+		{"true || false && false", Problem},
+		{"(true || false) && false", OK},
+		{"!false && last(cpu.load) * 2 >= 4", Problem},
+		{"(last(cpu.load) > 1) == true", Problem},
+		{"last(cpu.load) > 1 == true", Failed},
+	}
+
+	for _, k := range cases {
+		if outcome := evaluate(t, k.expression, agent, source); outcome.State != k.want {
+			t.Errorf("%s: got state %d (%s), want %d", k.expression, outcome.State, outcome.Error, k.want)
+		}
+	}
+}
+
+func TestEvaluateFailures(t *testing.T) {
+	agent, source := agentWithResults(3)
+
+	cases := []struct {
+		name       string
+		expression string
+		message    string
+	}{
+		{"unknown item", "last(disk.free) > 1", "disk.free"},
+		{"unknown function", "median(cpu.load) > 1", "median"},
+		{"wrong number of arguments", "diff(cpu.load, 2) > 1", "wrong number of arguments"},
+		{"syntax error", "last(cpu.load) >", "unexpected"},
+		{"no boolean", "last(cpu.load) + 1", "instead of a boolean"},
+		{"numeric function on text", "avg(hostname) > 1", "text items"},
+		{"negative limit", "min(cpu.load, -1) > 1", "positive number"},
+	}
+
+	for _, k := range cases {
+		t.Run(k.name, func(t *testing.T) {
+			outcome := evaluate(t, k.expression, agent, source)
+			if outcome.State != Failed {
+				t.Fatalf("got state %d, want Failed", outcome.State)
+			}
+			if !strings.Contains(outcome.Error, k.message) {
+				t.Fatalf("error %q doesn't mention %q", outcome.Error, k.message)
+			}
+		})
+	}
+}
+
+func TestEvaluateEmptyResultSet(t *testing.T) {
+	agent, source := agentWithResults()
+
+	for _, k := range []string{"last(cpu.load) > 1", "min(cpu.load) > 1", "diff(cpu.load) > 1"} {
+		outcome := evaluate(t, k, agent, source)
+		if outcome.State != Failed || !strings.Contains(outcome.Error, models.ErrNoResults.Error()) {
+			t.Errorf("%s: got state %d (%s), want Failed because of missing results", k, outcome.State, outcome.Error)
+		}
+		if _, found := outcome.Values["cpu.load"]; found {
+			t.Errorf("%s: value reported for item without results", k)
+		}
+	}
+}
+
+func TestEvaluateValues(t *testing.T) {
+	agent, source := agentWithResults(7, 3)
+
+	outcome := evaluate(t, "last(cpu.load) > 5 && last(hostname) == \"web1\"", agent, source)
+	if outcome.State != Problem {
+		t.Fatalf("got state %d (%s), want Problem", outcome.State, outcome.Error)
+	}
+	if outcome.Values["cpu.load"].ValueNumeric != 7 || outcome.Values["hostname"].ValueString != "web1" {
+		t.Fatal("newest results weren't reported:", outcome.Values)
+	}
+}
+
+func TestEvaluateMaxResults(t *testing.T) {
+	defer func(previous int) { MaxResults = previous }(MaxResults)
+	MaxResults = 3
+
+	agent, source := agentWithResults(1, 2, 3, 4, 5)
+
+	cases := []struct {
+		expression string
+		limit      int
+	}{
+		{"avg(cpu.load) == 2", 3},
+		{"avg(cpu.load, 2) == 1.5", 2},
+		{"avg(cpu.load, 100) == 2", 3},
+		{"diff(cpu.load) == 1", 2},
+		{"last(cpu.load) == 1", 1},
+	}
+
+	for _, k := range cases {
+		source.limits = nil
+		if outcome := evaluate(t, k.expression, agent, source); outcome.State != Problem {
+			t.Errorf("%s: got state %d (%s), want Problem", k.expression, outcome.State, outcome.Error)
+		}
+		if len(source.limits) != 1 || source.limits[0] != k.limit {
+			t.Errorf("%s: loaded results with limits %v, want %d", k.expression, source.limits, k.limit)
+		}
+	}
+}
+
+func TestEvaluateCachesResults(t *testing.T) {
+	agent, source := agentWithResults(5)
+
+	if outcome := evaluate(t, "last(cpu.load) > 1 && last(cpu.load) < 10", agent, source); outcome.State != Problem {
+		t.Fatalf("got state %d (%s), want Problem", outcome.State, outcome.Error)
+	}
+	if len(source.limits) != 1 {
+		t.Fatal("results were loaded more than once:", source.limits)
+	}
+}
+
+func TestParseItems(t *testing.T) {
+	parsed, err := Parse("last(cpu.load) > 1 || avg(\"CPU Load\", 5) > max(cpu.load)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := parsed.Items()
+	if len(items) != 2 || items[0] != "cpu.load" || items[1] != "CPU Load" {
+		t.Fatal("unexpected items:", items)
+	}
+}
@@ -0,0 +1,103 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type token struct {
+	Kind     tokenKind
+	Text     string
+	Number   float64
+	Position int
+}
+
+//operators are ordered by length, so that two character operators are matched first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "!"}
+
+func tokenize(Input string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(Input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{Kind: tokenLeftParen, Text: "(", Position: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{Kind: tokenRightParen, Text: ")", Position: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{Kind: tokenComma, Text: ",", Position: i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var text strings.Builder
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{Kind: tokenString, Text: text.String(), Position: start})
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, start)
+			}
+			tokens = append(tokens, token{Kind: tokenNumber, Text: text, Number: number, Position: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{Kind: tokenIdent, Text: string(runes[start:i]), Position: start})
+		default:
+			matched := false
+			for _, k := range operators {
+				if strings.HasPrefix(string(runes[i:]), k) {
+					tokens = append(tokens, token{Kind: tokenOperator, Text: k, Position: i})
+					i += len([]rune(k))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{Kind: tokenEOF, Position: len(runes)})
+	return tokens, nil
+}
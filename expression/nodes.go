@@ -0,0 +1,146 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+)
+
+//node is a single element of the parsed expression tree
+//eval returns either a float64, a string or a bool
+type node interface {
+	eval(e *evaluation) (interface{}, error)
+}
+
+type constantNode struct {
+	Value interface{}
+}
+
+func (n constantNode) eval(e *evaluation) (interface{}, error) {
+	return n.Value, nil
+}
+
+type unaryNode struct {
+	Operator string
+	Operand  node
+}
+
+func (n unaryNode) eval(e *evaluation) (interface{}, error) {
+	value, err := n.Operand.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Operator {
+	case "!":
+		boolean, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator ! expects a boolean, got %v", value)
+		}
+		return !boolean, nil
+	default:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("operator - expects a number, got %v", value)
+		}
+		return -number, nil
+	}
+}
+
+type binaryNode struct {
+	Operator    string
+	Left, Right node
+}
+
+func (n binaryNode) eval(e *evaluation) (interface{}, error) {
+	left, err := n.Left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	//Logical operators are short circuited, so that e.g. the right side isn't loaded from the database if it isn't needed
+	if n.Operator == "&&" || n.Operator == "||" {
+		leftBool, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s expects booleans, got %v", n.Operator, left)
+		}
+		if (n.Operator == "&&" && !leftBool) || (n.Operator == "||" && leftBool) {
+			return leftBool, nil
+		}
+
+		right, err := n.Right.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		rightBool, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s expects booleans, got %v", n.Operator, right)
+		}
+		return rightBool, nil
+	}
+
+	right, err := n.Right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Operator {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	leftNumber, leftOk := left.(float64)
+	rightNumber, rightOk := right.(float64)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("operator %s expects numbers, got %v and %v", n.Operator, left, right)
+	}
+
+	switch n.Operator {
+	case "<":
+		return leftNumber < rightNumber, nil
+	case "<=":
+		return leftNumber <= rightNumber, nil
+	case ">":
+		return leftNumber > rightNumber, nil
+	case ">=":
+		return leftNumber >= rightNumber, nil
+	case "+":
+		return leftNumber + rightNumber, nil
+	case "-":
+		return leftNumber - rightNumber, nil
+	case "*":
+		return leftNumber * rightNumber, nil
+	case "/":
+		if rightNumber == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return leftNumber / rightNumber, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", n.Operator)
+}
+
+type callNode struct {
+	Function string
+	Item     string
+	Args     []node
+}
+
+func (n callNode) eval(e *evaluation) (interface{}, error) {
+	var limit float64
+	if len(n.Args) > 0 {
+		value, err := n.Args[0].eval(e)
+		if err != nil {
+			return nil, err
+		}
+
+		number, ok := value.(float64)
+		if !ok || number < 0 {
+			return nil, fmt.Errorf("function %s expects a positive number as limit, got %v", n.Function, value)
+		}
+		limit = number
+	}
+
+	return e.call(n.Function, n.Item, limit)
+}
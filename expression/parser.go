@@ -0,0 +1,309 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+)
+
+//Expression stores a parsed trigger expression
+//Expressions are immutable and can be evaluated concurrently
+type Expression struct {
+	source string
+	root   node
+	items  []string
+}
+
+//function describes a function which can be used inside an expression
+//The first argument of every function is the name of the item the function is applied to
+type function struct {
+	MinArgs, MaxArgs int //Number of arguments after the item name
+}
+
+var functions = map[string]function{
+	"min":  {MinArgs: 0, MaxArgs: 1},
+	"max":  {MinArgs: 0, MaxArgs: 1},
+	"avg":  {MinArgs: 0, MaxArgs: 1},
+	"diff": {MinArgs: 0, MaxArgs: 0},
+	"last": {MinArgs: 0, MaxArgs: 0},
+}
+
+//Parse parses the specified trigger expression
+//Supported are numbers, strings, true / false, the operators && || == != < <= > >= + - * / ! and parentheses
+//Items are referenced via the functions min(item, N), max(item, N), avg(item, N), diff(item) and last(item)
+//Item names can be written as identifier (cpu.load) or as string ("CPU Load")
+func Parse(Input string) (*Expression, error) {
+	if stringHelper.IsEmpty(Input) {
+		return nil, errors.New("expression can't be empty")
+	}
+
+	tokens, err := tokenize(Input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().Kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().Text, p.peek().Position)
+	}
+
+	return &Expression{
+		source: Input,
+		root:   root,
+		items:  p.items,
+	}, nil
+}
+
+//Validate returns an error if the specified expression can't be parsed
+func Validate(Input string) error {
+	_, err := Parse(Input)
+	return err
+}
+
+//String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+//Items returns the names of all items referenced by the expression
+//Every name is only returned once
+func (e *Expression) Items() []string {
+	return append(make([]string, 0, len(e.items)), e.items...)
+}
+
+type parser struct {
+	tokens   []token
+	position int
+	items    []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.Kind != tokenEOF {
+		p.position++
+	}
+
+	return t
+}
+
+func (p *parser) acceptOperator(Operators ...string) (string, bool) {
+	t := p.peek()
+	if t.Kind != tokenOperator {
+		return "", false
+	}
+
+	for _, k := range Operators {
+		if t.Text == k {
+			p.next()
+			return k, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.acceptOperator("||")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.acceptOperator("&&")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.acceptOperator("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	return binaryNode{Operator: operator, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.acceptOperator("+", "-")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.acceptOperator("*", "/")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if operator, ok := p.acceptOperator("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return unaryNode{Operator: operator, Operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.Kind {
+	case tokenNumber:
+		return constantNode{Value: t.Number}, nil
+	case tokenString:
+		return constantNode{Value: t.Text}, nil
+	case tokenLeftParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.Kind != tokenRightParen {
+			return nil, fmt.Errorf("expected ')' at position %d", closing.Position)
+		}
+		return inner, nil
+	case tokenIdent:
+		if p.peek().Kind == tokenLeftParen {
+			return p.parseCall(t)
+		}
+
+		switch strings.ToLower(t.Text) {
+		case "true":
+			return constantNode{Value: true}, nil
+		case "false":
+			return constantNode{Value: false}, nil
+		}
+
+		return nil, fmt.Errorf("unknown identifier %q at position %d", t.Text, t.Position)
+	case tokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.Text, t.Position)
+	}
+}
+
+func (p *parser) parseCall(Name token) (node, error) {
+	fn, found := functions[strings.ToLower(Name.Text)]
+	if !found {
+		return nil, fmt.Errorf("unknown function %q at position %d", Name.Text, Name.Position)
+	}
+
+	//Skip the opening parenthesis
+	p.next()
+
+	itemToken := p.next()
+	if itemToken.Kind != tokenIdent && itemToken.Kind != tokenString {
+		return nil, fmt.Errorf("function %s expects an item as first argument at position %d", Name.Text, itemToken.Position)
+	}
+
+	call := callNode{Function: strings.ToLower(Name.Text), Item: itemToken.Text, Args: make([]node, 0)}
+	for p.peek().Kind == tokenComma {
+		p.next()
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+
+	if closing := p.next(); closing.Kind != tokenRightParen {
+		return nil, fmt.Errorf("expected ')' at position %d", closing.Position)
+	}
+
+	if len(call.Args) < fn.MinArgs || len(call.Args) > fn.MaxArgs {
+		return nil, fmt.Errorf("function %s called with wrong number of arguments at position %d", Name.Text, Name.Position)
+	}
+
+	p.addItem(call.Item)
+	return call, nil
+}
+
+func (p *parser) addItem(Name string) {
+	for _, k := range p.items {
+		if k == Name {
+			return
+		}
+	}
+
+	p.items = append(p.items, Name)
+}
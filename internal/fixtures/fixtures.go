@@ -0,0 +1,73 @@
+//Package fixtures builds the models used by the tests of all packages
+//Every returned struct is valid and has a new ID, so tests only have to set the fields they are interested in
+package fixtures
+
+import (
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Item returns a numeric item, which is checked on linux every minute
+func Item(Name string) models.Item {
+	return models.Item{
+		ID:       primitive.NewObjectID(),
+		Name:     Name,
+		Returns:  models.Numeric,
+		Interval: 60,
+		Command:  "true",
+		CheckOn:  models.Linux,
+	}
+}
+
+//Trigger returns an enabled MEDIUM trigger, which is problematic if the load is higher than one
+func Trigger(Name string) models.Trigger {
+	return models.Trigger{
+		ID:         primitive.NewObjectID(),
+		Name:       Name,
+		Enabled:    true,
+		Severity:   models.MEDIUM,
+		DependsOn:  make([]primitive.ObjectID, 0),
+		Expression: "last(cpu.load) > 1",
+	}
+}
+
+//Template returns a populated template containing the items and triggers
+func Template(Name string, Items []models.Item, Triggers []models.Trigger) models.Template {
+	template := models.Template{
+		ID:         primitive.NewObjectID(),
+		Name:       Name,
+		ItemIDs:    make([]primitive.ObjectID, 0, len(Items)),
+		Items:      append(make([]models.Item, 0, len(Items)), Items...),
+		TriggerIDs: make([]primitive.ObjectID, 0, len(Triggers)),
+		Triggers:   append(make([]models.Trigger, 0, len(Triggers)), Triggers...),
+	}
+	for _, k := range Items {
+		template.ItemIDs = append(template.ItemIDs, k.ID)
+	}
+	for _, k := range Triggers {
+		template.TriggerIDs = append(template.TriggerIDs, k.ID)
+	}
+
+	return template
+}
+
+//Agent returns a populated and enabled linux agent, which is scraped every minute and uses the templates
+func Agent(Name string, Templates ...models.Template) models.Agent {
+	agent := models.Agent{
+		ID:              primitive.NewObjectID(),
+		Name:            Name,
+		AgentUUID:       uuid.New(),
+		Enabled:         true,
+		OS:              models.Linux,
+		TemplateIDs:     make([]primitive.ObjectID, 0, len(Templates)),
+		Templates:       append(make([]models.Template, 0, len(Templates)), Templates...),
+		TriggerMappings: make([]models.TriggerAssignment, 0),
+		ScrapeInterval:  60,
+	}
+	for _, k := range Templates {
+		agent.TemplateIDs = append(agent.TemplateIDs, k.ID)
+	}
+
+	return agent
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+)
+
+//AcknowledgementAction defines what an operator did with a problem
+type AcknowledgementAction int
+
+const (
+	//ProblemAcknowledged is set if an operator took care of the problem
+	ProblemAcknowledged AcknowledgementAction = iota
+	//ProblemUnacknowledged is set if an operator revoked a previous acknowledgement
+	ProblemUnacknowledged
+	//ProblemClosed is set if an operator closed the problem manually
+	ProblemClosed
+)
+
+//Acknowledgement stores a single operator action on a problem of a trigger assignment
+type Acknowledgement struct {
+	User    string
+	Time    time.Time
+	Action  AcknowledgementAction
+	Comment string
+	//Severity is set if the operator changed the severity of the problem
+	Severity *TriggerSeverity
+}
+
+//Validate checks if the acknowledgement can be stored in the database
+func (a Acknowledgement) Validate() error {
+	if stringHelper.IsEmpty(a.User) {
+		return errors.New("acknowledgement user can't be empty")
+	}
+	if a.Action < ProblemAcknowledged || a.Action > ProblemClosed {
+		return errors.New("acknowledgement has an unknown action")
+	}
+	if a.Severity != nil && !a.Severity.Valid() {
+		return errors.New("acknowledgement has an unknown severity")
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,15 +19,27 @@ type Agent struct {
 	LastSeen          time.Time
 	OS                AgentOS
 	State             AgentState
+	StateChanged      time.Time
 	TemplateIDs       []primitive.ObjectID
 	Templates         []Template `bson:"-"`
 	TriggerMappings   []TriggerAssignment
 	Endpoint          string
 	ScrapeInterval    int //In seconds
-	Scraper           struct {
-		UUID uuid.UUID
-		Lock time.Time
-	}
+	Tags              []string
+	//Metadata is reported by the agent during registration (e.g. kernel version, datacenter)
+	Metadata map[string]string
+	//Pending is set for agents which registered themselves and still have to be approved
+	Pending bool
+	//LifecycleState is empty for agents stored before lifecycle states were introduced, use Lifecycle() to read the state
+	//Enabled, Deleted and Pending are derived from it and only kept for compatibility
+	LifecycleState       LifecycleState
+	LifecycleChanged     time.Time
+	LifecycleTransitions []LifecycleTransition
+	Scraper              ScraperLease
+	//ItemSchedules replace the schedules of single items on this agent
+	ItemSchedules []ItemSchedule
+	//Macros are user macros used in item commands, they override the macros of the templates (see MacroValues)
+	Macros map[string]string
 }
 
 //AgentOS defines on which OS the agent ist running
@@ -41,16 +54,25 @@ const (
 	Unsupported
 )
 
-//AgentState defines if the agent is regarded online by the assigned leader
+//AgentState defines if the agent is regarded online by the online detection (see online.Detector)
 type AgentState int
 
 const (
-	//Online is set if the OnlineDetection succeeds
+	//Online is set if the agent was seen within the timeout of the online detection
 	Online AgentState = iota
-	//Offline is set if the OnlineDetection fails
+	//Offline is set if the agent wasn't seen within the timeout of the online detection
 	Offline
 )
 
+//String returns the name of the AgentState
+func (s AgentState) String() string {
+	if s == Offline {
+		return "Offline"
+	}
+
+	return "Online"
+}
+
 //AgentosFromString returns the AgentOS iota representation of the specified string
 func AgentosFromString(OS string) (AgentOS, error) {
 	switch strings.ToLower(OS) {
@@ -69,6 +91,71 @@ func AgentosFromString(OS string) (AgentOS, error) {
 	}
 }
 
+//Valid returns true if the AgentOS is a supported os
+func (o AgentOS) Valid() bool {
+	return o == Windows || o == Linux
+}
+
+//String returns the name of the AgentOS
+func (o AgentOS) String() string {
+	switch o {
+	case Windows:
+		return "Windows"
+	case Linux:
+		return "Linux"
+	}
+
+	return "Unsupported"
+}
+
+//Validate checks if the agent can be stored in the database
+func (a Agent) Validate() error {
+	if stringHelper.IsEmpty(a.Name) {
+		return errors.New("agent name can't be empty")
+	}
+	if a.AgentUUID == uuid.Nil {
+		return errors.New("agent uuid can't be empty")
+	}
+	if !a.OS.Valid() {
+		return errors.New("agent has to run on a supported os")
+	}
+	if a.ScrapeInterval <= 0 {
+		return errors.New("agent scrape interval has to be greater than zero")
+	}
+	if a.LifecycleState != "" && !a.LifecycleState.Valid() {
+		return errors.New("agent has an unknown lifecycle state")
+	}
+	if err := validateMacros(a.Macros); err != nil {
+		return err
+	}
+	for _, k := range a.ItemSchedules {
+		if k.ItemID.IsZero() {
+			return errors.New("item schedule has to reference an item")
+		}
+		if err := k.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Scrapable returns true if the agent should be scraped
+func (a Agent) Scrapable() bool {
+	return a.Lifecycle() == LifecycleActive
+}
+
+//HasTag returns true if the agent has the specified tag
+func (a Agent) HasTag(Tag string) bool {
+	for _, k := range a.Tags {
+		if k == Tag {
+			return true
+		}
+	}
+
+	return false
+}
+
 //ProblematicTriggers returns all trigger assignments, which are currently in a problematic state
 func (a Agent) ProblematicTriggers() []TriggerAssignment {
 	problematicTriggers := make([]TriggerAssignment, 0)
@@ -81,6 +168,30 @@ func (a Agent) ProblematicTriggers() []TriggerAssignment {
 	return problematicTriggers
 }
 
+//UnacknowledgedProblems returns all problematic trigger assignments, which weren't acknowledged by an operator yet
+func (a Agent) UnacknowledgedProblems() []TriggerAssignment {
+	problems := make([]TriggerAssignment, 0)
+	for _, k := range a.ProblematicTriggers() {
+		if !k.Acknowledged {
+			problems = append(problems, k)
+		}
+	}
+
+	return problems
+}
+
+//AcknowledgedProblems returns all problematic trigger assignments, which were acknowledged by an operator
+func (a Agent) AcknowledgedProblems() []TriggerAssignment {
+	problems := make([]TriggerAssignment, 0)
+	for _, k := range a.ProblematicTriggers() {
+		if k.Acknowledged {
+			problems = append(problems, k)
+		}
+	}
+
+	return problems
+}
+
 //GetTrigger returns the trigger struct for the specified ID
 func (a Agent) GetTrigger(ID primitive.ObjectID) (Trigger, error) {
 	for _, template := range a.Templates {
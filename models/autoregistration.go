@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"sort"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//AutoRegistrationRule configures agents matching all conditions when they register or their metadata changes
+//Empty conditions match every agent
+type AutoRegistrationRule struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Name, Description string
+	Enabled           bool
+	//Rules are applied ordered by their priority (lowest first), so later rules win if they set different scrape intervals
+	Priority int
+
+	OS []AgentOS
+	//HostnameRegex has to match the whole agent name like the regexes of silence matchers, so "web" only matches "web" and not "webserver"
+	HostnameRegex string
+	//Metadata contains key/value pairs which have to be reported by the agent
+	Metadata map[string]string
+
+	//TemplateIDs are linked to the agent
+	TemplateIDs []primitive.ObjectID
+	//ScrapeInterval is set on the agent if it's greater than zero (in seconds)
+	ScrapeInterval int
+	//Tags are added to the agent
+	Tags []string
+}
+
+//Validate checks if the rule can be stored in the database
+func (r AutoRegistrationRule) Validate() error {
+	if stringHelper.IsEmpty(r.Name) {
+		return errors.New("auto registration rule name can't be empty")
+	}
+	for _, k := range r.OS {
+		if !k.Valid() {
+			return errors.New("auto registration rule has an unsupported os")
+		}
+	}
+	if _, err := compileMatcher(r.HostnameRegex); err != nil {
+		return errors.New("auto registration rule has an invalid hostname regex: " + err.Error())
+	}
+	if r.ScrapeInterval < 0 {
+		return errors.New("auto registration rule scrape interval can't be negative")
+	}
+	if len(r.TemplateIDs) == 0 && r.ScrapeInterval == 0 && len(r.Tags) == 0 {
+		return errors.New("auto registration rule has to link templates, set the scrape interval or add tags")
+	}
+
+	return nil
+}
+
+//Matches returns true if the agent fulfills all conditions of the rule
+//The hostname regex is matched against the whole agent name
+func (r AutoRegistrationRule) Matches(Agent Agent) bool {
+	if !r.Enabled {
+		return false
+	}
+
+	if len(r.OS) > 0 {
+		found := false
+		for _, k := range r.OS {
+			if k == Agent.OS {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.HostnameRegex != "" {
+		expression, err := compileMatcher(r.HostnameRegex)
+		if err != nil || !expression.MatchString(Agent.Name) {
+			return false
+		}
+	}
+
+	for k, v := range r.Metadata {
+		if value, found := Agent.Metadata[k]; !found || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+//AutoRegistrationResult describes which rules match an agent and how they change it
+type AutoRegistrationResult struct {
+	Matched []AutoRegistrationRule
+	//Agent is the agent with all changes applied
+	Agent            Agent
+	AddedTemplateIDs []primitive.ObjectID
+	AddedTags        []string
+	//ScrapeInterval is the new scrape interval, zero if it isn't changed
+	ScrapeInterval int
+}
+
+//Changed returns true if at least one rule changes the agent
+func (r AutoRegistrationResult) Changed() bool {
+	return len(r.AddedTemplateIDs) > 0 || len(r.AddedTags) > 0 || r.ScrapeInterval > 0
+}
+
+//ApplyAutoRegistrationRules applies all matching rules to the agent without persisting anything
+//Rules only add templates and tags, so applying them multiple times doesn't change the result
+func ApplyAutoRegistrationRules(Rules []AutoRegistrationRule, Agent Agent) AutoRegistrationResult {
+	sorted := append(make([]AutoRegistrationRule, 0, len(Rules)), Rules...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	result := AutoRegistrationResult{
+		Matched:          make([]AutoRegistrationRule, 0),
+		AddedTemplateIDs: make([]primitive.ObjectID, 0),
+		AddedTags:        make([]string, 0),
+	}
+
+	Agent.TemplateIDs = append(make([]primitive.ObjectID, 0, len(Agent.TemplateIDs)), Agent.TemplateIDs...)
+	Agent.Tags = append(make([]string, 0, len(Agent.Tags)), Agent.Tags...)
+
+	for _, rule := range sorted {
+		if !rule.Matches(Agent) {
+			continue
+		}
+		result.Matched = append(result.Matched, rule)
+
+		for _, k := range rule.TemplateIDs {
+			found := false
+			for _, existing := range Agent.TemplateIDs {
+				if existing == k {
+					found = true
+					break
+				}
+			}
+			if !found {
+				Agent.TemplateIDs = append(Agent.TemplateIDs, k)
+				result.AddedTemplateIDs = append(result.AddedTemplateIDs, k)
+			}
+		}
+
+		for _, k := range rule.Tags {
+			if !Agent.HasTag(k) {
+				Agent.Tags = append(Agent.Tags, k)
+				result.AddedTags = append(result.AddedTags, k)
+			}
+		}
+
+		if rule.ScrapeInterval > 0 {
+			result.ScrapeInterval = rule.ScrapeInterval
+		}
+	}
+
+	if result.ScrapeInterval == Agent.ScrapeInterval {
+		result.ScrapeInterval = 0
+	}
+	if result.ScrapeInterval > 0 {
+		Agent.ScrapeInterval = result.ScrapeInterval
+	}
+	result.Agent = Agent
+
+	return result
+}
@@ -0,0 +1,36 @@
+package models
+
+import "testing"
+
+func TestAutoRegistrationRuleMatches(t *testing.T) {
+	agent := Agent{Name: "web-01.prod", OS: Linux, Metadata: map[string]string{"datacenter": "vie1"}}
+
+	cases := []struct {
+		name  string
+		rule  AutoRegistrationRule
+		match bool
+	}{
+		{"empty conditions", AutoRegistrationRule{}, true},
+		{"hostname", AutoRegistrationRule{HostnameRegex: `web-\d+\.prod`}, true},
+		{"hostname prefix isn't enough", AutoRegistrationRule{HostnameRegex: "web"}, false},
+		{"hostname suffix isn't enough", AutoRegistrationRule{HostnameRegex: "prod"}, false},
+		{"hostname wildcard", AutoRegistrationRule{HostnameRegex: "web-.*"}, true},
+		{"alternatives are anchored", AutoRegistrationRule{HostnameRegex: "db|web"}, false},
+		{"invalid hostname regex", AutoRegistrationRule{HostnameRegex: "web("}, false},
+		{"os", AutoRegistrationRule{OS: []AgentOS{Windows, Linux}}, true},
+		{"other os", AutoRegistrationRule{OS: []AgentOS{Windows}}, false},
+		{"metadata", AutoRegistrationRule{Metadata: map[string]string{"datacenter": "vie1"}}, true},
+		{"other metadata", AutoRegistrationRule{Metadata: map[string]string{"datacenter": "fra1"}}, false},
+	}
+
+	for _, k := range cases {
+		k.rule.Enabled = true
+		if got := k.rule.Matches(agent); got != k.match {
+			t.Errorf("%s: got %v, want %v", k.name, got, k.match)
+		}
+	}
+
+	if (AutoRegistrationRule{}).Matches(agent) {
+		t.Fatal("disabled rule matched")
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//ClusterMember is a FlowKeeper server taking part in the cluster
+//Members are kept alive by heartbeats, members whose heartbeat expired are regarded dead
+type ClusterMember struct {
+	ID       uuid.UUID `bson:"_id"`
+	Hostname string
+	//Started is set when the member sent its first heartbeat
+	Started   time.Time
+	Heartbeat time.Time
+	Expires   time.Time
+}
+
+//Alive returns true if the heartbeat of the member didn't expire at the specified time
+func (m ClusterMember) Alive(At time.Time) bool {
+	return m.Expires.After(At)
+}
+
+//Leadership stores which member is the leader of an election
+//The leadership is a lease, it has to be renewed by the leader before it expires
+type Leadership struct {
+	//Name identifies the election, so independent tasks can have different leaders
+	Name   string `bson:"_id"`
+	Leader uuid.UUID
+	//Acquired is the time the current leader acquired the leadership
+	Acquired time.Time
+	Expires  time.Time
+	//Term is increased every time the leadership is acquired, it can be used as fencing token for the writes of the leader
+	Term int64
+}
+
+//HeldBy returns true if the member is the leader at the specified time
+func (l Leadership) HeldBy(Member uuid.UUID, At time.Time) bool {
+	return Member != uuid.Nil && l.Leader == Member && l.Expires.After(At)
+}
+
+//Free returns true if no member is the leader at the specified time
+func (l Leadership) Free(At time.Time) bool {
+	return l.Leader == uuid.Nil || !l.Expires.After(At)
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//AgentConfigVersion is the version of the layout of AgentConfig, it's increased whenever the layout changes
+const AgentConfigVersion = 1
+
+//AgentConfig is the effective configuration of a single agent, which is delivered to the agent
+//It only contains the checks the agent has to run, so it changes only if the behaviour of the agent has to change
+type AgentConfig struct {
+	Version        int
+	AgentID        primitive.ObjectID
+	AgentUUID      uuid.UUID
+	OS             AgentOS
+	ScrapeInterval int //In seconds
+	Items          []ConfigItem
+	//ETag is the content hash of the configuration, it's the same for configurations with the same content
+	ETag string `json:"-" bson:"-"`
+}
+
+//ConfigItem is a single check of an agent configuration
+type ConfigItem struct {
+	ID      primitive.ObjectID
+	Name    string
+	Returns ReturnType
+	Unit    string
+	//Command is the command of the item with all macros resolved
+	Command string
+	//Schedule is the effective schedule of the item on the agent
+	Schedule Schedule
+}
+
+//NewAgentConfig builds the configuration of the agent
+//The agent has to be populated, only items checked on the os of the agent are part of the configuration
+//Agents which shouldn't be scraped (e.g. disabled ones) get a configuration without items
+func NewAgentConfig(Agent Agent) (AgentConfig, error) {
+	config := AgentConfig{
+		Version:        AgentConfigVersion,
+		AgentID:        Agent.ID,
+		AgentUUID:      Agent.AgentUUID,
+		OS:             Agent.OS,
+		ScrapeInterval: Agent.ScrapeInterval,
+		Items:          make([]ConfigItem, 0),
+	}
+
+	if Agent.Scrapable() {
+		macros := Agent.MacroValues()
+		for _, k := range Agent.GetAllItems() {
+			if k.CheckOn != Agent.OS {
+				continue
+			}
+
+			config.Items = append(config.Items, ConfigItem{
+				ID:       k.ID,
+				Name:     k.Name,
+				Returns:  k.Returns,
+				Unit:     k.Unit,
+				Command:  resolveMacros(k.Command, macros),
+				Schedule: normalizeSchedule(Agent.Schedule(k)),
+			})
+		}
+	}
+	sort.Slice(config.Items, func(i, j int) bool { return bytes.Compare(config.Items[i].ID[:], config.Items[j].ID[:]) < 0 })
+
+	etag, err := config.hash()
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	config.ETag = etag
+
+	return config, nil
+}
+
+//Unchanged returns true if the configuration has the specified ETag, so it doesn't have to be delivered again
+func (c AgentConfig) Unchanged(ETag string) bool {
+	return ETag != "" && ETag == c.ETag
+}
+
+//hash returns the hex encoded sha256 hash of the configuration
+//The json encoding is stable, as fields are encoded in their declaration order and the items are sorted
+func (c AgentConfig) hash() (string, error) {
+	c.ETag = ""
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//normalizeSchedule replaces empty slices with nil, so schedules loaded from the database hash the same as ones created in memory
+func normalizeSchedule(Schedule Schedule) Schedule {
+	if len(Schedule.Overrides) == 0 {
+		Schedule.Overrides = nil
+		return Schedule
+	}
+
+	overrides := make([]IntervalOverride, len(Schedule.Overrides))
+	for i, k := range Schedule.Overrides {
+		if len(k.Weekdays) == 0 {
+			k.Weekdays = nil
+		}
+		overrides[i] = k
+	}
+	Schedule.Overrides = overrides
+
+	return Schedule
+}
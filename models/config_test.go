@@ -0,0 +1,176 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//configAgent returns a populated linux agent, whose template contains a linux and a windows item
+func configAgent() Agent {
+	linux := Item{ID: primitive.NewObjectID(), Name: "mysql.ping", Interval: 60, CheckOn: Linux, Command: "mysqladmin -P {$MYSQL.PORT} -h {AGENT.ENDPOINT} ping"}
+	windows := Item{ID: primitive.NewObjectID(), Name: "iis.ping", Interval: 60, CheckOn: Windows, Command: "ping"}
+	template := Template{
+		ID:      primitive.NewObjectID(),
+		Name:    "mysql",
+		ItemIDs: []primitive.ObjectID{linux.ID, windows.ID},
+		Items:   []Item{linux, windows},
+		Macros:  map[string]string{"MYSQL.PORT": "3306"},
+	}
+
+	return Agent{
+		ID:             primitive.NewObjectID(),
+		Name:           "db1",
+		AgentUUID:      uuid.New(),
+		Enabled:        true,
+		OS:             Linux,
+		Endpoint:       "10.0.0.1",
+		ScrapeInterval: 60,
+		TemplateIDs:    []primitive.ObjectID{template.ID},
+		Templates:      []Template{template},
+		Macros:         map[string]string{"MYSQL.PORT": "3307"},
+	}
+}
+
+func mustNewAgentConfig(t *testing.T, Agent Agent) AgentConfig {
+	config, err := NewAgentConfig(Agent)
+	if err != nil {
+		t.Fatal("couldn't build config:", err)
+	}
+
+	return config
+}
+
+//roundTrip stores the value in bson and loads it into Into, like a document which is written to and read from the database
+func roundTrip(t *testing.T, Value interface{}, Into interface{}) {
+	encoded, err := bson.Marshal(Value)
+	if err != nil {
+		t.Fatal("couldn't marshal:", err)
+	}
+	if err := bson.Unmarshal(encoded, Into); err != nil {
+		t.Fatal("couldn't unmarshal:", err)
+	}
+}
+
+func TestNewAgentConfig(t *testing.T) {
+	agent := configAgent()
+	config := mustNewAgentConfig(t, agent)
+
+	if len(config.Items) != 1 || config.Items[0].Name != "mysql.ping" {
+		t.Fatalf("only the linux item should be part of the config: %+v", config.Items)
+	}
+	if command := config.Items[0].Command; command != "mysqladmin -P 3307 -h 10.0.0.1 ping" {
+		t.Fatal("macros weren't resolved:", command)
+	}
+	if !config.Unchanged(config.ETag) || config.Unchanged("") {
+		t.Fatal("config with ETag", config.ETag, "is reported as changed")
+	}
+
+	agent.Enabled = false
+	if disabled := mustNewAgentConfig(t, agent); len(disabled.Items) != 0 || disabled.ETag == config.ETag {
+		t.Fatalf("disabled agent has items: %+v", disabled)
+	}
+}
+
+func TestAgentConfigETag(t *testing.T) {
+	agent := configAgent()
+	etag := mustNewAgentConfig(t, agent).ETag
+
+	changedCommand := configAgent()
+	changedCommand.ID, changedCommand.AgentUUID = agent.ID, agent.AgentUUID
+	changedCommand.Templates[0].Items[0].Command = "true"
+
+	reordered := agent
+	reordered.Templates = []Template{agent.Templates[0]}
+	reordered.Templates[0].Items = []Item{agent.Templates[0].Items[1], agent.Templates[0].Items[0]}
+
+	changedDescription := agent
+	changedDescription.Description = "primary database"
+
+	cases := []struct {
+		name    string
+		agent   Agent
+		changed bool
+	}{
+		{"same agent", agent, false},
+		{"items reordered", reordered, false},
+		{"description changed", changedDescription, false},
+		{"command changed", changedCommand, true},
+	}
+
+	for _, k := range cases {
+		if got := mustNewAgentConfig(t, k.agent).ETag; (got != etag) != k.changed {
+			t.Errorf("%s: got ETag %s, want changed %v", k.name, got, k.changed)
+		}
+	}
+}
+
+func TestAgentConfigRoundTrip(t *testing.T) {
+	agent := configAgent()
+	item := agent.Templates[0].Items[0]
+	//Schedules created in memory usually have nil slices, while ones loaded from the database contain empty slices
+	agent.ItemSchedules = []ItemSchedule{{ItemID: item.ID, Schedule: Schedule{Interval: 300, Overrides: []IntervalOverride{{StartTime: "09:00", EndTime: "17:00", Interval: 30}}}}}
+	etag := mustNewAgentConfig(t, agent).ETag
+
+	stored := agent
+	stored.ItemSchedules = []ItemSchedule{{ItemID: item.ID, Schedule: Schedule{Interval: 300, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}}}}
+	var loaded Agent
+	roundTrip(t, stored, &loaded)
+	var template Template
+	roundTrip(t, stored.Templates[0], &template)
+	template.Items = make([]Item, 0)
+	for _, k := range stored.Templates[0].Items {
+		var item Item
+		roundTrip(t, k, &item)
+		template.Items = append(template.Items, item)
+	}
+	loaded.Templates = []Template{template}
+
+	if got := mustNewAgentConfig(t, loaded).ETag; got != etag {
+		t.Fatal("ETag changed after loading the agent from the database:", got, etag)
+	}
+}
+
+func TestNormalizeSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		schedule Schedule
+		want     Schedule
+	}{
+		{"nil overrides", Schedule{Interval: 60}, Schedule{Interval: 60}},
+		{"empty overrides", Schedule{Interval: 60, Overrides: []IntervalOverride{}}, Schedule{Interval: 60}},
+		{
+			"empty weekdays",
+			Schedule{Interval: 60, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}},
+			Schedule{Interval: 60, Overrides: []IntervalOverride{{StartTime: "09:00", EndTime: "17:00", Interval: 30}}},
+		},
+		{
+			"weekdays are kept",
+			Schedule{Interval: 60, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{time.Monday}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}},
+			Schedule{Interval: 60, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{time.Monday}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}},
+		},
+	}
+
+	for _, k := range cases {
+		got := normalizeSchedule(k.schedule)
+		if got.Interval != k.want.Interval || (got.Overrides == nil) != (k.want.Overrides == nil) || len(got.Overrides) != len(k.want.Overrides) {
+			t.Errorf("%s: got %+v, want %+v", k.name, got, k.want)
+			continue
+		}
+		for i := range got.Overrides {
+			if (got.Overrides[i].Weekdays == nil) != (k.want.Overrides[i].Weekdays == nil) || len(got.Overrides[i].Weekdays) != len(k.want.Overrides[i].Weekdays) {
+				t.Errorf("%s: got override %+v, want %+v", k.name, got.Overrides[i], k.want.Overrides[i])
+			}
+		}
+	}
+
+	//The overrides of the original schedule mustn't be modified
+	overrides := []IntervalOverride{{Weekdays: []time.Weekday{}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}
+	normalizeSchedule(Schedule{Interval: 60, Overrides: overrides})
+	if overrides[0].Weekdays == nil {
+		t.Fatal("original schedule was modified")
+	}
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//CronExpression is a parsed cron expression
+//Expressions consist of five fields (minute hour day-of-month month day-of-week) or six fields with a leading seconds field
+//Fields support *, ?, lists (1,2), ranges (1-5), steps (*/15, 10-40/5) and the names of months (jan) and weekdays (mon)
+//The macros @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are supported as well
+type CronExpression struct {
+	seconds, minutes, hours, days, months, weekdays uint64
+	//If both the day of month and the day of week are restricted, a day matches if either of them matches (like in cron)
+	anyDay, anyWeekday bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+var (
+	cronSeconds  = cronField{name: "second", min: 0, max: 59}
+	cronMinutes  = cronField{name: "minute", min: 0, max: 59}
+	cronHours    = cronField{name: "hour", min: 0, max: 23}
+	cronDays     = cronField{name: "day of month", min: 1, max: 31}
+	cronMonths   = cronField{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	cronWeekdays = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+//cronSearchLimit limits how far Next searches for a matching time, expressions like "0 0 30 2 *" never match
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+//ParseCron parses the cron expression
+func ParseCron(Expression string) (CronExpression, error) {
+	expression := strings.TrimSpace(Expression)
+	if macro, found := cronMacros[strings.ToLower(expression)]; found {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return CronExpression{}, errors.New("cron expression has to consist of five or six fields")
+	}
+
+	var c CronExpression
+	var err error
+	if c.seconds, err = cronSeconds.parse(fields[0]); err != nil {
+		return CronExpression{}, err
+	}
+	if c.minutes, err = cronMinutes.parse(fields[1]); err != nil {
+		return CronExpression{}, err
+	}
+	if c.hours, err = cronHours.parse(fields[2]); err != nil {
+		return CronExpression{}, err
+	}
+	if c.days, err = cronDays.parse(fields[3]); err != nil {
+		return CronExpression{}, err
+	}
+	if c.months, err = cronMonths.parse(fields[4]); err != nil {
+		return CronExpression{}, err
+	}
+	if c.weekdays, err = cronWeekdays.parse(fields[5]); err != nil {
+		return CronExpression{}, err
+	}
+
+	//7 is an alias for sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.anyDay = fields[3] == "*" || fields[3] == "?"
+	c.anyWeekday = fields[5] == "*" || fields[5] == "?"
+
+	return c, nil
+}
+
+//parse returns the bitset of the values matched by the field
+func (f cronField) parse(Field string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(strings.ToLower(Field), ",") {
+		valueRange, stepText, hasStep := cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron %s has an invalid step: %s", f.name, part)
+			}
+		}
+
+		start, end := f.min, f.max
+		if valueRange != "*" && valueRange != "?" {
+			startText, endText, isRange := cut(valueRange, "-")
+
+			var err error
+			if start, err = f.value(startText); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = f.value(endText); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				//A step without a range (e.g. 5/15) runs from the value to the maximum
+				end = f.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("cron %s has an invalid range: %s", f.name, part)
+			}
+		}
+
+		for k := start; k <= end; k += step {
+			bits |= 1 << uint(k)
+		}
+	}
+
+	return bits, nil
+}
+
+//cut splits the text around the first separator, the returned bool is false if the separator isn't found
+func cut(Text string, Separator string) (string, string, bool) {
+	if i := strings.Index(Text, Separator); i >= 0 {
+		return Text[:i], Text[i+len(Separator):], true
+	}
+
+	return Text, "", false
+}
+
+func (f cronField) value(Text string) (int, error) {
+	if value, found := f.names[Text]; found {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(Text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("cron %s has to be between %d and %d: %s", f.name, f.min, f.max, Text)
+	}
+
+	return value, nil
+}
+
+//Next returns the first time after the specified time which matches the expression, using the location of After
+//A zero time is returned if the expression doesn't match within the next five years
+func (c CronExpression) Next(After time.Time) time.Time {
+	location := After.Location()
+	t := After.Truncate(time.Second).Add(time.Second)
+	limit := After.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		//Hours, minutes and seconds are skipped on the absolute time, so the search never moves backwards during daylight saving changes
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if c.seconds&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c CronExpression) matchesDay(Day time.Time) bool {
+	day := c.days&(1<<uint(Day.Day())) != 0
+	weekday := c.weekdays&(1<<uint(Day.Weekday())) != 0
+
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+
+	return day || weekday
+}
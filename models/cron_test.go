@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, k := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"mon * * * *",
+		"@often",
+	} {
+		if _, err := ParseCron(k); err == nil {
+			t.Errorf("%q: invalid expression was accepted", k)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	at := func(Year int, Month time.Month, Day, Hour, Minute, Second int) time.Time {
+		return time.Date(Year, Month, Day, Hour, Minute, Second, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name       string
+		expression string
+		after      time.Time
+		want       time.Time
+	}{
+		{"every minute", "* * * * *", at(2021, 8, 10, 10, 2, 30), at(2021, 8, 10, 10, 3, 0)},
+		{"exact time is excluded", "*/5 * * * *", at(2021, 8, 10, 10, 5, 0), at(2021, 8, 10, 10, 10, 0)},
+		{"step from value", "5/20 * * * *", at(2021, 8, 10, 10, 6, 0), at(2021, 8, 10, 10, 25, 0)},
+		{"step from value wraps", "5/20 * * * *", at(2021, 8, 10, 10, 45, 0), at(2021, 8, 10, 11, 5, 0)},
+		{"step within range", "10-40/15 * * * *", at(2021, 8, 10, 10, 26, 0), at(2021, 8, 10, 10, 40, 0)},
+		{"list", "0 6,18 * * *", at(2021, 8, 10, 7, 0, 0), at(2021, 8, 10, 18, 0, 0)},
+		{"seconds", "*/30 * * * * *", at(2021, 8, 10, 10, 0, 10), at(2021, 8, 10, 10, 0, 30)},
+		{"names", "0 0 1 jan *", at(2021, 8, 10, 0, 0, 0), at(2022, 1, 1, 0, 0, 0)},
+		{"macro", "@hourly", at(2021, 8, 10, 10, 0, 0), at(2021, 8, 10, 11, 0, 0)},
+		//2021-08-15 is a sunday
+		{"day of month only", "0 0 15 * *", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 15, 0, 0, 0)},
+		{"day of week only", "0 0 * * mon", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 16, 0, 0, 0)},
+		{"day of month or week", "0 0 15 * 1", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 15, 0, 0, 0)},
+		{"day of week or month", "0 0 15 * 1", at(2021, 8, 15, 0, 0, 0), at(2021, 8, 16, 0, 0, 0)},
+		{"question mark", "0 0 ? * 1", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 16, 0, 0, 0)},
+		{"7 is sunday", "0 0 * * 7", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 15, 0, 0, 0)},
+		{"0 is sunday", "0 0 * * 0", at(2021, 8, 10, 0, 0, 0), at(2021, 8, 15, 0, 0, 0)},
+		{"february 29th", "0 0 29 2 *", at(2021, 3, 1, 0, 0, 0), at(2024, 2, 29, 0, 0, 0)},
+		{"february 30th never matches", "0 0 30 2 *", at(2021, 3, 1, 0, 0, 0), time.Time{}},
+		//2100 isn't a leap year, so the next february 29th is more than five years away
+		{"five year limit", "0 0 29 2 *", at(2096, 3, 1, 0, 0, 0), time.Time{}},
+		{"31st skips short months", "0 12 31 * *", at(2021, 4, 1, 0, 0, 0), at(2021, 5, 31, 12, 0, 0)},
+		{"year wraps", "0 0 1 1 *", at(2021, 12, 31, 23, 59, 59), at(2022, 1, 1, 0, 0, 0)},
+		//Clocks in New York skip from 02:00 to 03:00 on 2021-03-14, so 02:30 doesn't exist on that day
+		{"dst gap is skipped", "30 2 * * *", time.Date(2021, 3, 14, 0, 0, 0, 0, newYork), time.Date(2021, 3, 15, 2, 30, 0, 0, newYork)},
+		{"dst gap", "0 3 * * *", time.Date(2021, 3, 14, 0, 0, 0, 0, newYork), time.Date(2021, 3, 14, 3, 0, 0, 0, newYork)},
+		//Clocks in New York go back from 02:00 to 01:00 on 2021-11-07, hourly expressions still run every hour
+		{"dst overlap", "0 * * * *", time.Date(2021, 11, 7, 5, 0, 0, 0, time.UTC).In(newYork), time.Date(2021, 11, 7, 6, 0, 0, 0, time.UTC)},
+	}
+
+	for _, k := range cases {
+		cron, err := ParseCron(k.expression)
+		if err != nil {
+			t.Errorf("%s: %v", k.name, err)
+			continue
+		}
+
+		if got := cron.Next(k.after); !got.Equal(k.want) {
+			t.Errorf("%s: %q after %s returned %s, want %s", k.name, k.expression, k.after, got, k.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//EscalationPolicy defines who is notified if a problem isn't acknowledged or resolved in time
+//Policies are attached to problems via severities and templates, empty filters match everything
+type EscalationPolicy struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Name, Description string
+	Enabled           bool
+	Severities        []TriggerSeverity
+	TemplateIDs       []primitive.ObjectID
+	Steps             []EscalationStep
+}
+
+//EscalationStep is a single stage of an escalation policy
+type EscalationStep struct {
+	//Delay is the time in seconds after the start of the problem at which the step is executed
+	Delay int
+	//Channels contains the names of the notification channels which are notified
+	Channels []string
+	//Repeat defines how often the notification is repeated after the first one
+	//Repetitions stop as soon as the next step starts
+	Repeat int
+	//RepeatInterval is the time in seconds between two repetitions
+	RepeatInterval int
+}
+
+//Validate checks if the escalation policy can be stored in the database
+func (p EscalationPolicy) Validate() error {
+	if stringHelper.IsEmpty(p.Name) {
+		return errors.New("escalation policy name can't be empty")
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("escalation policy needs at least one step")
+	}
+	for _, k := range p.Severities {
+		if !k.Valid() {
+			return errors.New("escalation policy has an unknown severity")
+		}
+	}
+
+	for i, k := range p.Steps {
+		if k.Delay < 0 {
+			return errors.New("escalation step delay can't be negative")
+		}
+		if i > 0 && k.Delay < p.Steps[i-1].Delay {
+			return errors.New("escalation steps have to be ordered by their delay")
+		}
+		if len(k.Channels) == 0 {
+			return errors.New("escalation step needs at least one channel")
+		}
+		if k.Repeat < 0 {
+			return errors.New("escalation step repeat count can't be negative")
+		}
+		if k.Repeat > 0 && k.RepeatInterval <= 0 {
+			return errors.New("escalation step repeat interval has to be greater than zero")
+		}
+	}
+
+	return nil
+}
+
+//Matches returns true if the policy applies to the problem of the trigger on the agent
+//The agent has to be populated if the policy is scoped to templates
+func (p EscalationPolicy) Matches(Agent Agent, TriggerID primitive.ObjectID, Severity TriggerSeverity) bool {
+	if !p.Enabled {
+		return false
+	}
+
+	if len(p.Severities) > 0 {
+		found := false
+		for _, k := range p.Severities {
+			if k == Severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(p.TemplateIDs) > 0 {
+		found := false
+		for _, template := range Agent.Templates {
+			for _, k := range p.TemplateIDs {
+				if k == template.ID && template.HasTrigger(TriggerID) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+//EscalationNotification is a single notification planned by an escalation policy
+type EscalationNotification struct {
+	Step       int
+	Repetition int
+	Due        time.Time
+	Channels   []string
+}
+
+//Timeline returns all notifications of the policy for a problem which started at ProblemSince ordered by their due time
+func (p EscalationPolicy) Timeline(ProblemSince time.Time) []EscalationNotification {
+	timeline := make([]EscalationNotification, 0)
+
+	for i, step := range p.Steps {
+		start := ProblemSince.Add(time.Duration(step.Delay) * time.Second)
+
+		for repetition := 0; repetition <= step.Repeat; repetition++ {
+			due := start.Add(time.Duration(repetition*step.RepeatInterval) * time.Second)
+
+			//Repetitions stop as soon as the next step starts
+			if repetition > 0 && i+1 < len(p.Steps) && !due.Before(ProblemSince.Add(time.Duration(p.Steps[i+1].Delay)*time.Second)) {
+				break
+			}
+
+			timeline = append(timeline, EscalationNotification{
+				Step:       i,
+				Repetition: repetition,
+				Due:        due,
+				Channels:   step.Channels,
+			})
+		}
+	}
+
+	return timeline
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//TriggerEvent stores a single state change of a trigger assignment
+//Events are stored in their own collection, so the agent document doesn't grow with every state change of a flapping trigger
+type TriggerEvent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	AgentID     primitive.ObjectID
+	TriggerID   primitive.ObjectID
+	Time        time.Time
+	Problematic bool
+	Severity    TriggerSeverity
+	Error       string
+	//User is set if the state change was made manually by an operator (e.g. by closing the problem)
+	User string
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -13,7 +16,10 @@ type Item struct {
 	Interval          int //Interval is set in seconds
 	Command           string
 	CheckOn           AgentOS //Execute this item only on this os
-
+	//Cron replaces Interval if set, Timezone and IntervalOverrides are used as described in Schedule
+	Cron              string
+	Timezone          string
+	IntervalOverrides []IntervalOverride
 }
 
 //ReturnType defines which type of information is returned by the check
@@ -25,3 +31,29 @@ const (
 	//Text is set if the check returns text
 	Text
 )
+
+//Valid returns true if the ReturnType is one of the known return types
+func (r ReturnType) Valid() bool {
+	return r == Numeric || r == Text
+}
+
+//Validate checks if the item can be stored in the database
+func (i Item) Validate() error {
+	if stringHelper.IsEmpty(i.Name) {
+		return errors.New("item name can't be empty")
+	}
+	if err := i.Schedule().Validate(); err != nil {
+		return err
+	}
+	if !i.Returns.Valid() {
+		return errors.New("item has an unknown return type")
+	}
+	if !i.CheckOn.Valid() {
+		return errors.New("item has to be checked on a supported os")
+	}
+	if stringHelper.IsEmpty(i.Command) {
+		return errors.New("item command can't be empty")
+	}
+
+	return nil
+}
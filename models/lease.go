@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//ScraperLease stores which scraper is allowed to poll an agent
+//Leases are acquired, renewed and released via the lease functions of dbtemplate
+type ScraperLease struct {
+	//UUID identifies the scraper holding the lease, it is uuid.Nil if the lease was released
+	UUID uuid.UUID
+	//Lock is the time the lease was acquired or renewed the last time
+	Lock time.Time
+	//Expires is the time the lease can be acquired by another scraper
+	Expires time.Time
+	//Token is the fencing token, it is increased every time the lease is acquired and never reset
+	//Writes carrying an older token are rejected, so a scraper which lost its lease can't overwrite newer data
+	Token int64
+	//Acquired is the time the lease was acquired, renewals don't change it
+	Acquired time.Time
+}
+
+//Free returns true if the lease isn't held by any scraper at the specified time
+func (l ScraperLease) Free(At time.Time) bool {
+	return l.UUID == uuid.Nil || !l.Expires.After(At)
+}
+
+//Stale returns true if the result was stored by a scraper, which lost the lease to the current holder while storing it
+//Such results carry an older fencing token, but were captured after the current lease was acquired
+func (l ScraperLease) Stale(Result Result) bool {
+	return Result.FencingToken != 0 && Result.FencingToken < l.Token && !Result.CapturedAt.Before(l.Acquired)
+}
+
+//HeldBy returns true if the specified scraper holds the lease at the specified time
+func (l ScraperLease) HeldBy(Scraper uuid.UUID, At time.Time) bool {
+	return Scraper != uuid.Nil && l.UUID == Scraper && l.Expires.After(At)
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//LifecycleState defines in which stage of its lifecycle an agent is
+type LifecycleState string
+
+const (
+	//LifecyclePending is set for registered agents which still have to be approved
+	LifecyclePending LifecycleState = "pending"
+	//LifecycleActive is set for agents which are scraped
+	LifecycleActive LifecycleState = "active"
+	//LifecycleDisabled is set for agents which were disabled temporarily
+	LifecycleDisabled LifecycleState = "disabled"
+	//LifecycleDecommissioned is set for agents which were taken out of service, but whose configuration and history is kept
+	LifecycleDecommissioned LifecycleState = "decommissioned"
+	//LifecycleDeleted is set for soft-deleted agents, they can be restored until they are purged
+	LifecycleDeleted LifecycleState = "deleted"
+)
+
+//ErrInvalidTransition is returned if an agent should be moved into a lifecycle state which can't be reached from its current state
+var ErrInvalidTransition = errors.New("invalid lifecycle transition")
+
+//lifecycleTransitions contains the states which can be reached from each state
+//Deleted agents can only leave their state via Restore
+var lifecycleTransitions = map[LifecycleState][]LifecycleState{
+	LifecyclePending:        {LifecycleActive, LifecycleDeleted},
+	LifecycleActive:         {LifecycleDisabled, LifecycleDecommissioned, LifecycleDeleted},
+	LifecycleDisabled:       {LifecycleActive, LifecycleDecommissioned, LifecycleDeleted},
+	LifecycleDecommissioned: {LifecycleDisabled, LifecycleDeleted},
+	LifecycleDeleted:        {},
+}
+
+//LifecycleTransition records a single change of the lifecycle state of an agent
+type LifecycleTransition struct {
+	From, To LifecycleState
+	Time     time.Time
+	User     string
+}
+
+//Valid returns true if the state is a known lifecycle state
+func (s LifecycleState) Valid() bool {
+	_, found := lifecycleTransitions[s]
+	return found
+}
+
+//CanTransitionTo returns true if the state can be changed to the target state
+func (s LifecycleState) CanTransitionTo(Target LifecycleState) bool {
+	for _, k := range lifecycleTransitions[s] {
+		if k == Target {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Lifecycle returns the current lifecycle state of the agent
+//Agents stored before lifecycle states were introduced have their state derived from the Enabled, Deleted and Pending flags
+func (a Agent) Lifecycle() LifecycleState {
+	if a.LifecycleState != "" {
+		return a.LifecycleState
+	}
+
+	switch {
+	case a.Deleted:
+		return LifecycleDeleted
+	case a.Pending:
+		return LifecyclePending
+	case a.Enabled:
+		return LifecycleActive
+	}
+
+	return LifecycleDisabled
+}
+
+//LifecycleSince returns when the agent entered the specified state the last time
+//The zero time is returned if the agent never entered the state or the transition wasn't recorded
+func (a Agent) LifecycleSince(State LifecycleState) time.Time {
+	for i := len(a.LifecycleTransitions) - 1; i >= 0; i-- {
+		if a.LifecycleTransitions[i].To == State {
+			return a.LifecycleTransitions[i].Time
+		}
+	}
+
+	return time.Time{}
+}
+
+//TransitionTo returns the transition which moves the agent into the specified state
+//ErrInvalidTransition is returned if the state can't be reached from the current state
+func (a Agent) TransitionTo(State LifecycleState, User string, At time.Time) (LifecycleTransition, error) {
+	current := a.Lifecycle()
+	if !current.CanTransitionTo(State) {
+		return LifecycleTransition{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, current, State)
+	}
+
+	return LifecycleTransition{From: current, To: State, Time: At, User: User}, nil
+}
+
+//RestoreTransition returns the transition which moves a deleted agent back into the state it had before it was deleted
+//Agents whose previous state is unknown are restored as disabled, so they aren't scraped unexpectedly
+func (a Agent) RestoreTransition(User string, At time.Time) (LifecycleTransition, error) {
+	if a.Lifecycle() != LifecycleDeleted {
+		return LifecycleTransition{}, fmt.Errorf("%w: only deleted agents can be restored", ErrInvalidTransition)
+	}
+
+	target := LifecycleDisabled
+	for i := len(a.LifecycleTransitions) - 1; i >= 0; i-- {
+		if k := a.LifecycleTransitions[i]; k.To == LifecycleDeleted && k.From.Valid() && k.From != LifecycleDeleted {
+			target = k.From
+			break
+		}
+	}
+
+	return LifecycleTransition{From: LifecycleDeleted, To: target, Time: At, User: User}, nil
+}
+
+//ApplyTransition returns the agent with the transition applied
+//The Enabled, Deleted and Pending flags are kept in line with the new state
+func (a Agent) ApplyTransition(Transition LifecycleTransition) Agent {
+	a.LifecycleState = Transition.To
+	a.LifecycleChanged = Transition.Time
+	a.LifecycleTransitions = append(append(make([]LifecycleTransition, 0, len(a.LifecycleTransitions)+1), a.LifecycleTransitions...), Transition)
+	a.Enabled = Transition.To == LifecycleActive
+	a.Deleted = Transition.To == LifecycleDeleted
+	a.Pending = Transition.To == LifecyclePending
+
+	return a
+}
+
+//Purgeable returns true if the agent was deleted longer than the grace period ago
+//Agents deleted before lifecycle states were introduced have no deletion time and are purgeable right away
+func (a Agent) Purgeable(GracePeriod time.Duration, At time.Time) bool {
+	if a.Lifecycle() != LifecycleDeleted {
+		return false
+	}
+
+	return !a.LifecycleChanged.Add(GracePeriod).After(At)
+}
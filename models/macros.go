@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+//macroPattern matches user macros like {$MYSQL.PORT} and built-in macros like {AGENT.NAME}
+var macroPattern = regexp.MustCompile(`\{\$?[A-Z0-9_.]+\}`)
+
+//macroNamePattern matches the names of user macros, which are stored without braces and dollar sign (e.g. MYSQL.PORT)
+var macroNamePattern = regexp.MustCompile(`^[A-Z0-9_.]+$`)
+
+//validateMacros checks if all user macros have valid names
+func validateMacros(Macros map[string]string) error {
+	for k := range Macros {
+		if !macroNamePattern.MatchString(k) {
+			return errors.New("macro names may only contain upper case letters, digits, dots and underscores")
+		}
+	}
+
+	return nil
+}
+
+//MacroValues returns the values of all macros available on the agent, indexed by the macro as it's written in commands
+//User macros of the agent override the ones of its templates, templates linked first override templates linked later
+//The built-in macros {AGENT.ID}, {AGENT.UUID}, {AGENT.NAME}, {AGENT.OS} and {AGENT.ENDPOINT} can't be overridden
+func (a Agent) MacroValues() map[string]string {
+	values := make(map[string]string)
+
+	for i := len(a.Templates) - 1; i >= 0; i-- {
+		for k, v := range a.Templates[i].Macros {
+			values["{$"+k+"}"] = v
+		}
+	}
+	for k, v := range a.Macros {
+		values["{$"+k+"}"] = v
+	}
+
+	values["{AGENT.ID}"] = a.ID.Hex()
+	values["{AGENT.UUID}"] = a.AgentUUID.String()
+	values["{AGENT.NAME}"] = a.Name
+	values["{AGENT.OS}"] = strings.ToLower(a.OS.String())
+	values["{AGENT.ENDPOINT}"] = a.Endpoint
+
+	return values
+}
+
+//ResolveMacros replaces all macros in the text with their values on the agent
+//Unknown macros are kept as they are, macros within macro values aren't resolved
+//The agent has to be populated, otherwise the macros of its templates can't be resolved
+func (a Agent) ResolveMacros(Text string) string {
+	return resolveMacros(Text, a.MacroValues())
+}
+
+func resolveMacros(Text string, Values map[string]string) string {
+	return macroPattern.ReplaceAllStringFunc(Text, func(Macro string) string {
+		if value, found := Values[Macro]; found {
+			return value
+		}
+
+		return Macro
+	})
+}
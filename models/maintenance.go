@@ -0,0 +1,307 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Maintenance defines time ranges during which problems of the covered agents / triggers are suppressed
+type Maintenance struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Name, Description string
+	//DropData defines if the covered items should no longer be checked during the maintenance
+	//By default data is still collected, only problems are suppressed
+	DropData bool
+	Scope    MaintenanceScope
+	//Start and End define the maintenance window for one-off maintenances
+	//For recurring maintenances they limit the period in which the recurrence is active (a zero End means forever)
+	Start, End time.Time
+	Recurrence MaintenanceRecurrence
+}
+
+//MaintenanceScope defines which agents / triggers are covered by a maintenance
+type MaintenanceScope struct {
+	//AgentIDs covers all triggers and items of the agents
+	AgentIDs []primitive.ObjectID
+	//TemplateIDs covers the triggers and items of the templates on every agent linked to them
+	TemplateIDs []primitive.ObjectID
+	//Tags covers all triggers and items of agents with at least one of the tags
+	Tags []string
+}
+
+//RecurrenceType defines how often a maintenance window repeats
+type RecurrenceType int
+
+const (
+	//Once is used for one-off maintenances, the window is defined by Start and End
+	Once RecurrenceType = iota
+	//Daily repeats the maintenance window every day
+	Daily
+	//Weekly repeats the maintenance window on the specified weekdays
+	Weekly
+	//Monthly repeats the maintenance window on the specified days of the month
+	Monthly
+)
+
+//MaintenanceRecurrence defines the windows of recurring maintenances
+type MaintenanceRecurrence struct {
+	Type        RecurrenceType
+	Weekdays    []time.Weekday //Used by Weekly
+	DaysOfMonth []int          //Used by Monthly (1-31)
+	StartTime   string         //Local start time of every window in the format HH:MM
+	Duration    int            //Length of every window in seconds
+	Timezone    string         //IANA timezone name, UTC is used if empty
+}
+
+//MaintenanceWindow is a single occurrence of a maintenance
+type MaintenanceWindow struct {
+	Start, End time.Time
+}
+
+//Validate checks if the maintenance can be stored in the database
+func (m Maintenance) Validate() error {
+	if stringHelper.IsEmpty(m.Name) {
+		return errors.New("maintenance name can't be empty")
+	}
+	if len(m.Scope.AgentIDs) == 0 && len(m.Scope.TemplateIDs) == 0 && len(m.Scope.Tags) == 0 {
+		return errors.New("maintenance has to cover at least one agent, template or tag")
+	}
+
+	if m.Recurrence.Type == Once {
+		if !m.End.After(m.Start) {
+			return errors.New("maintenance has to end after it starts")
+		}
+		return nil
+	}
+
+	if !m.End.IsZero() && !m.End.After(m.Start) {
+		return errors.New("maintenance has to end after it starts")
+	}
+	if m.Recurrence.Duration <= 0 {
+		return errors.New("maintenance window duration has to be greater than zero")
+	}
+	if _, err := time.Parse("15:04", m.Recurrence.StartTime); err != nil {
+		return errors.New("maintenance start time has to be in the format HH:MM")
+	}
+	if _, err := time.LoadLocation(m.Recurrence.Timezone); err != nil {
+		return errors.New("maintenance has an unknown timezone")
+	}
+
+	switch m.Recurrence.Type {
+	case Daily:
+	case Weekly:
+		if len(m.Recurrence.Weekdays) == 0 {
+			return errors.New("weekly maintenance needs at least one weekday")
+		}
+	case Monthly:
+		if len(m.Recurrence.DaysOfMonth) == 0 {
+			return errors.New("monthly maintenance needs at least one day of month")
+		}
+		for _, k := range m.Recurrence.DaysOfMonth {
+			if k < 1 || k > 31 {
+				return errors.New("days of month have to be between 1 and 31")
+			}
+		}
+	default:
+		return errors.New("maintenance has an unknown recurrence type")
+	}
+
+	return nil
+}
+
+//Occurrences returns all maintenance windows overlapping the period between From and To
+func (m Maintenance) Occurrences(From, To time.Time) []MaintenanceWindow {
+	windows := make([]MaintenanceWindow, 0)
+
+	if m.Recurrence.Type == Once {
+		if m.Start.Before(To) && m.End.After(From) {
+			windows = append(windows, MaintenanceWindow{Start: m.Start, End: m.End})
+		}
+		return windows
+	}
+
+	location, err := time.LoadLocation(m.Recurrence.Timezone)
+	if err != nil {
+		return windows
+	}
+	startTime, err := time.Parse("15:04", m.Recurrence.StartTime)
+	if err != nil || m.Recurrence.Duration <= 0 {
+		return windows
+	}
+	duration := time.Duration(m.Recurrence.Duration) * time.Second
+
+	//Windows starting before From may still overlap the period
+	first := From.Add(-duration).In(location)
+	last := To.In(location)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, location)
+
+	for !day.After(last) {
+		if m.Recurrence.matchesDay(day) {
+			window := MaintenanceWindow{Start: time.Date(day.Year(), day.Month(), day.Day(), startTime.Hour(), startTime.Minute(), 0, 0, location)}
+			window.End = window.Start.Add(duration)
+
+			//Limit the window to the period in which the recurrence is active
+			if window.Start.Before(m.Start) {
+				window.Start = m.Start
+			}
+			if !m.End.IsZero() && window.End.After(m.End) {
+				window.End = m.End
+			}
+
+			if window.Start.Before(window.End) && window.Start.Before(To) && window.End.After(From) {
+				windows = append(windows, window)
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return windows
+}
+
+func (r MaintenanceRecurrence) matchesDay(Day time.Time) bool {
+	switch r.Type {
+	case Daily:
+		return true
+	case Weekly:
+		for _, k := range r.Weekdays {
+			if k == Day.Weekday() {
+				return true
+			}
+		}
+	case Monthly:
+		for _, k := range r.DaysOfMonth {
+			if k == Day.Day() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//Active returns true if the maintenance is active at the specified time
+func (m Maintenance) Active(At time.Time) bool {
+	for _, k := range m.Occurrences(At, At.Add(time.Nanosecond)) {
+		if !At.Before(k.Start) && At.Before(k.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//CoversAgent returns true if the maintenance covers the whole agent (via its ID or tags)
+func (m Maintenance) CoversAgent(Agent Agent) bool {
+	for _, k := range m.Scope.AgentIDs {
+		if k == Agent.ID {
+			return true
+		}
+	}
+
+	for _, k := range m.Scope.Tags {
+		if Agent.HasTag(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//CoversTrigger returns true if the maintenance covers the trigger on the specified agent
+//The agent has to be populated if the maintenance is scoped to templates
+func (m Maintenance) CoversTrigger(Agent Agent, TriggerID primitive.ObjectID) bool {
+	if m.CoversAgent(Agent) {
+		return true
+	}
+
+	for _, template := range m.scopedTemplates(Agent) {
+		for _, k := range template.TriggerIDs {
+			if k == TriggerID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//CoversItem returns true if the maintenance covers the item on the specified agent
+//The agent has to be populated if the maintenance is scoped to templates
+func (m Maintenance) CoversItem(Agent Agent, ItemID primitive.ObjectID) bool {
+	if m.CoversAgent(Agent) {
+		return true
+	}
+
+	for _, template := range m.scopedTemplates(Agent) {
+		for _, k := range template.ItemIDs {
+			if k == ItemID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//scopedTemplates returns all templates of the agent which are covered by the maintenance
+func (m Maintenance) scopedTemplates(Agent Agent) []Template {
+	templates := make([]Template, 0)
+	for _, template := range Agent.Templates {
+		for _, k := range m.Scope.TemplateIDs {
+			if k == template.ID {
+				templates = append(templates, template)
+				break
+			}
+		}
+	}
+
+	return templates
+}
+
+//ActiveMaintenances returns all maintenances which are active at the specified time
+func ActiveMaintenances(Maintenances []Maintenance, At time.Time) []Maintenance {
+	active := make([]Maintenance, 0)
+	for _, k := range Maintenances {
+		if k.Active(At) {
+			active = append(active, k)
+		}
+	}
+
+	return active
+}
+
+//InMaintenance returns true if the whole agent is covered by an active maintenance
+func (a Agent) InMaintenance(Maintenances []Maintenance, At time.Time) bool {
+	for _, k := range Maintenances {
+		if k.Active(At) && k.CoversAgent(a) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//TriggerInMaintenance returns true if the trigger of the agent is covered by an active maintenance
+func (a Agent) TriggerInMaintenance(Maintenances []Maintenance, TriggerID primitive.ObjectID, At time.Time) bool {
+	for _, k := range Maintenances {
+		if k.Active(At) && k.CoversTrigger(a, TriggerID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//CollectItem returns false if the item of the agent is covered by an active maintenance, which disables data collection
+func (a Agent) CollectItem(Maintenances []Maintenance, ItemID primitive.ObjectID, At time.Time) bool {
+	for _, k := range Maintenances {
+		if k.DropData && k.Active(At) && k.CoversItem(a, ItemID) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, Name string) *time.Location {
+	t.Helper()
+
+	location, err := time.LoadLocation(Name)
+	if err != nil {
+		t.Skip("timezone database isn't available:", err)
+	}
+
+	return location
+}
+
+//window returns the window starting at the specified local time and lasting for the duration
+func window(Location *time.Location, Year int, Month time.Month, Day, Hour, Minute int, Duration time.Duration) MaintenanceWindow {
+	start := time.Date(Year, Month, Day, Hour, Minute, 0, 0, Location)
+	return MaintenanceWindow{Start: start, End: start.Add(Duration)}
+}
+
+func sameWindows(Got, Want []MaintenanceWindow) bool {
+	if len(Got) != len(Want) {
+		return false
+	}
+	for i := range Got {
+		if !Got[i].Start.Equal(Want[i].Start) || !Got[i].End.Equal(Want[i].End) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestOccurrences(t *testing.T) {
+	vienna := mustLoadLocation(t, "Europe/Vienna")
+	recurring := func(Recurrence MaintenanceRecurrence) Maintenance {
+		return Maintenance{Name: "patchday", Start: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Recurrence: Recurrence}
+	}
+
+	cases := []struct {
+		name        string
+		maintenance Maintenance
+		from, to    time.Time
+		want        []MaintenanceWindow
+	}{
+		{
+			"once",
+			Maintenance{Start: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)},
+			time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC), time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(time.UTC, 2021, 3, 1, 10, 0, 2*time.Hour)},
+		},
+		{
+			"once outside of period",
+			Maintenance{Start: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)},
+			time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{},
+		},
+		{
+			//Vienna switches to summer time on the 28th, the windows keep their local start time
+			"daily across dst",
+			recurring(MaintenanceRecurrence{Type: Daily, StartTime: "22:00", Duration: 3600, Timezone: "Europe/Vienna"}),
+			time.Date(2021, 3, 27, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 29, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(vienna, 2021, 3, 27, 22, 0, time.Hour), window(vienna, 2021, 3, 28, 22, 0, time.Hour)},
+		},
+		{
+			"window starting before the period",
+			recurring(MaintenanceRecurrence{Type: Daily, StartTime: "23:00", Duration: 7200}),
+			time.Date(2021, 5, 2, 0, 30, 0, 0, time.UTC), time.Date(2021, 5, 2, 12, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(time.UTC, 2021, 5, 1, 23, 0, 2*time.Hour)},
+		},
+		{
+			"weekly",
+			recurring(MaintenanceRecurrence{Type: Weekly, Weekdays: []time.Weekday{time.Tuesday, time.Saturday}, StartTime: "03:30", Duration: 1800}),
+			time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 6, 8, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(time.UTC, 2021, 6, 1, 3, 30, 30*time.Minute), window(time.UTC, 2021, 6, 5, 3, 30, 30*time.Minute)},
+		},
+		{
+			//The day is interpreted in the timezone of the maintenance, not in UTC (Tuesday 01:00 in Vienna is Monday in UTC)
+			"weekly in local time",
+			recurring(MaintenanceRecurrence{Type: Weekly, Weekdays: []time.Weekday{time.Tuesday}, StartTime: "01:00", Duration: 1800, Timezone: "Europe/Vienna"}),
+			time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 6, 8, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(vienna, 2021, 6, 8, 1, 0, 30*time.Minute)},
+		},
+		{
+			"monthly skips short months",
+			recurring(MaintenanceRecurrence{Type: Monthly, DaysOfMonth: []int{31}, StartTime: "00:00", Duration: 60}),
+			time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{window(time.UTC, 2021, 3, 31, 0, 0, time.Minute)},
+		},
+		{
+			"limited by start and end",
+			Maintenance{
+				Start:      time.Date(2021, 7, 1, 1, 0, 0, 0, time.UTC),
+				End:        time.Date(2021, 7, 2, 0, 30, 0, 0, time.UTC),
+				Recurrence: MaintenanceRecurrence{Type: Daily, StartTime: "00:00", Duration: 7200},
+			},
+			time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC), time.Date(2021, 7, 5, 0, 0, 0, 0, time.UTC),
+			[]MaintenanceWindow{
+				{Start: time.Date(2021, 7, 1, 1, 0, 0, 0, time.UTC), End: time.Date(2021, 7, 1, 2, 0, 0, 0, time.UTC)},
+				{Start: time.Date(2021, 7, 2, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 7, 2, 0, 30, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	for _, k := range cases {
+		if got := k.maintenance.Occurrences(k.from, k.to); !sameWindows(got, k.want) {
+			t.Errorf("%s: got %v, want %v", k.name, got, k.want)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	maintenance := Maintenance{
+		Name:       "backup",
+		Start:      time.Date(2021, 1, 1, 0, 0, 0, 0, newYork),
+		Recurrence: MaintenanceRecurrence{Type: Daily, StartTime: "23:30", Duration: 3600, Timezone: "America/New_York"},
+	}
+
+	cases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2021, 6, 1, 23, 29, 0, 0, newYork), false},
+		{time.Date(2021, 6, 1, 23, 30, 0, 0, newYork), true},
+		{time.Date(2021, 6, 2, 0, 15, 0, 0, newYork), true},
+		{time.Date(2021, 6, 2, 0, 30, 0, 0, newYork), false},
+		{time.Date(2020, 12, 31, 23, 45, 0, 0, newYork), false},
+		{time.Date(2021, 1, 1, 0, 15, 0, 0, newYork), true},
+	}
+
+	for _, k := range cases {
+		if got := maintenance.Active(k.at); got != k.want {
+			t.Errorf("%s: active %v, want %v", k.at, got, k.want)
+		}
+	}
+
+	if active := ActiveMaintenances([]Maintenance{maintenance}, cases[1].at); !reflect.DeepEqual(active, []Maintenance{maintenance}) {
+		t.Fatal("active maintenances:", active)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//NotificationRule routes the notifications of matching trigger state changes to one or multiple channels
+//Empty filters match everything
+type NotificationRule struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Name, Description string
+	Enabled           bool
+	Severities        []TriggerSeverity
+	AgentIDs          []primitive.ObjectID
+	TemplateIDs       []primitive.ObjectID
+	//Channels contains the names of the channels the notifications are sent to
+	Channels []string
+	//NotifyRecovery defines if a notification is also sent if the problem is resolved
+	NotifyRecovery bool
+	//ProblemTemplate and RecoveryTemplate override the default templates of the channels if they are set
+	ProblemTemplate, RecoveryTemplate MessageTemplate
+}
+
+//MessageTemplate defines how the subject and body of a notification are rendered
+//Both use the text/template syntax, the available fields are documented in the templating package
+type MessageTemplate struct {
+	Subject, Body string
+}
+
+//IsEmpty returns true if neither subject nor body are set
+func (m MessageTemplate) IsEmpty() bool {
+	return stringHelper.IsEmpty(m.Subject) && stringHelper.IsEmpty(m.Body)
+}
+
+//Validate checks if the notification rule can be stored in the database
+func (r NotificationRule) Validate() error {
+	if stringHelper.IsEmpty(r.Name) {
+		return errors.New("notification rule name can't be empty")
+	}
+	if len(r.Channels) == 0 {
+		return errors.New("notification rule needs at least one channel")
+	}
+	for _, k := range r.Channels {
+		if stringHelper.IsEmpty(k) {
+			return errors.New("notification rule channel can't be empty")
+		}
+	}
+	for _, k := range r.Severities {
+		if !k.Valid() {
+			return errors.New("notification rule has an unknown severity")
+		}
+	}
+
+	return nil
+}
+
+//Matches returns true if the state change of the trigger on the agent should be routed via the rule
+//The agent has to be populated if the rule is scoped to templates
+func (r NotificationRule) Matches(Agent Agent, TriggerID primitive.ObjectID, Severity TriggerSeverity, Problematic bool) bool {
+	if !r.Enabled {
+		return false
+	}
+	if !Problematic && !r.NotifyRecovery {
+		return false
+	}
+
+	if len(r.Severities) > 0 {
+		found := false
+		for _, k := range r.Severities {
+			if k == Severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.AgentIDs) > 0 {
+		found := false
+		for _, k := range r.AgentIDs {
+			if k == Agent.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.TemplateIDs) > 0 {
+		found := false
+		for _, template := range Agent.Templates {
+			for _, k := range r.TemplateIDs {
+				if k == template.ID && template.HasTrigger(TriggerID) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+//DeliveryStatus defines the state of a single notification delivery
+type DeliveryStatus int
+
+const (
+	//DeliveryPending is set while the notification is being sent
+	DeliveryPending DeliveryStatus = iota
+	//DeliverySent is set if the channel accepted the notification
+	DeliverySent
+	//DeliveryFailed is set if all attempts to send the notification failed
+	DeliveryFailed
+)
+
+//Delivery logs a single notification sent to a channel
+type Delivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	EventID   primitive.ObjectID
+	AgentID   primitive.ObjectID
+	TriggerID primitive.ObjectID
+	RuleID    primitive.ObjectID
+	//PolicyID, Step and Repetition are set for notifications sent by escalation policies
+	PolicyID   primitive.ObjectID
+	Step       int
+	Repetition int
+	Channel    string
+	Status     DeliveryStatus
+	Attempts   int
+	LastError  string
+	Subject    string
+	Created    time.Time
+	Updated    time.Time
+}
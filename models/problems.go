@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Problem describes a problematic trigger assignment of an agent together with the reasons it may be suppressed
+type Problem struct {
+	Assignment TriggerAssignment
+	//InMaintenance is true if the trigger is covered by an active maintenance
+	InMaintenance bool
+	//SilencedBy contains the IDs of all active silences matching the problem
+	SilencedBy []primitive.ObjectID
+}
+
+//Silenced returns true if the notifications of the problem are muted by at least one silence
+func (p Problem) Silenced() bool {
+	return len(p.SilencedBy) > 0
+}
+
+//Suppressed returns true if the problem shouldn't be alerted
+func (p Problem) Suppressed() bool {
+	return p.InMaintenance || p.Silenced()
+}
+
+//ProblemOptions defines the context used to decide whether problems are suppressed
+type ProblemOptions struct {
+	//At is the point in time used to check maintenances, the current time is used if it isn't set
+	At           time.Time
+	Maintenances []Maintenance
+	Silences     []Silence
+}
+
+//Problems returns all problematic trigger assignments of the agent and whether they are suppressed
+//The agent has to be populated, otherwise silences can't be matched and maintenances scoped to templates are ignored
+func (a Agent) Problems(Options ProblemOptions) []Problem {
+	at := Options.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	problems := make([]Problem, 0)
+	for _, k := range a.ProblematicTriggers() {
+		problem := Problem{
+			Assignment:    k,
+			InMaintenance: a.TriggerInMaintenance(Options.Maintenances, k.TriggerID, at),
+			SilencedBy:    make([]primitive.ObjectID, 0),
+		}
+
+		if trigger, err := a.GetTrigger(k.TriggerID); err == nil {
+			problem.SilencedBy = SilencedBy(Options.Silences, a, trigger, k.EffectiveSeverity(trigger), at)
+		}
+
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+//ActiveProblems returns all problematic trigger assignments of the agent, which aren't suppressed
+func (a Agent) ActiveProblems(Options ProblemOptions) []TriggerAssignment {
+	active := make([]TriggerAssignment, 0)
+	for _, k := range a.Problems(Options) {
+		if !k.Suppressed() {
+			active = append(active, k.Assignment)
+		}
+	}
+
+	return active
+}
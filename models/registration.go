@@ -0,0 +1,34 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+)
+
+//Registration contains the data an agent sends to enroll itself
+type Registration struct {
+	UUID     uuid.UUID
+	Hostname string
+	OS       string
+	Endpoint string
+	Metadata map[string]string
+	//Token is the pre-shared enrollment token
+	Token string
+}
+
+//Validate checks if the registration contains all required fields
+func (r Registration) Validate() error {
+	if r.UUID == uuid.Nil {
+		return errors.New("registration uuid can't be empty")
+	}
+	if stringHelper.IsEmpty(r.Hostname) {
+		return errors.New("registration hostname can't be empty")
+	}
+	if stringHelper.IsEmpty(r.Endpoint) {
+		return errors.New("registration endpoint can't be empty")
+	}
+
+	return nil
+}
@@ -19,6 +19,23 @@ type Result struct {
 	ValueString  string
 	ValueNumeric float64
 	Error        string
+	//FencingToken is the token of the scraper lease the result was stored with, it is zero for results stored without a lease
+	FencingToken int64
+}
+
+//Validate checks if the result can be stored in the database
+func (r Result) Validate() error {
+	if r.ItemID.IsZero() {
+		return errors.New("result has to reference an item")
+	}
+	if r.HostID.IsZero() {
+		return errors.New("result has to reference an agent")
+	}
+	if !r.Type.Valid() {
+		return errors.New("result has an unknown return type")
+	}
+
+	return nil
 }
 
 //ResultSet stores a collection of results
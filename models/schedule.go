@@ -0,0 +1,239 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Schedule defines when an item is executed
+//Items either run every Interval seconds or whenever the cron expression matches, overrides replace both during their windows
+type Schedule struct {
+	//Interval is set in seconds and used if Cron is empty
+	Interval int
+	Cron     string
+	//Timezone is the IANA timezone name used by Cron and the override windows, UTC is used if empty
+	Timezone  string
+	Overrides []IntervalOverride
+}
+
+//IntervalOverride changes the interval of a schedule during a daily window (e.g. every 30s during business hours)
+type IntervalOverride struct {
+	Weekdays []time.Weekday //The window only starts on these days, every day if empty
+	//StartTime and EndTime define the local window in the format HH:MM, windows ending before they start span midnight
+	StartTime, EndTime string
+	Interval           int //In seconds
+}
+
+//ItemSchedule replaces the schedule of an item on a single agent
+type ItemSchedule struct {
+	ItemID   primitive.ObjectID
+	Schedule Schedule
+}
+
+//scheduleSearchLimit limits the number of override windows Next steps through
+const scheduleSearchLimit = 1000
+
+//Schedule returns the schedule of the item
+func (i Item) Schedule() Schedule {
+	return Schedule{
+		Interval:  i.Interval,
+		Cron:      i.Cron,
+		Timezone:  i.Timezone,
+		Overrides: i.IntervalOverrides,
+	}
+}
+
+//Schedule returns the schedule of the item on the agent, which is either the schedule of the item or the override of the agent
+func (a Agent) Schedule(Item Item) Schedule {
+	for _, k := range a.ItemSchedules {
+		if k.ItemID == Item.ID {
+			return k.Schedule
+		}
+	}
+
+	return Item.Schedule()
+}
+
+//Validate checks if the schedule can be used to execute an item
+func (s Schedule) Validate() error {
+	if s.Cron == "" && s.Interval <= 0 {
+		return errors.New("schedule interval has to be greater than zero")
+	}
+	if s.Cron != "" {
+		if _, err := ParseCron(s.Cron); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return errors.New("schedule has an unknown timezone")
+	}
+
+	for _, k := range s.Overrides {
+		if k.Interval <= 0 {
+			return errors.New("override interval has to be greater than zero")
+		}
+		start, startErr := time.Parse("15:04", k.StartTime)
+		end, endErr := time.Parse("15:04", k.EndTime)
+		if startErr != nil || endErr != nil {
+			return errors.New("override start and end time have to be in the format HH:MM")
+		}
+		if start.Equal(end) {
+			return errors.New("override has to end after it starts")
+		}
+		for _, weekday := range k.Weekdays {
+			if weekday < time.Sunday || weekday > time.Saturday {
+				return errors.New("override has an unknown weekday")
+			}
+		}
+	}
+
+	return nil
+}
+
+//IntervalAt returns the interval used at the specified time
+//Zero is returned if the cron expression is used at this time
+func (s Schedule) IntervalAt(At time.Time) time.Duration {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	return s.intervalAt(At, location)
+}
+
+func (s Schedule) intervalAt(At time.Time, Location *time.Location) time.Duration {
+	for _, k := range s.Overrides {
+		if k.activeAt(At.In(Location)) {
+			return time.Duration(k.Interval) * time.Second
+		}
+	}
+
+	if s.Cron != "" {
+		return 0
+	}
+
+	return time.Duration(s.Interval) * time.Second
+}
+
+//Next returns the first execution after the specified time
+//Interval executions run on a grid anchored at the unix epoch, which is shifted by Phase (a fraction of the interval between 0 and 1)
+//A zero time is returned if the schedule is invalid or the cron expression never matches
+func (s Schedule) Next(After time.Time, Phase float64) time.Time {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}
+	}
+	var cron CronExpression
+	if s.Cron != "" {
+		if cron, err = ParseCron(s.Cron); err != nil {
+			return time.Time{}
+		}
+	}
+
+	after := After
+	for i := 0; i < scheduleSearchLimit; i++ {
+		var next time.Time
+		if interval := s.intervalAt(after.Add(time.Nanosecond), location); interval > 0 {
+			next = nextOnGrid(after, interval, Phase)
+		} else if s.Cron != "" {
+			next = cron.Next(after.In(location))
+		}
+		if next.IsZero() {
+			return next
+		}
+
+		//If an override window starts or ends before the execution, the execution is calculated again from the change
+		change := s.nextChange(after.Add(time.Nanosecond), location)
+		if change.IsZero() || next.Before(change) {
+			return next
+		}
+		after = change.Add(-time.Nanosecond)
+	}
+
+	return time.Time{}
+}
+
+//nextChange returns the first start or end of an override window after the specified time, it is zero if there are no overrides
+func (s Schedule) nextChange(After time.Time, Location *time.Location) time.Time {
+	var change time.Time
+
+	local := After.In(Location)
+	//Windows start at most once a day and repeat weekly, so the next change is within the next eight days
+	for day := -1; day <= 8; day++ {
+		date := time.Date(local.Year(), local.Month(), local.Day()+day, 0, 0, 0, 0, Location)
+		for _, k := range s.Overrides {
+			start, end, ok := k.window(date)
+			if !ok {
+				continue
+			}
+			for _, t := range []time.Time{start, end} {
+				if t.After(After) && (change.IsZero() || t.Before(change)) {
+					change = t
+				}
+			}
+		}
+	}
+
+	return change
+}
+
+//activeAt returns true if the specified time is within a window of the override
+func (o IntervalOverride) activeAt(At time.Time) bool {
+	//Windows spanning midnight started on the day before
+	for _, day := range []int{0, -1} {
+		start, end, ok := o.window(time.Date(At.Year(), At.Month(), At.Day()+day, 0, 0, 0, 0, At.Location()))
+		if ok && !At.Before(start) && At.Before(end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//window returns the window of the override starting on the specified day, the returned bool is false if there is no window on this day
+func (o IntervalOverride) window(Day time.Time) (time.Time, time.Time, bool) {
+	if len(o.Weekdays) > 0 && !containsWeekday(o.Weekdays, Day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	startTime, startErr := time.Parse("15:04", o.StartTime)
+	endTime, endErr := time.Parse("15:04", o.EndTime)
+	if startErr != nil || endErr != nil || startTime.Equal(endTime) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start := time.Date(Day.Year(), Day.Month(), Day.Day(), startTime.Hour(), startTime.Minute(), 0, 0, Day.Location())
+	end := time.Date(Day.Year(), Day.Month(), Day.Day(), endTime.Hour(), endTime.Minute(), 0, 0, Day.Location())
+	if endTime.Before(startTime) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start, end, true
+}
+
+//nextOnGrid returns the first time after the specified time on the grid of the interval
+func nextOnGrid(After time.Time, Interval time.Duration, Phase float64) time.Time {
+	if Phase < 0 || Phase >= 1 {
+		Phase = 0
+	}
+
+	base := time.Unix(0, 0).Add(time.Duration(Phase * float64(Interval)))
+	slot := base.Add(After.Sub(base) / Interval * Interval)
+	for !slot.After(After) {
+		slot = slot.Add(Interval)
+	}
+
+	return slot
+}
+
+func containsWeekday(Slice []time.Weekday, Weekday time.Weekday) bool {
+	for _, k := range Slice {
+		if k == Weekday {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+//clock returns the time of the specified day in 2021-06 (the 7th is a monday) in UTC
+func clock(Day, Hour, Minute int) time.Time {
+	return time.Date(2021, 6, Day, Hour, Minute, 0, 0, time.UTC)
+}
+
+func TestScheduleValidate(t *testing.T) {
+	businessHours := IntervalOverride{Weekdays: []time.Weekday{time.Monday}, StartTime: "09:00", EndTime: "17:00", Interval: 30}
+
+	cases := []struct {
+		name     string
+		schedule Schedule
+		valid    bool
+	}{
+		{"interval", Schedule{Interval: 60}, true},
+		{"cron", Schedule{Cron: "*/5 * * * *", Timezone: "Europe/Vienna"}, true},
+		{"override", Schedule{Interval: 300, Overrides: []IntervalOverride{businessHours}}, true},
+		{"override spanning midnight", Schedule{Interval: 300, Overrides: []IntervalOverride{{StartTime: "22:00", EndTime: "02:00", Interval: 60}}}, true},
+		{"no interval", Schedule{}, false},
+		{"invalid cron", Schedule{Cron: "* * *"}, false},
+		{"unknown timezone", Schedule{Interval: 60, Timezone: "Mars/Olympus"}, false},
+		{"override without interval", Schedule{Interval: 60, Overrides: []IntervalOverride{{StartTime: "09:00", EndTime: "17:00"}}}, false},
+		{"override with invalid time", Schedule{Interval: 60, Overrides: []IntervalOverride{{StartTime: "9", EndTime: "17:00", Interval: 30}}}, false},
+		{"empty override window", Schedule{Interval: 60, Overrides: []IntervalOverride{{StartTime: "09:00", EndTime: "09:00", Interval: 30}}}, false},
+		{"override with unknown weekday", Schedule{Interval: 60, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{7}, StartTime: "09:00", EndTime: "17:00", Interval: 30}}}, false},
+	}
+
+	for _, k := range cases {
+		if err := k.schedule.Validate(); (err == nil) != k.valid {
+			t.Errorf("%s: got %v, want valid %v", k.name, err, k.valid)
+		}
+	}
+}
+
+func TestScheduleIntervalAt(t *testing.T) {
+	schedule := Schedule{
+		Interval: 300,
+		Overrides: []IntervalOverride{
+			{Weekdays: []time.Weekday{time.Monday, time.Tuesday}, StartTime: "09:00", EndTime: "17:00", Interval: 30},
+			//Only starts on fridays, but lasts until saturday morning
+			{Weekdays: []time.Weekday{time.Friday}, StartTime: "22:00", EndTime: "02:00", Interval: 60},
+		},
+	}
+
+	cases := []struct {
+		name string
+		at   time.Time
+		want time.Duration
+	}{
+		{"before window", clock(7, 8, 59), 5 * time.Minute},
+		{"window start is inclusive", clock(7, 9, 0), 30 * time.Second},
+		{"window end is exclusive", clock(7, 17, 0), 5 * time.Minute},
+		{"other weekday", clock(9, 12, 0), 5 * time.Minute},
+		{"spanning midnight before", clock(11, 23, 0), time.Minute},
+		{"spanning midnight after", clock(12, 1, 59), time.Minute},
+		{"spanning midnight ended", clock(12, 2, 0), 5 * time.Minute},
+		{"spanning midnight wrong weekday", clock(12, 23, 0), 5 * time.Minute},
+	}
+
+	for _, k := range cases {
+		if got := schedule.IntervalAt(k.at); got != k.want {
+			t.Errorf("%s: interval at %s is %s, want %s", k.name, k.at, got, k.want)
+		}
+	}
+
+	//Cron schedules don't have an interval outside of the override windows
+	schedule.Cron = "0 * * * *"
+	if got := schedule.IntervalAt(clock(7, 8, 0)); got != 0 {
+		t.Fatal("cron schedule has interval", got)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	cases := []struct {
+		name     string
+		schedule Schedule
+		phase    float64
+		after    time.Time
+		//want contains the following executions
+		want []time.Time
+	}{
+		{
+			"interval",
+			Schedule{Interval: 60},
+			0, clock(7, 10, 0).Add(10 * time.Second),
+			[]time.Time{clock(7, 10, 1), clock(7, 10, 2)},
+		},
+		{
+			"phase",
+			Schedule{Interval: 60},
+			0.5, clock(7, 10, 0).Add(10 * time.Second),
+			[]time.Time{clock(7, 10, 0).Add(30 * time.Second), clock(7, 10, 1).Add(30 * time.Second)},
+		},
+		{
+			"invalid phase is ignored",
+			Schedule{Interval: 3600},
+			1.5, clock(7, 10, 30),
+			[]time.Time{clock(7, 11, 0)},
+		},
+		{
+			"cron",
+			Schedule{Cron: "0 9 * * 1-5"},
+			0.5, clock(5, 12, 0),
+			[]time.Time{clock(7, 9, 0), clock(8, 9, 0)},
+		},
+		{
+			"cron in timezone",
+			Schedule{Cron: "0 9 * * *", Timezone: "America/New_York"},
+			0, clock(7, 12, 0),
+			[]time.Time{clock(7, 13, 0), clock(8, 13, 0)},
+		},
+		{
+			//The override grid is used from the start of the window and the hourly grid continues after its end, the execution at 10:50 is skipped
+			"override starting and ending mid-interval",
+			Schedule{Interval: 3600, Overrides: []IntervalOverride{{StartTime: "10:15", EndTime: "10:45", Interval: 600}}},
+			0, clock(7, 9, 59),
+			[]time.Time{clock(7, 10, 0), clock(7, 10, 20), clock(7, 10, 30), clock(7, 10, 40), clock(7, 11, 0)},
+		},
+		{
+			"override of cron schedule",
+			Schedule{Cron: "0 * * * *", Overrides: []IntervalOverride{{StartTime: "10:15", EndTime: "10:45", Interval: 600}}},
+			0, clock(7, 9, 59),
+			[]time.Time{clock(7, 10, 0), clock(7, 10, 20), clock(7, 10, 30), clock(7, 10, 40), clock(7, 11, 0)},
+		},
+		{
+			"override spanning midnight",
+			Schedule{Interval: 7200, Overrides: []IntervalOverride{{StartTime: "23:30", EndTime: "00:30", Interval: 1200}}},
+			0, clock(7, 22, 0),
+			[]time.Time{clock(7, 23, 40), clock(8, 0, 0), clock(8, 0, 20), clock(8, 2, 0)},
+		},
+		{
+			"override on other weekday",
+			Schedule{Interval: 3600, Overrides: []IntervalOverride{{Weekdays: []time.Weekday{time.Tuesday}, StartTime: "10:15", EndTime: "10:45", Interval: 600}}},
+			0, clock(7, 9, 59),
+			[]time.Time{clock(7, 10, 0), clock(7, 11, 0)},
+		},
+		{
+			//Clocks in New York skip from 02:00 to 03:00 on 2021-03-14, the override window uses local time
+			"override across dst",
+			Schedule{Interval: 86400, Timezone: "America/New_York", Overrides: []IntervalOverride{{StartTime: "09:00", EndTime: "09:30", Interval: 900}}},
+			0, time.Date(2021, 3, 14, 1, 0, 0, 0, time.UTC),
+			[]time.Time{time.Date(2021, 3, 14, 9, 0, 0, 0, newYork), time.Date(2021, 3, 14, 9, 15, 0, 0, newYork), time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"unknown timezone",
+			Schedule{Interval: 60, Timezone: "Mars/Olympus"},
+			0, clock(7, 10, 0),
+			[]time.Time{{}},
+		},
+		{
+			"cron never matches",
+			Schedule{Cron: "0 0 30 2 *"},
+			0, clock(7, 10, 0),
+			[]time.Time{{}},
+		},
+	}
+
+	for _, k := range cases {
+		after := k.after
+		for i, want := range k.want {
+			got := k.schedule.Next(after, k.phase)
+			if !got.Equal(want) {
+				t.Errorf("%s: execution %d is at %s, want %s", k.name, i, got, want)
+				break
+			}
+			after = got
+		}
+	}
+}
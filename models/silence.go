@@ -0,0 +1,202 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Silence mutes the notifications of all problems matching every matcher between Start and End
+//Unlike maintenances, silences neither disable triggers nor data collection
+type Silence struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Matchers   []Matcher
+	Start, End time.Time
+	CreatedBy  string
+	Created    time.Time
+	Comment    string
+}
+
+//MatcherField defines which attribute of a problem is compared by a matcher
+type MatcherField string
+
+const (
+	//MatchAgent compares the name of the agent
+	MatchAgent MatcherField = "agent"
+	//MatchTemplate compares the names of the agent templates containing the trigger
+	MatchTemplate MatcherField = "template"
+	//MatchTrigger compares the name of the trigger
+	MatchTrigger MatcherField = "trigger"
+	//MatchSeverity compares the severity of the problem (e.g. HIGH)
+	MatchSeverity MatcherField = "severity"
+	//MatchTag compares the tags of the agent
+	MatchTag MatcherField = "tag"
+)
+
+//Matcher compares a single attribute of a problem with the value
+//Regex matchers have to match the whole attribute
+type Matcher struct {
+	Field MatcherField
+	Value string
+	Regex bool
+}
+
+//Validate checks if the silence can be stored in the database
+func (s Silence) Validate() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("silence needs at least one matcher")
+	}
+	if stringHelper.IsEmpty(s.CreatedBy) {
+		return errors.New("silence creator can't be empty")
+	}
+	if !s.End.After(s.Start) {
+		return errors.New("silence has to end after it starts")
+	}
+
+	for _, k := range s.Matchers {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Active returns true if the silence is active at the specified time
+func (s Silence) Active(At time.Time) bool {
+	return !At.Before(s.Start) && At.Before(s.End)
+}
+
+//Matches returns true if all matchers match the problem of the trigger on the agent
+//The agent has to be populated if templates are matched
+func (s Silence) Matches(Agent Agent, Trigger Trigger, Severity TriggerSeverity) bool {
+	for _, k := range s.Matchers {
+		if !k.Matches(Agent, Trigger, Severity) {
+			return false
+		}
+	}
+
+	return len(s.Matchers) > 0
+}
+
+//Validate checks if the matcher has a known field and a valid regex
+func (m Matcher) Validate() error {
+	switch m.Field {
+	case MatchAgent, MatchTemplate, MatchTrigger, MatchSeverity, MatchTag:
+	default:
+		return errors.New("matcher has an unknown field")
+	}
+
+	if m.Regex {
+		if _, err := compileMatcher(m.Value); err != nil {
+			return errors.New("matcher has an invalid regex: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+//Matches returns true if the attribute of the problem matches the value
+//Fields with multiple values (templates, tags) match if any of the values matches
+func (m Matcher) Matches(Agent Agent, Trigger Trigger, Severity TriggerSeverity) bool {
+	values := make([]string, 0)
+	switch m.Field {
+	case MatchAgent:
+		values = append(values, Agent.Name)
+	case MatchTemplate:
+		for _, k := range Agent.Templates {
+			if k.HasTrigger(Trigger.ID) {
+				values = append(values, k.Name)
+			}
+		}
+	case MatchTrigger:
+		values = append(values, Trigger.Name)
+	case MatchSeverity:
+		values = append(values, Severity.String())
+	case MatchTag:
+		values = append(values, Agent.Tags...)
+	}
+
+	var expression *regexp.Regexp
+	if m.Regex {
+		var err error
+		if expression, err = compileMatcher(m.Value); err != nil {
+			return false
+		}
+	}
+
+	for _, k := range values {
+		if (expression != nil && expression.MatchString(k)) || (expression == nil && k == m.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//matcherCacheSize limits the number of compiled matcher regexes kept in memory
+const matcherCacheSize = 1024
+
+//matcherCache stores the compiled regexes of matchers indexed by their value
+//Matchers are evaluated for every silence and problem (and hostname regexes for every registration), so their regexes are only compiled once
+var matcherCache = struct {
+	sync.RWMutex
+	expressions map[string]*regexp.Regexp
+}{expressions: make(map[string]*regexp.Regexp)}
+
+//compileMatcher returns the compiled regex of the matcher value, which has to match the whole attribute
+func compileMatcher(Value string) (*regexp.Regexp, error) {
+	matcherCache.RLock()
+	expression, found := matcherCache.expressions[Value]
+	matcherCache.RUnlock()
+	if found {
+		return expression, nil
+	}
+
+	//The value is compiled on its own first, so values like "a)|(b" can't break out of the anchors
+	if _, err := regexp.Compile(Value); err != nil {
+		return nil, err
+	}
+	expression, err := regexp.Compile("^(?:" + Value + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	matcherCache.Lock()
+	defer matcherCache.Unlock()
+	//The cache is only cleared if silences with lots of different regexes were evaluated
+	if len(matcherCache.expressions) >= matcherCacheSize {
+		matcherCache.expressions = make(map[string]*regexp.Regexp)
+	}
+	matcherCache.expressions[Value] = expression
+
+	return expression, nil
+}
+
+//ActiveSilences returns all silences which are active at the specified time
+func ActiveSilences(Silences []Silence, At time.Time) []Silence {
+	active := make([]Silence, 0)
+	for _, k := range Silences {
+		if k.Active(At) {
+			active = append(active, k)
+		}
+	}
+
+	return active
+}
+
+//SilencedBy returns the IDs of all active silences matching the problem of the trigger on the agent
+func SilencedBy(Silences []Silence, Agent Agent, Trigger Trigger, Severity TriggerSeverity, At time.Time) []primitive.ObjectID {
+	silencedBy := make([]primitive.ObjectID, 0)
+	for _, k := range Silences {
+		if k.Active(At) && k.Matches(Agent, Trigger, Severity) {
+			silencedBy = append(silencedBy, k.ID)
+		}
+	}
+
+	return silencedBy
+}
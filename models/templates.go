@@ -1,6 +1,11 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"errors"
+
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 //Template specifies the layout of a generic template stored in the database
 type Template struct {
@@ -10,4 +15,29 @@ type Template struct {
 	Items             []Item `bson:"-"`
 	TriggerIDs        []primitive.ObjectID
 	Triggers          []Trigger `bson:"-"`
+	//Macros are user macros used in item commands of agents linked to the template
+	Macros map[string]string
+}
+
+//Validate checks if the template can be stored in the database
+func (t Template) Validate() error {
+	if stringHelper.IsEmpty(t.Name) {
+		return errors.New("template name can't be empty")
+	}
+	if err := validateMacros(t.Macros); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//HasTrigger returns true if the trigger is part of the template
+func (t Template) HasTrigger(TriggerID primitive.ObjectID) bool {
+	for _, k := range t.TriggerIDs {
+		if k == TriggerID {
+			return true
+		}
+	}
+
+	return false
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
@@ -31,22 +32,86 @@ const (
 	HIGH
 )
 
+//Valid returns true if the TriggerSeverity is one of the known severities
+func (s TriggerSeverity) Valid() bool {
+	return s >= INFO && s <= HIGH
+}
+
+//String returns the name of the TriggerSeverity
+func (s TriggerSeverity) String() string {
+	switch s {
+	case INFO:
+		return "INFO"
+	case LOW:
+		return "LOW"
+	case MEDIUM:
+		return "MEDIUM"
+	case HIGH:
+		return "HIGH"
+	}
+
+	return "UNKNOWN"
+}
+
+//Validate checks if the trigger can be stored in the database
+func (t Trigger) Validate() error {
+	if stringHelper.IsEmpty(t.Name) {
+		return errors.New("trigger name can't be empty")
+	}
+	if stringHelper.IsEmpty(t.Expression) {
+		return errors.New("trigger expression can't be empty")
+	}
+	if !t.Severity.Valid() {
+		return errors.New("trigger has an unknown severity")
+	}
+	for _, k := range t.DependsOn {
+		if !t.ID.IsZero() && k == t.ID {
+			return errors.New("trigger can't depend on itself")
+		}
+	}
+
+	return nil
+}
+
 //TriggerAssignment is used to map a trigger (specified via the TriggerID) to an agent
-//TriggerAssignments are automatically created by the dbtemplate package upon retrieving an agent
+//TriggerAssignments are created and cleaned up by dbtemplate.ReconcileTriggerAssignments
 type TriggerAssignment struct {
 	Enabled     bool
 	TriggerID   primitive.ObjectID
 	Problematic bool
 	Error       string
-	History     []TriggerHistoryEntry
+	//ProblemSince is set when the assignment becomes problematic
+	ProblemSince time.Time
+	//Acknowledged is true if an operator took care of the current problem
+	Acknowledged bool
+	//ManuallyClosed is true if an operator closed the current problem, the assignment stays unproblematic until the expression recovers
+	ManuallyClosed bool
+	//SeverityOverride is set if an operator changed the severity of the current problem
+	SeverityOverride *TriggerSeverity
+	//Acknowledgements stores all operator actions on the current (or last) problem
+	//They are reset as soon as a new problem starts
+	Acknowledgements []Acknowledgement
+	//Deprecated: State changes are stored as TriggerEvent in a separate collection
+	//History is only read by dbtemplate.MigrateTriggerHistory to move existing entries
+	History []TriggerHistoryEntry
 }
 
 //TriggerHistoryEntry is used to store when a trigger became problematic / unproblematic for a given TriggerAssignment / TriggerMapping
+//Deprecated: Use TriggerEvent instead
 type TriggerHistoryEntry struct {
 	Time        time.Time
 	Problematic bool
 }
 
+//EffectiveSeverity returns the severity of the current problem, which may have been changed by an operator
+func (t TriggerAssignment) EffectiveSeverity(Trigger Trigger) TriggerSeverity {
+	if t.SeverityOverride != nil {
+		return *t.SeverityOverride
+	}
+
+	return Trigger.Severity
+}
+
 //HasError returns true if the Error string is set to something other than ""
 func (t TriggerAssignment) HasError() bool {
 	return !stringHelper.IsEmpty(t.Error)
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//UnreachableTriggerID is the ID of the synthetic trigger which is problematic while an agent is offline
+//It isn't stored in the database, but triggers can depend on it (DependsOn) to be suppressed while their agent is unreachable
+//State changes of the agent are stored as trigger events with this trigger ID
+var UnreachableTriggerID = primitive.ObjectID{'u', 'n', 'r', 'e', 'a', 'c', 'h', 'a', 'b', 'l', 'e', '!'}
+
+//UnreachableSeverity is the severity of the synthetic unreachable trigger
+var UnreachableSeverity = HIGH
+
+//UnreachableTrigger returns the synthetic trigger which is problematic while an agent is offline
+//It can be passed to the notification dispatcher like any other trigger
+func UnreachableTrigger() Trigger {
+	return Trigger{
+		ID:          UnreachableTriggerID,
+		Name:        "Agent unreachable",
+		Description: "The agent didn't report within the timeout of the online detection",
+		Enabled:     true,
+		Severity:    UnreachableSeverity,
+		DependsOn:   make([]primitive.ObjectID, 0),
+	}
+}
+
+//Unreachable returns true if the agent is regarded offline by the online detection
+func (a Agent) Unreachable() bool {
+	return a.State == Offline
+}
+
+//UnreachableProblem returns the synthetic unreachable problem of the agent
+//The returned bool is false if the agent is online
+func (a Agent) UnreachableProblem(Options ProblemOptions) (Problem, bool) {
+	if !a.Unreachable() {
+		return Problem{}, false
+	}
+
+	at := Options.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	return Problem{
+		Assignment: TriggerAssignment{
+			Enabled:      true,
+			TriggerID:    UnreachableTriggerID,
+			Problematic:  true,
+			ProblemSince: a.StateChanged,
+		},
+		InMaintenance: a.InMaintenance(Options.Maintenances, at),
+		SilencedBy:    SilencedBy(Options.Silences, a, UnreachableTrigger(), UnreachableSeverity, at),
+	}, true
+}
+
+//NewStateEvent returns the trigger event recording a state change of the agent
+func NewStateEvent(AgentID primitive.ObjectID, State AgentState, At time.Time, Error string) TriggerEvent {
+	return TriggerEvent{
+		AgentID:     AgentID,
+		TriggerID:   UnreachableTriggerID,
+		Time:        At,
+		Problematic: State == Offline,
+		Severity:    UnreachableSeverity,
+		Error:       Error,
+	}
+}
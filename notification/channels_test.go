@@ -0,0 +1,351 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//httpStandIn records the requests of the webhook based channels
+//The first Failures requests are answered with status 500
+type httpStandIn struct {
+	*httptest.Server
+	Failures int
+
+	mutex    sync.Mutex
+	requests []recordedRequest
+}
+
+type recordedRequest struct {
+	Header http.Header
+	Body   map[string]interface{}
+	At     time.Time
+}
+
+func newHTTPStandIn(t *testing.T, Failures int) *httpStandIn {
+	standIn := &httpStandIn{Failures: Failures}
+	standIn.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error("couldn't decode request body:", err)
+		}
+
+		standIn.mutex.Lock()
+		standIn.requests = append(standIn.requests, recordedRequest{Header: r.Header, Body: body, At: time.Now()})
+		failed := len(standIn.requests) <= standIn.Failures
+		standIn.mutex.Unlock()
+
+		if failed {
+			http.Error(w, "temporarily unavailable", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(standIn.Close)
+
+	return standIn
+}
+
+func (h *httpStandIn) Requests() []recordedRequest {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append(make([]recordedRequest, 0, len(h.requests)), h.requests...)
+}
+
+//smtpStandIn is a minimal SMTP server accepting every mail
+//The first Rejections connections are refused with status 421
+type smtpStandIn struct {
+	listener   net.Listener
+	Rejections int
+
+	mutex       sync.Mutex
+	connections int
+	mails       []smtpMail
+}
+
+type smtpMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newSMTPStandIn(t *testing.T, Rejections int) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("couldn't listen:", err)
+	}
+
+	standIn := &smtpStandIn{listener: listener, Rejections: Rejections}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go standIn.handle(conn)
+		}
+	}()
+
+	return standIn
+}
+
+//Channel returns an email channel sending to the stand-in
+func (s *smtpStandIn) Channel() EmailChannel {
+	address := s.listener.Addr().(*net.TCPAddr)
+	return EmailChannel{Host: address.IP.String(), Port: address.Port, From: "flowkeeper@example.com", To: []string{"ops@example.com", "dev@example.com"}}
+}
+
+func (s *smtpStandIn) Mails() []smtpMail {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append(make([]smtpMail, 0, len(s.mails)), s.mails...)
+}
+
+func (s *smtpStandIn) handle(Conn net.Conn) {
+	defer Conn.Close()
+	Conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	s.mutex.Lock()
+	s.connections++
+	rejected := s.connections <= s.Rejections
+	s.mutex.Unlock()
+
+	if rejected {
+		Conn.Write([]byte("421 service not available\r\n"))
+		return
+	}
+
+	reader := bufio.NewReader(Conn)
+	reply := func(Line string) { Conn.Write([]byte(Line + "\r\n")) }
+	reply("220 localhost ESMTP")
+
+	var mail smtpMail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			mail.From = between(line, "<", ">")
+			reply("250 OK")
+		case "RCPT":
+			mail.To = append(mail.To, between(line, "<", ">"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			mail.Data = data.String()
+
+			s.mutex.Lock()
+			s.mails = append(s.mails, mail)
+			s.mutex.Unlock()
+			mail = smtpMail{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func between(Text, Start, End string) string {
+	from := strings.Index(Text, Start)
+	to := strings.LastIndex(Text, End)
+	if from < 0 || to <= from {
+		return ""
+	}
+
+	return Text[from+len(Start) : to]
+}
+
+func testMessage(Problematic bool) Message {
+	agent := models.Agent{ID: primitive.NewObjectID(), Name: "web1", Endpoint: "10.0.0.1"}
+	trigger := models.Trigger{ID: primitive.NewObjectID(), Name: "high load", Severity: models.LOW}
+
+	return Message{
+		Notification: Notification{
+			Agent:   agent,
+			Trigger: trigger,
+			Event: models.TriggerEvent{
+				ID:          primitive.NewObjectID(),
+				AgentID:     agent.ID,
+				TriggerID:   trigger.ID,
+				Time:        time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				Problematic: Problematic,
+				Severity:    models.LOW,
+				Error:       "load is 12",
+			},
+		},
+		Subject:  "[PROBLEM] high load on web1",
+		Body:     "Load: 12",
+		Severity: models.HIGH,
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	channel := WebhookChannel{URL: standIn.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+
+	message := testMessage(true)
+	if err := channel.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := standIn.Requests()
+	if len(requests) != 1 {
+		t.Fatal("got", len(requests), "requests")
+	}
+	if requests[0].Header.Get("Authorization") != "Bearer secret" || requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatal("headers weren't sent:", requests[0].Header)
+	}
+
+	body := requests[0].Body
+	if body["subject"] != message.Subject || body["body"] != message.Body || body["problematic"] != true || body["error"] != "load is 12" {
+		t.Fatal("unexpected payload:", body)
+	}
+	trigger := body["trigger"].(map[string]interface{})
+	if trigger["severity"] != "HIGH" || trigger["name"] != "high load" || trigger["id"] != message.Trigger.ID.Hex() {
+		t.Fatal("unexpected trigger payload:", trigger)
+	}
+	if agent := body["agent"].(map[string]interface{}); agent["name"] != "web1" || agent["endpoint"] != "10.0.0.1" {
+		t.Fatal("unexpected agent payload:", agent)
+	}
+}
+
+func TestSlackChannel(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+
+	if err := (SlackChannel{URL: standIn.URL}).Send(context.Background(), testMessage(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	if text := standIn.Requests()[0].Body["text"]; text != "*[PROBLEM] high load on web1*\nLoad: 12" {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
+
+func TestTeamsChannel(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	channel := TeamsChannel{URL: standIn.URL}
+
+	for _, problematic := range []bool{true, false} {
+		if err := channel.Send(context.Background(), testMessage(problematic)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := standIn.Requests()
+	if requests[0].Body["@type"] != "MessageCard" || requests[0].Body["title"] != "[PROBLEM] high load on web1" || requests[0].Body["text"] != "Load: 12" {
+		t.Fatal("unexpected card:", requests[0].Body)
+	}
+	if requests[0].Body["themeColor"] != "D63232" || requests[1].Body["themeColor"] != "2EB886" {
+		t.Fatal("problems and recoveries should use different colors:", requests[0].Body["themeColor"], requests[1].Body["themeColor"])
+	}
+}
+
+func TestPagerDutyChannel(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	channel := PagerDutyChannel{RoutingKey: "routing", URL: standIn.URL}
+
+	problem, recovery := testMessage(true), testMessage(false)
+	recovery.Agent, recovery.Trigger = problem.Agent, problem.Trigger
+	recovery.Severity = models.LOW
+	for _, k := range []Message{problem, recovery} {
+		if err := channel.Send(context.Background(), k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := standIn.Requests()
+	dedupKey := problem.Agent.ID.Hex() + "/" + problem.Trigger.ID.Hex()
+	for i, action := range []string{"trigger", "resolve"} {
+		body := requests[i].Body
+		if body["routing_key"] != "routing" || body["event_action"] != action || body["dedup_key"] != dedupKey {
+			t.Fatal("unexpected event:", body)
+		}
+	}
+
+	payload := requests[0].Body["payload"].(map[string]interface{})
+	if payload["severity"] != "critical" || payload["source"] != "web1" || payload["timestamp"] != "2021-03-04T05:06:07Z" {
+		t.Fatal("unexpected payload:", payload)
+	}
+	if payload := requests[1].Body["payload"].(map[string]interface{}); payload["severity"] != "warning" {
+		t.Fatal("severity of the message wasn't used:", payload["severity"])
+	}
+}
+
+func TestHTTPChannelStatus(t *testing.T) {
+	standIn := newHTTPStandIn(t, 1)
+
+	err := (WebhookChannel{URL: standIn.URL}).Send(context.Background(), testMessage(true))
+	if err == nil || !strings.Contains(err.Error(), "status 500") || !strings.Contains(err.Error(), "temporarily unavailable") {
+		t.Fatal("expected status error, got", err)
+	}
+}
+
+func TestEmailChannel(t *testing.T) {
+	standIn := newSMTPStandIn(t, 0)
+	channel := standIn.Channel()
+
+	message := testMessage(true)
+	message.Subject = "[PROBLEM] Überlast on web1"
+	message.Body = "Load: 12\nSince: 5m"
+	if err := channel.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := standIn.Mails()
+	if len(mails) != 1 {
+		t.Fatal("got", len(mails), "mails")
+	}
+	if mails[0].From != channel.From || strings.Join(mails[0].To, ",") != "ops@example.com,dev@example.com" {
+		t.Fatal("unexpected envelope:", mails[0].From, mails[0].To)
+	}
+	if !strings.Contains(mails[0].Data, "Subject: =?utf-8?q?[PROBLEM]_=C3=9Cberlast_on_web1?=\r\n") {
+		t.Fatal("subject isn't encoded:", mails[0].Data)
+	}
+	if !strings.HasSuffix(mails[0].Data, "\r\n\r\nLoad: 12\r\nSince: 5m\r\n") {
+		t.Fatalf("unexpected body %q", mails[0].Data)
+	}
+}
+
+func TestEmailChannelErrors(t *testing.T) {
+	if err := (EmailChannel{Host: "127.0.0.1"}).Send(context.Background(), testMessage(true)); err == nil {
+		t.Fatal("channel without recipients was accepted")
+	}
+
+	standIn := newSMTPStandIn(t, 1)
+	if err := standIn.Channel().Send(context.Background(), testMessage(true)); err == nil || !strings.Contains(err.Error(), "421") {
+		t.Fatal("expected rejection, got", err)
+	}
+}
@@ -0,0 +1,250 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Store is used to load the notification rules, silences, maintenances and trigger events as well as to persist the delivery log
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type Store interface {
+	GetAllNotificationRules(ctx context.Context) ([]models.NotificationRule, error)
+	GetActiveSilences(ctx context.Context, At time.Time) ([]models.Silence, error)
+	GetActiveMaintenances(ctx context.Context, At time.Time) ([]models.Maintenance, error)
+	GetTriggerEvents(ctx context.Context, Filter dbtemplate.TriggerEventFilter) ([]models.TriggerEvent, error)
+	InsertDelivery(ctx context.Context, Delivery models.Delivery) (models.Delivery, error)
+	UpdateDelivery(ctx context.Context, Delivery models.Delivery) error
+}
+
+//RetryPolicy defines how often a failed delivery is retried
+//The backoff doubles after every failed attempt until MaxBackoff is reached
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+//DefaultRetryPolicy is used by NewDispatcher
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    5 * time.Second,
+	MaxBackoff: time.Minute,
+}
+
+//ErrUnknownChannel is logged in the delivery if a notification rule references a channel the dispatcher doesn't know
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+//Dispatcher routes notifications to the channels of all matching notification rules
+type Dispatcher struct {
+	Store Store
+	//Channels maps the channel names used by the notification rules to the channel implementations
+	Channels map[string]Channel
+	Retry    RetryPolicy
+}
+
+//NewDispatcher returns a dispatcher using the DefaultRetryPolicy
+func NewDispatcher(Store Store, Channels map[string]Channel) *Dispatcher {
+	return &Dispatcher{
+		Store:    Store,
+		Channels: Channels,
+		Retry:    DefaultRetryPolicy,
+	}
+}
+
+//NotifyTransition sends the notification for the newest state change of the trigger on the agent
+//It should be called if dbtemplate.SetTriggerState reported a transition or a problem was closed via dbtemplate.CloseProblem
+//Values should contain the results used by the evaluation (expression.Outcome.Values) and may be nil
+func (d *Dispatcher) NotifyTransition(ctx context.Context, Agent models.Agent, Trigger models.Trigger, Values map[string]models.Result) ([]models.Delivery, error) {
+	events, err := d.Store.GetTriggerEvents(ctx, dbtemplate.TriggerEventFilter{
+		AgentIDs:   []primitive.ObjectID{Agent.ID},
+		TriggerIDs: []primitive.ObjectID{Trigger.ID},
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, dbtemplate.ErrNotFound
+	}
+
+	return d.Dispatch(ctx, Notification{Agent: Agent, Trigger: Trigger, Event: events[0], Values: Values})
+}
+
+//Dispatch sends the notification to the channels of all matching notification rules and returns the logged deliveries
+//Every channel is only notified once, even if it's referenced by multiple matching rules (the templates of the first rule are used)
+//Failed deliveries don't cause an error, they are logged with the DeliveryFailed status instead
+//Notifications muted by an active silence or covered by an active maintenance aren't sent at all
+func (d *Dispatcher) Dispatch(ctx context.Context, Notification Notification) ([]models.Delivery, error) {
+	rules, err := d.Store.GetAllNotificationRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	severity := Notification.effectiveSeverity()
+	targets := make([]target, 0)
+	for _, rule := range rules {
+		if !rule.Matches(Notification.Agent, Notification.Trigger.ID, severity, Notification.Event.Problematic) {
+			continue
+		}
+
+		for _, channel := range rule.Channels {
+			targets = append(targets, target{rule: rule, channel: channel})
+		}
+	}
+
+	return d.dispatch(ctx, Notification, targets, models.Delivery{})
+}
+
+//SendTo sends the notification to the specified channels without consulting the notification rules
+//Prototype is used as base for the logged deliveries (e.g. to record the escalation step), the default templates of the channels are used
+func (d *Dispatcher) SendTo(ctx context.Context, Notification Notification, Channels []string, Prototype models.Delivery) ([]models.Delivery, error) {
+	targets := make([]target, 0, len(Channels))
+	for _, channel := range Channels {
+		targets = append(targets, target{channel: channel})
+	}
+
+	return d.dispatch(ctx, Notification, targets, Prototype)
+}
+
+//target is a single channel a notification should be sent to
+type target struct {
+	rule    models.NotificationRule
+	channel string
+}
+
+//dispatch sends the notification to the targets unless it's muted by a silence or the trigger is in maintenance
+func (d *Dispatcher) dispatch(ctx context.Context, Notification Notification, Targets []target, Prototype models.Delivery) ([]models.Delivery, error) {
+	deliveries := make([]models.Delivery, 0)
+
+	now := time.Now()
+	silences, err := d.Store.GetActiveSilences(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	severity := Notification.effectiveSeverity()
+	if silencedBy := models.SilencedBy(silences, Notification.Agent, Notification.Trigger, severity, now); len(silencedBy) > 0 {
+		logger.Debug(loggingArea, "Notification for trigger", Notification.Trigger.Name, "on agent", Notification.Agent.Name, "is silenced by", silencedBy[0].Hex())
+		return deliveries, nil
+	}
+
+	maintenances, err := d.Store.GetActiveMaintenances(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if Notification.Agent.TriggerInMaintenance(maintenances, Notification.Trigger.ID, now) {
+		logger.Debug(loggingArea, "Notification for trigger", Notification.Trigger.Name, "on agent", Notification.Agent.Name, "is suppressed by a maintenance")
+		return deliveries, nil
+	}
+
+	messages := make([]Message, 0)
+	seen := make(map[string]bool)
+	for _, k := range Targets {
+		if seen[k.channel] {
+			continue
+		}
+		seen[k.channel] = true
+
+		message := render(Notification, k.rule, d.Channels[k.channel])
+
+		delivery := Prototype
+		delivery.EventID = Notification.Event.ID
+		delivery.AgentID = Notification.Agent.ID
+		delivery.TriggerID = Notification.Trigger.ID
+		delivery.RuleID = k.rule.ID
+		delivery.Channel = k.channel
+		delivery.Status = models.DeliveryPending
+		delivery.Subject = message.Subject
+
+		delivery, err := d.Store.InsertDelivery(ctx, delivery)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+		messages = append(messages, message)
+	}
+
+	//Channels are notified concurrently, so a slow / retrying channel doesn't delay the others
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(Delivery *models.Delivery, Message Message) {
+			defer wg.Done()
+			d.deliver(ctx, Delivery, Message)
+		}(&deliveries[i], messages[i])
+	}
+	wg.Wait()
+
+	return deliveries, nil
+}
+
+//deliver sends the message to the channel of the delivery and persists the result
+func (d *Dispatcher) deliver(ctx context.Context, Delivery *models.Delivery, Message Message) {
+	channel, found := d.Channels[Delivery.Channel]
+	if !found {
+		Delivery.Status = models.DeliveryFailed
+		Delivery.LastError = ErrUnknownChannel.Error()
+	} else {
+		d.attempt(ctx, channel, Delivery, Message)
+	}
+
+	//The delivery log should be written even if the notification context was cancelled in the meantime
+	updateCtx, cancel := context.WithTimeout(context.Background(), dbtemplate.DefaultTimeout)
+	defer cancel()
+	if err := d.Store.UpdateDelivery(updateCtx, *Delivery); err != nil {
+		logger.Error(loggingArea, "Couldn't update delivery", Delivery.ID.Hex(), ":", err)
+	}
+}
+
+//attempt sends the message to the channel and retries it according to the retry policy
+func (d *Dispatcher) attempt(ctx context.Context, Channel Channel, Delivery *models.Delivery, Message Message) {
+	attempts := d.Retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := d.Retry.Backoff
+
+	for {
+		Delivery.Attempts++
+		err := Channel.Send(ctx, Message)
+		if err == nil {
+			Delivery.Status = models.DeliverySent
+			Delivery.LastError = ""
+			return
+		}
+
+		Delivery.LastError = err.Error()
+		logger.Error(loggingArea, "Couldn't send notification via channel", Delivery.Channel, "( attempt", Delivery.Attempts, "):", err)
+
+		if Delivery.Attempts >= attempts || !sleep(ctx, backoff) {
+			Delivery.Status = models.DeliveryFailed
+			return
+		}
+
+		backoff *= 2
+		if d.Retry.MaxBackoff > 0 && backoff > d.Retry.MaxBackoff {
+			backoff = d.Retry.MaxBackoff
+		}
+	}
+}
+
+//sleep waits for the duration and returns false if the context was cancelled in the meantime
+func sleep(ctx context.Context, Duration time.Duration) bool {
+	timer := time.NewTimer(Duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
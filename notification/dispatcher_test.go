@@ -0,0 +1,251 @@
+package notification
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//testRetry keeps the retry tests fast, the backoff is long enough to be measured
+var testRetry = RetryPolicy{Attempts: 3, Backoff: 20 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+
+//newTestNotification returns the problem notification of a LOW trigger, whose severity was raised to HIGH on acknowledgement
+func newTestNotification() Notification {
+	high := models.HIGH
+	trigger := fixtures.Trigger("high load")
+	trigger.Severity = models.LOW
+	agent := fixtures.Agent("web1")
+	agent.Endpoint = "10.0.0.1"
+	agent.TriggerMappings = []models.TriggerAssignment{
+		{TriggerID: trigger.ID, Enabled: true, Problematic: true, SeverityOverride: &high},
+	}
+
+	return Notification{
+		Agent:   agent,
+		Trigger: trigger,
+		Event: models.TriggerEvent{
+			ID:          primitive.NewObjectID(),
+			AgentID:     agent.ID,
+			TriggerID:   trigger.ID,
+			Time:        time.Now(),
+			Problematic: true,
+			Severity:    models.LOW,
+		},
+	}
+}
+
+func newTestDispatcher(t *testing.T, Channels map[string]Channel, Rules ...models.NotificationRule) (*Dispatcher, *dbtemplate.MemoryStore) {
+	store := dbtemplate.NewMemoryStore()
+	for _, k := range Rules {
+		if _, err := store.CreateNotificationRule(context.Background(), k); err != nil {
+			t.Fatal("couldn't create rule:", err)
+		}
+	}
+
+	dispatcher := NewDispatcher(store, Channels)
+	dispatcher.Retry = testRetry
+
+	return dispatcher, store
+}
+
+func rule(Name string, Channels ...string) models.NotificationRule {
+	return models.NotificationRule{Name: Name, Enabled: true, Channels: Channels}
+}
+
+//storedDeliveries returns the persisted delivery log of the notification
+func storedDeliveries(t *testing.T, Store *dbtemplate.MemoryStore, Notification Notification) []models.Delivery {
+	deliveries, err := Store.GetDeliveries(context.Background(), dbtemplate.DeliveryFilter{EventIDs: []primitive.ObjectID{Notification.Event.ID}})
+	if err != nil {
+		t.Fatal("couldn't get deliveries:", err)
+	}
+
+	return deliveries
+}
+
+func TestDispatch(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	highOnly := rule("high", "webhook")
+	highOnly.Severities = []models.TriggerSeverity{models.HIGH}
+	lowOnly := rule("low", "webhook")
+	lowOnly.Severities = []models.TriggerSeverity{models.LOW}
+	disabled := rule("disabled", "webhook")
+	disabled.Enabled = false
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, lowOnly, disabled, highOnly)
+
+	notification := newTestNotification()
+	deliveries, err := dispatcher.Dispatch(context.Background(), notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Rules are matched against the effective severity, so only the HIGH rule matches
+	if len(deliveries) != 1 || len(standIn.Requests()) != 1 {
+		t.Fatal("got", len(deliveries), "deliveries and", len(standIn.Requests()), "requests")
+	}
+	if severity := standIn.Requests()[0].Body["trigger"].(map[string]interface{})["severity"]; severity != "HIGH" {
+		t.Fatal("effective severity wasn't sent:", severity)
+	}
+
+	stored := storedDeliveries(t, store, notification)
+	if len(stored) != 1 || stored[0].Status != models.DeliverySent || stored[0].Attempts != 1 || stored[0].LastError != "" {
+		t.Fatalf("unexpected delivery log: %+v", stored)
+	}
+	if stored[0].AgentID != notification.Agent.ID || stored[0].TriggerID != notification.Trigger.ID || stored[0].Channel != "webhook" || stored[0].Subject == "" {
+		t.Fatalf("delivery wasn't filled: %+v", stored[0])
+	}
+}
+
+func TestDispatchRetries(t *testing.T) {
+	standIn := newHTTPStandIn(t, 2)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, rule("all", "webhook"))
+
+	notification := newTestNotification()
+	if _, err := dispatcher.Dispatch(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := storedDeliveries(t, store, notification)
+	if len(stored) != 1 || stored[0].Status != models.DeliverySent || stored[0].Attempts != 3 || stored[0].LastError != "" {
+		t.Fatalf("unexpected delivery log: %+v", stored)
+	}
+
+	//The backoff doubles after every attempt until MaxBackoff is reached
+	requests := standIn.Requests()
+	if first := requests[1].At.Sub(requests[0].At); first < testRetry.Backoff {
+		t.Fatal("first retry was sent after", first)
+	}
+	if second := requests[2].At.Sub(requests[1].At); second < testRetry.MaxBackoff {
+		t.Fatal("second retry was sent after", second)
+	}
+}
+
+func TestDispatchFailure(t *testing.T) {
+	standIn := newHTTPStandIn(t, 100)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, rule("all", "webhook", "missing"))
+
+	notification := newTestNotification()
+	if _, err := dispatcher.Dispatch(context.Background(), notification); err != nil {
+		t.Fatal("failed deliveries mustn't cause an error:", err)
+	}
+
+	stored := storedDeliveries(t, store, notification)
+	if len(stored) != 2 {
+		t.Fatal("got", len(stored), "deliveries")
+	}
+	for _, k := range stored {
+		if k.Status != models.DeliveryFailed {
+			t.Fatalf("delivery wasn't marked as failed: %+v", k)
+		}
+
+		switch k.Channel {
+		case "webhook":
+			if k.Attempts != testRetry.Attempts || !strings.Contains(k.LastError, "status 500") {
+				t.Fatalf("unexpected webhook delivery: %+v", k)
+			}
+		case "missing":
+			if k.LastError != ErrUnknownChannel.Error() {
+				t.Fatalf("unexpected delivery of unknown channel: %+v", k)
+			}
+		}
+	}
+	if len(standIn.Requests()) != testRetry.Attempts {
+		t.Fatal("got", len(standIn.Requests()), "requests")
+	}
+}
+
+func TestDispatchEmail(t *testing.T) {
+	standIn := newSMTPStandIn(t, 1)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"email": standIn.Channel()}, rule("all", "email"))
+
+	notification := newTestNotification()
+	if _, err := dispatcher.Dispatch(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := storedDeliveries(t, store, notification)
+	if len(stored) != 1 || stored[0].Status != models.DeliverySent || stored[0].Attempts != 2 {
+		t.Fatalf("unexpected delivery log: %+v", stored)
+	}
+	if mails := standIn.Mails(); len(mails) != 1 || !strings.Contains(mails[0].Data, "Severity: HIGH") {
+		t.Fatal("mail wasn't rendered with the effective severity:", mails)
+	}
+}
+
+func TestDispatchSilenced(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, rule("all", "webhook"))
+
+	_, err := store.CreateSilence(context.Background(), models.Silence{
+		Matchers:  []models.Matcher{{Field: models.MatchSeverity, Value: "HIGH"}},
+		Start:     time.Now().Add(-time.Hour),
+		End:       time.Now().Add(time.Hour),
+		CreatedBy: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification := newTestNotification()
+	if deliveries, err := dispatcher.Dispatch(context.Background(), notification); err != nil || len(deliveries) != 0 {
+		t.Fatal("silenced notification was sent:", deliveries, err)
+	}
+	if len(standIn.Requests()) != 0 || len(storedDeliveries(t, store, notification)) != 0 {
+		t.Fatal("silenced notification was sent")
+	}
+}
+
+func TestDispatchMaintenance(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, rule("all", "webhook"))
+
+	notification := newTestNotification()
+	other := newTestNotification()
+	_, err := store.CreateMaintenance(context.Background(), models.Maintenance{
+		Name:  "patching",
+		Scope: models.MaintenanceScope{AgentIDs: []primitive.ObjectID{notification.Agent.ID}},
+		Start: time.Now().Add(-time.Hour),
+		End:   time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deliveries, err := dispatcher.Dispatch(context.Background(), notification); err != nil || len(deliveries) != 0 {
+		t.Fatal("notification of agent in maintenance was sent:", deliveries, err)
+	}
+	if deliveries, err := dispatcher.SendTo(context.Background(), notification, []string{"webhook"}, models.Delivery{}); err != nil || len(deliveries) != 0 {
+		t.Fatal("escalation of agent in maintenance was sent:", deliveries, err)
+	}
+	if deliveries, err := dispatcher.Dispatch(context.Background(), other); err != nil || len(deliveries) != 1 {
+		t.Fatal("notification of agent without maintenance wasn't sent:", deliveries, err)
+	}
+	if len(standIn.Requests()) != 1 {
+		t.Fatal("got", len(standIn.Requests()), "requests")
+	}
+}
+
+func TestNotifyTransition(t *testing.T) {
+	standIn := newHTTPStandIn(t, 0)
+	dispatcher, store := newTestDispatcher(t, map[string]Channel{"webhook": WebhookChannel{URL: standIn.URL}}, rule("all", "webhook"))
+
+	notification := newTestNotification()
+	if _, err := dispatcher.NotifyTransition(context.Background(), notification.Agent, notification.Trigger, nil); err != dbtemplate.ErrNotFound {
+		t.Fatal("expected ErrNotFound without event, got", err)
+	}
+
+	event, err := store.InsertTriggerEvent(context.Background(), notification.Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := dispatcher.NotifyTransition(context.Background(), notification.Agent, notification.Trigger, nil)
+	if err != nil || len(deliveries) != 1 || deliveries[0].EventID != event.ID {
+		t.Fatal("newest event wasn't sent:", deliveries, err)
+	}
+}
@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//EmailChannel sends every notification as plain text email via SMTP
+//STARTTLS is used if the server supports it
+type EmailChannel struct {
+	Host string
+	Port int
+	//Username and Password are used for PLAIN authentication if Username is set
+	Username, Password string
+	From               string
+	To                 []string
+}
+
+//Send sends the notification to all recipients
+func (e EmailChannel) Send(ctx context.Context, Message Message) error {
+	if len(e.To) == 0 {
+		return errors.New("email channel has no recipients")
+	}
+
+	port := e.Port
+	if port == 0 {
+		port = 25
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(e.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: e.Host}); err != nil {
+			return err
+		}
+	}
+
+	if e.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, k := range e.To {
+		if err := client.Rcpt(k); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(e.buildMail(Message)); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (e EmailChannel) buildMail(Message Message) []byte {
+	var mail bytes.Buffer
+	fmt.Fprintf(&mail, "From: %s\r\n", e.From)
+	fmt.Fprintf(&mail, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&mail, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", Message.Subject))
+	fmt.Fprintf(&mail, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	mail.WriteString("MIME-Version: 1.0\r\n")
+	mail.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	mail.WriteString("\r\n")
+	mail.WriteString(strings.ReplaceAll(strings.ReplaceAll(Message.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return mail.Bytes()
+}
@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+//HTTPTimeout is used for every request of the webhook based channels, if they don't specify their own client
+var HTTPTimeout = 10 * time.Second
+
+//WebhookChannel posts a JSON representation of every notification to the URL
+type WebhookChannel struct {
+	URL     string
+	Headers map[string]string
+	//Client is used to send the requests, a client with HTTPTimeout is used if it's nil
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+	Problematic bool      `json:"problematic"`
+	Time        time.Time `json:"time"`
+	Error       string    `json:"error,omitempty"`
+	Agent       struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Endpoint string `json:"endpoint"`
+	} `json:"agent"`
+	Trigger struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Severity string `json:"severity"`
+	} `json:"trigger"`
+}
+
+//Send posts the notification to the webhook
+func (w WebhookChannel) Send(ctx context.Context, Message Message) error {
+	payload := webhookPayload{
+		Subject:     Message.Subject,
+		Body:        Message.Body,
+		Problematic: Message.Event.Problematic,
+		Time:        Message.Event.Time,
+		Error:       Message.Event.Error,
+	}
+	payload.Agent.ID = Message.Agent.ID.Hex()
+	payload.Agent.Name = Message.Agent.Name
+	payload.Agent.Endpoint = Message.Agent.Endpoint
+	payload.Trigger.ID = Message.Trigger.ID.Hex()
+	payload.Trigger.Name = Message.Trigger.Name
+	payload.Trigger.Severity = Message.Severity.String()
+
+	return postJSON(ctx, w.Client, w.URL, w.Headers, payload)
+}
+
+//SlackChannel posts every notification to a Slack (or compatible) incoming webhook
+type SlackChannel struct {
+	URL    string
+	Client *http.Client
+}
+
+//Send posts the notification to the incoming webhook
+func (s SlackChannel) Send(ctx context.Context, Message Message) error {
+	return postJSON(ctx, s.Client, s.URL, nil, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", Message.Subject, Message.Body),
+	})
+}
+
+//TeamsChannel posts every notification as MessageCard to a Microsoft Teams incoming webhook
+type TeamsChannel struct {
+	URL    string
+	Client *http.Client
+}
+
+//Send posts the notification to the incoming webhook
+func (t TeamsChannel) Send(ctx context.Context, Message Message) error {
+	color := "2EB886"
+	if Message.Event.Problematic {
+		color = "D63232"
+	}
+
+	return postJSON(ctx, t.Client, t.URL, nil, map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    Message.Subject,
+		"title":      Message.Subject,
+		"text":       Message.Body,
+		"themeColor": color,
+	})
+}
+
+//postJSON posts the payload to the URL and returns an error if the server doesn't respond with a 2xx status
+func postJSON(ctx context.Context, Client *http.Client, URL string, Headers map[string]string, Payload interface{}) error {
+	body, err := json.Marshal(Payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for k, v := range Headers {
+		request.Header.Set(k, v)
+	}
+
+	if Client == nil {
+		Client = &http.Client{Timeout: HTTPTimeout}
+	}
+
+	response, err := Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s responded with status %d: %s", URL, response.StatusCode, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
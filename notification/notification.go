@@ -0,0 +1,43 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+)
+
+const loggingArea = "NOTIFICATION"
+
+//Notification describes a single state change of a trigger assignment, which should be sent to the matching channels
+type Notification struct {
+	//Agent has to be populated if notification rules are scoped to templates
+	Agent   models.Agent
+	Trigger models.Trigger
+	Event   models.TriggerEvent
+	//Values contains the item results used by the trigger expression (expression.Outcome.Values)
+	Values map[string]models.Result
+}
+
+//effectiveSeverity returns the severity of the trigger assignment, which may have been changed on acknowledgement
+//The severity recorded in the event is used if the agent has no assignment for the trigger
+func (n Notification) effectiveSeverity() models.TriggerSeverity {
+	if assignment, err := n.Agent.GetTriggerMappingByTriggerID(n.Trigger.ID); err == nil {
+		return assignment.EffectiveSeverity(n.Trigger)
+	}
+
+	return n.Event.Severity
+}
+
+//Message is the rendered notification passed to the channels
+type Message struct {
+	Notification
+	Subject, Body string
+	//Severity is the effective severity of the trigger assignment, channels should use it instead of the severity of the event
+	Severity models.TriggerSeverity
+}
+
+//Channel is implemented by every notification target
+//Send has to return an error if the notification wasn't accepted, so the dispatcher can retry it
+type Channel interface {
+	Send(ctx context.Context, Message Message) error
+}
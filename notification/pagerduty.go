@@ -0,0 +1,80 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+)
+
+//PagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+//PagerDutyChannel sends every notification as event to the PagerDuty Events API v2
+//Problems trigger an alert, recoveries resolve it again
+type PagerDutyChannel struct {
+	RoutingKey string
+	//URL is used instead of PagerDutyEventsURL if it's set
+	URL    string
+	Client *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+//Send sends the notification to PagerDuty
+func (p PagerDutyChannel) Send(ctx context.Context, Message Message) error {
+	event := pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		//The dedup key groups all events of a trigger assignment into a single alert
+		DedupKey: Message.Agent.ID.Hex() + "/" + Message.Trigger.ID.Hex(),
+		Payload: pagerDutyPayload{
+			Summary:  Message.Subject,
+			Source:   Message.Agent.Name,
+			Severity: pagerDutySeverity(Message.Severity),
+			CustomDetails: map[string]string{
+				"body": Message.Body,
+			},
+		},
+	}
+	if !Message.Event.Problematic {
+		event.EventAction = "resolve"
+	}
+	if !Message.Event.Time.IsZero() {
+		event.Payload.Timestamp = Message.Event.Time.Format(time.RFC3339)
+	}
+
+	url := p.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+
+	return postJSON(ctx, p.Client, url, nil, event)
+}
+
+func pagerDutySeverity(Severity models.TriggerSeverity) string {
+	switch Severity {
+	case models.LOW:
+		return "warning"
+	case models.MEDIUM:
+		return "error"
+	case models.HIGH:
+		return "critical"
+	}
+
+	return "info"
+}
@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"github.com/FlowKeeper/FlowUtils/v2/templating"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/logger"
+	"gitlab.cloud.spuda.net/Wieneo/golangutils/v2/stringHelper"
+)
+
+//Templates contains the message templates used for problems and recoveries
+type Templates struct {
+	Problem, Recovery models.MessageTemplate
+}
+
+//TemplateProvider is implemented by channels which need a channel specific message format
+//DefaultTemplates is used for all other channels
+type TemplateProvider interface {
+	Templates() Templates
+}
+
+const defaultSubject = `[{{ .State }}] {{ .Trigger.Name }} on {{ .Agent.Name }}`
+
+const defaultValues = `{{ if .Error }}Error: {{ .Error }}
+{{ end }}{{ range $name, $value := .Values }}{{ $name }}: {{ $value }}
+{{ end }}{{ if .Trigger.Description }}
+{{ .Trigger.Description }}
+{{ end }}`
+
+//DefaultTemplates are plain text templates used if neither the notification rule nor the channel specify templates
+var DefaultTemplates = Templates{
+	Problem: models.MessageTemplate{
+		Subject: defaultSubject,
+		Body: `Trigger: {{ .Trigger.Name }}
+Agent: {{ .Agent.Name }} ({{ .Agent.Endpoint }})
+Severity: {{ .Trigger.Severity }}
+Time: {{ formatTime "2006-01-02 15:04:05 MST" .Time }}
+` + defaultValues,
+	},
+	Recovery: models.MessageTemplate{
+		Subject: defaultSubject,
+		Body: `Trigger: {{ .Trigger.Name }}
+Agent: {{ .Agent.Name }} ({{ .Agent.Endpoint }})
+Severity: {{ .Trigger.Severity }}
+Time: {{ formatTime "2006-01-02 15:04:05 MST" .Time }}
+Problem duration: {{ duration .Duration }}
+` + defaultValues,
+	},
+}
+
+//Templates returns the Slack specific message templates
+func (s SlackChannel) Templates() Templates {
+	return Templates{
+		Problem: models.MessageTemplate{
+			Subject: defaultSubject,
+			Body: `*Agent:* {{ .Agent.Name }} ({{ .Agent.Endpoint }})
+*Severity:* {{ .Trigger.Severity }}
+{{ if .Error }}*Error:* {{ .Error }}
+{{ end }}{{ range $name, $value := .Values }}*{{ $name }}:* {{ $value }}
+{{ end }}{{ if .Trigger.Description }}>{{ .Trigger.Description }}
+{{ end }}`,
+		},
+		Recovery: models.MessageTemplate{
+			Subject: defaultSubject,
+			Body: `*Agent:* {{ .Agent.Name }} ({{ .Agent.Endpoint }})
+*Severity:* {{ .Trigger.Severity }}
+*Problem duration:* {{ duration .Duration }}
+`,
+		},
+	}
+}
+
+//Templates returns the Teams specific message templates
+func (t TeamsChannel) Templates() Templates {
+	return Templates{
+		Problem: models.MessageTemplate{
+			Subject: defaultSubject,
+			Body: `**Agent:** {{ .Agent.Name }} ({{ .Agent.Endpoint }})<br>
+**Severity:** {{ .Trigger.Severity }}<br>
+{{ if .Error }}**Error:** {{ .Error }}<br>
+{{ end }}{{ range $name, $value := .Values }}**{{ $name }}:** {{ $value }}<br>
+{{ end }}{{ .Trigger.Description }}`,
+		},
+		Recovery: models.MessageTemplate{
+			Subject: defaultSubject,
+			Body: `**Agent:** {{ .Agent.Name }} ({{ .Agent.Endpoint }})<br>
+**Severity:** {{ .Trigger.Severity }}<br>
+**Problem duration:** {{ duration .Duration }}`,
+		},
+	}
+}
+
+//Templates returns the PagerDuty specific message templates
+//The subject is used as summary of the alert, so it contains the most important details
+func (p PagerDutyChannel) Templates() Templates {
+	return Templates{
+		Problem: models.MessageTemplate{
+			Subject: `{{ .Trigger.Name }} on {{ .Agent.Name }}{{ if .Error }}: {{ .Error }}{{ end }}`,
+			Body:    DefaultTemplates.Problem.Body,
+		},
+		Recovery: models.MessageTemplate{
+			Subject: `{{ .Trigger.Name }} on {{ .Agent.Name }} resolved after {{ duration .Duration }}`,
+			Body:    DefaultTemplates.Recovery.Body,
+		},
+	}
+}
+
+//channelTemplates returns the templates of the channel
+func channelTemplates(Channel Channel) Templates {
+	if provider, ok := Channel.(TemplateProvider); ok {
+		return provider.Templates()
+	}
+
+	return DefaultTemplates
+}
+
+//render renders the notification for the channel
+//The template of the rule is preferred over the default template of the channel
+func render(Notification Notification, Rule models.NotificationRule, Channel Channel) Message {
+	defaults := channelTemplates(Channel)
+	selected, fallback := Rule.ProblemTemplate, defaults.Problem
+	if !Notification.Event.Problematic {
+		selected, fallback = Rule.RecoveryTemplate, defaults.Recovery
+	}
+
+	data := templating.NewData(Notification.Agent, Notification.Trigger, Notification.Event, Notification.Values)
+	message := Message{Notification: Notification, Severity: Notification.effectiveSeverity()}
+
+	if !selected.IsEmpty() {
+		//Rules may only override the subject or the body
+		if stringHelper.IsEmpty(selected.Subject) {
+			selected.Subject = fallback.Subject
+		}
+		if stringHelper.IsEmpty(selected.Body) {
+			selected.Body = fallback.Body
+		}
+
+		subject, body, err := templating.Render(selected, data)
+		if err == nil {
+			message.Subject, message.Body = subject, body
+			return message
+		}
+
+		//Templates are validated when the rule is stored, so this should only happen for rules stored by older versions
+		logger.Error(loggingArea, "Couldn't render template of notification rule", Rule.Name, "-> Using default template:", err)
+	}
+
+	subject, body, err := templating.Render(fallback, data)
+	if err != nil {
+		logger.Error(loggingArea, "Couldn't render default template:", err)
+		subject = Notification.Trigger.Name
+	}
+	message.Subject, message.Body = subject, body
+
+	return message
+}
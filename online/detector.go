@@ -0,0 +1,111 @@
+package online
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Store is used to persist the state of the agents
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type Store interface {
+	SetAgentState(ctx context.Context, AgentID primitive.ObjectID, State models.AgentState, LastSeen time.Time, At time.Time, Error string) (bool, error)
+}
+
+//Policy defines when an agent is regarded offline
+type Policy struct {
+	//GraceMultiplier is multiplied with the scrape interval of the agent, so a few missed scrapes don't mark it offline
+	GraceMultiplier float64
+	//MinimumTimeout is used instead if the multiplied scrape interval is shorter
+	MinimumTimeout time.Duration
+}
+
+//DefaultPolicy regards agents offline after three missed scrapes, but not before two minutes passed
+var DefaultPolicy = Policy{GraceMultiplier: 3, MinimumTimeout: 2 * time.Minute}
+
+//Timeout returns how long the agent may not be seen before it is regarded offline
+func (p Policy) Timeout(Agent models.Agent) time.Duration {
+	multiplier := p.GraceMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	timeout := time.Duration(float64(time.Duration(Agent.ScrapeInterval)*time.Second) * multiplier)
+	if timeout < p.MinimumTimeout {
+		timeout = p.MinimumTimeout
+	}
+
+	return timeout
+}
+
+//State returns the state of the agent at the specified time and the reason if it is offline
+//Agents which aren't monitored (see models.Agent.Scrapable) are always regarded online, so they don't keep an unreachable problem
+func (p Policy) State(Agent models.Agent, At time.Time) (models.AgentState, string) {
+	if !Agent.Scrapable() {
+		return models.Online, ""
+	}
+
+	if Agent.LastSeen.IsZero() {
+		return models.Offline, "agent was never seen"
+	}
+
+	timeout := p.Timeout(Agent)
+	if since := At.Sub(Agent.LastSeen); since > timeout {
+		return models.Offline, fmt.Sprintf("agent wasn't seen for %s (timeout %s)", since.Round(time.Second), timeout)
+	}
+
+	return models.Online, ""
+}
+
+//Transition describes a state change of an agent detected by Check
+//Notifications can be sent by passing the agent and models.UnreachableTrigger() to notification.Dispatcher.NotifyTransition
+type Transition struct {
+	//Agent contains the agent with the new state
+	Agent models.Agent
+	From  models.AgentState
+	To    models.AgentState
+	Error string
+}
+
+//Detector derives the state of agents from the time they were last seen
+type Detector struct {
+	Store  Store
+	Policy Policy
+}
+
+//NewDetector returns a detector using the specified policy
+func NewDetector(Store Store, Policy Policy) *Detector {
+	return &Detector{Store: Store, Policy: Policy}
+}
+
+//Check evaluates the state of all agents at the specified time and persists every change
+//Only the transitions made by this call are returned, transitions persisted concurrently by another instance are omitted
+//Agents seen after they were loaded aren't marked offline, as the decision is based on the LastSeen of the passed agents
+func (d *Detector) Check(ctx context.Context, Agents []models.Agent, At time.Time) ([]Transition, error) {
+	transitions := make([]Transition, 0)
+
+	for _, agent := range Agents {
+		state, reason := d.Policy.State(agent, At)
+		if state == agent.State {
+			continue
+		}
+
+		changed, err := d.Store.SetAgentState(ctx, agent.ID, state, agent.LastSeen, At, reason)
+		if err != nil {
+			return transitions, err
+		}
+		if !changed {
+			continue
+		}
+
+		transition := Transition{Agent: agent, From: agent.State, To: state, Error: reason}
+		transition.Agent.State = state
+		transition.Agent.StateChanged = At
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, nil
+}
@@ -0,0 +1,266 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//EventSource is used to load the trigger events a report is calculated from
+//It is implemented by dbtemplate.MongoStore and dbtemplate.MemoryStore
+type EventSource interface {
+	GetTriggerEvents(ctx context.Context, Filter dbtemplate.TriggerEventFilter) ([]models.TriggerEvent, error)
+}
+
+//Options defines the reporting period and the time ranges excluded from it (e.g. maintenance windows)
+type Options struct {
+	Period  Period
+	Exclude []Period
+}
+
+//Report stores the availability figures for a single agent, trigger or a group of them
+type Report struct {
+	Period Period
+	//Monitored is the length of the period without the excluded time ranges
+	Monitored time.Duration
+	//ProblemTime is the time during which at least one of the covered triggers was problematic
+	ProblemTime time.Duration
+	//Availability is the percentage (0-100) of the monitored time without problems
+	Availability float64
+	//Incidents is the number of problems overlapping the period (including a problem already ongoing at the start)
+	Incidents int
+	//MTTR is the mean time to recovery (ProblemTime / Incidents)
+	MTTR time.Duration
+	//MTBF is the mean time between failures (problem-free monitored time / Incidents)
+	MTBF time.Duration
+}
+
+//Summary stores the report for a group of agents as well as the report of every single agent
+type Summary struct {
+	Total  Report
+	Agents map[primitive.ObjectID]Report
+}
+
+//ErrInvalidPeriod is returned if the end of the reporting period isn't after its start
+var ErrInvalidPeriod = errors.New("end of reporting period has to be after its start")
+
+//ForTrigger calculates the availability of a single trigger on the specified agent
+func ForTrigger(ctx context.Context, Source EventSource, AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Options Options) (Report, error) {
+	problems, err := loadProblems(ctx, Source, AgentID, []primitive.ObjectID{TriggerID}, Options.Period)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return calculate(problems, Options), nil
+}
+
+//ForAgent calculates the availability of the agent
+//The agent is regarded as unavailable as long as any of its trigger assignments is problematic
+func ForAgent(ctx context.Context, Source EventSource, Agent models.Agent, Options Options) (Report, error) {
+	triggerIDs := make([]primitive.ObjectID, 0, len(Agent.TriggerMappings))
+	for _, k := range Agent.TriggerMappings {
+		triggerIDs = append(triggerIDs, k.TriggerID)
+	}
+
+	problems, err := loadProblems(ctx, Source, Agent.ID, triggerIDs, Options.Period)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return calculate(problems, Options), nil
+}
+
+//ForAgents calculates the availability of every specified agent and the combined availability of all of them
+func ForAgents(ctx context.Context, Source EventSource, Agents []models.Agent, Options Options) (Summary, error) {
+	reports := make([]Report, 0, len(Agents))
+	summary := Summary{Agents: make(map[primitive.ObjectID]Report)}
+
+	for _, k := range Agents {
+		report, err := ForAgent(ctx, Source, k, Options)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		summary.Agents[k.ID] = report
+		reports = append(reports, report)
+	}
+
+	summary.Total = combine(Options.Period, reports)
+	return summary, nil
+}
+
+//ForTemplate calculates the availability of the triggers of the template on every agent linked to it
+//Agents which aren't linked to the template are ignored
+func ForTemplate(ctx context.Context, Source EventSource, Template models.Template, Agents []models.Agent, Options Options) (Summary, error) {
+	reports := make([]Report, 0)
+	summary := Summary{Agents: make(map[primitive.ObjectID]Report)}
+
+	for _, agent := range Agents {
+		linked := false
+		for _, k := range agent.TemplateIDs {
+			if k == Template.ID {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			continue
+		}
+
+		problems, err := loadProblems(ctx, Source, agent.ID, Template.TriggerIDs, Options.Period)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		report := calculate(problems, Options)
+		summary.Agents[agent.ID] = report
+		reports = append(reports, report)
+	}
+
+	summary.Total = combine(Options.Period, reports)
+	return summary, nil
+}
+
+//Calculate calculates the availability from the events of a single trigger assignment
+//Events may be in any order, the state at the start of the period is taken from the newest event before it
+func Calculate(Events []models.TriggerEvent, Options Options) Report {
+	return calculate(problemPeriods(Events, Options.Period), Options)
+}
+
+//MaintenancePeriods returns the windows of all maintenances covering the whole agent during the period
+//The result can be used as Options.Exclude
+func MaintenancePeriods(Maintenances []models.Maintenance, Agent models.Agent, Bounds Period) []Period {
+	periods := make([]Period, 0)
+	for _, maintenance := range Maintenances {
+		if !maintenance.CoversAgent(Agent) {
+			continue
+		}
+
+		for _, k := range maintenance.Occurrences(Bounds.From, Bounds.To) {
+			periods = append(periods, Period{From: k.Start, To: k.End}.clip(Bounds))
+		}
+	}
+
+	return merge(periods)
+}
+
+//loadProblems returns all periods during which any of the triggers was problematic on the agent
+func loadProblems(ctx context.Context, Source EventSource, AgentID primitive.ObjectID, TriggerIDs []primitive.ObjectID, Bounds Period) ([]Period, error) {
+	if !Bounds.To.After(Bounds.From) {
+		return nil, ErrInvalidPeriod
+	}
+
+	problems := make([]Period, 0)
+	for _, triggerID := range TriggerIDs {
+		filter := dbtemplate.TriggerEventFilter{
+			AgentIDs:   []primitive.ObjectID{AgentID},
+			TriggerIDs: []primitive.ObjectID{triggerID},
+		}
+
+		//The newest event before the period defines whether the period starts mid-incident
+		filter.To = Bounds.From
+		filter.Limit = 1
+		initial, err := Source.GetTriggerEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.From = Bounds.From
+		filter.To = Bounds.To
+		filter.Limit = 0
+		events, err := Source.GetTriggerEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, problemPeriods(append(events, initial...), Bounds)...)
+	}
+
+	return problems, nil
+}
+
+//problemPeriods converts the events of a single trigger assignment into the periods it was problematic, clipped to the reporting period
+func problemPeriods(Events []models.TriggerEvent, Bounds Period) []Period {
+	sorted := append(make([]models.TriggerEvent, 0, len(Events)), Events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	periods := make([]Period, 0)
+	var problemSince time.Time
+	problematic := false
+
+	for _, k := range sorted {
+		if k.Time.After(Bounds.To) {
+			break
+		}
+
+		if k.Problematic && !problematic {
+			problemSince = k.Time
+		} else if !k.Problematic && problematic {
+			periods = append(periods, Period{From: problemSince, To: k.Time}.clip(Bounds))
+		}
+		problematic = k.Problematic
+	}
+
+	//Problem still ongoing at the end of the period
+	if problematic {
+		periods = append(periods, Period{From: problemSince, To: Bounds.To}.clip(Bounds))
+	}
+
+	return periods
+}
+
+func calculate(Problems []Period, Options Options) Report {
+	report := Report{Period: Options.Period}
+
+	excluded := make([]Period, 0, len(Options.Exclude))
+	for _, k := range Options.Exclude {
+		excluded = append(excluded, k.clip(Options.Period))
+	}
+	excluded = merge(excluded)
+
+	report.Monitored = totalDuration(subtract(Options.Period, excluded))
+
+	for _, k := range merge(Problems) {
+		//Problems which happened entirely during excluded time ranges aren't counted as incidents
+		remaining := totalDuration(subtract(k, excluded))
+		if remaining > 0 {
+			report.Incidents++
+			report.ProblemTime += remaining
+		}
+	}
+
+	return finish(report)
+}
+
+//combine sums up multiple reports for the same period
+func combine(P Period, Reports []Report) Report {
+	total := Report{Period: P}
+	for _, k := range Reports {
+		total.Monitored += k.Monitored
+		total.ProblemTime += k.ProblemTime
+		total.Incidents += k.Incidents
+	}
+
+	return finish(total)
+}
+
+//finish calculates the derived figures of the report
+func finish(R Report) Report {
+	R.Availability = 100
+	if R.Monitored > 0 {
+		R.Availability = 100 * float64(R.Monitored-R.ProblemTime) / float64(R.Monitored)
+	}
+
+	R.MTBF = R.Monitored - R.ProblemTime
+	if R.Incidents > 0 {
+		R.MTTR = R.ProblemTime / time.Duration(R.Incidents)
+		R.MTBF = (R.Monitored - R.ProblemTime) / time.Duration(R.Incidents)
+	}
+
+	return R
+}
@@ -0,0 +1,110 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/dbtemplate"
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//event returns a state change of the trigger at the specified hour of the base day
+func event(AgentID primitive.ObjectID, TriggerID primitive.ObjectID, Hour float64, Problematic bool) models.TriggerEvent {
+	return models.TriggerEvent{
+		AgentID:     AgentID,
+		TriggerID:   TriggerID,
+		Time:        base.Add(time.Duration(Hour * float64(time.Hour))),
+		Problematic: Problematic,
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	agent, trigger := primitive.NewObjectID(), primitive.NewObjectID()
+
+	cases := []struct {
+		name        string
+		events      []models.TriggerEvent
+		exclude     []Period
+		monitored   time.Duration
+		problemTime time.Duration
+		incidents   int
+	}{
+		{"no events", nil, nil, 10 * time.Hour, 0, 0},
+		{"single incident", []models.TriggerEvent{event(agent, trigger, 4, false), event(agent, trigger, 2, true)}, nil, 10 * time.Hour, 2 * time.Hour, 1},
+		{"ongoing at start and end", []models.TriggerEvent{event(agent, trigger, -1, true), event(agent, trigger, 3, false), event(agent, trigger, 9, true)}, nil, 10 * time.Hour, 4 * time.Hour, 2},
+		{"repeated state", []models.TriggerEvent{event(agent, trigger, 2, true), event(agent, trigger, 3, true), event(agent, trigger, 4, false)}, nil, 10 * time.Hour, 2 * time.Hour, 1},
+		{"partly excluded", []models.TriggerEvent{event(agent, trigger, 2, true), event(agent, trigger, 4, false)}, []Period{hours(3, 5)}, 8 * time.Hour, time.Hour, 1},
+		{"entirely excluded", []models.TriggerEvent{event(agent, trigger, 2, true), event(agent, trigger, 4, false)}, []Period{hours(1, 3), hours(3, 5)}, 6 * time.Hour, 0, 0},
+		{"exclusion outside of period", nil, []Period{hours(-5, 0), hours(10, 12)}, 10 * time.Hour, 0, 0},
+	}
+
+	for _, k := range cases {
+		report := Calculate(k.events, Options{Period: hours(0, 10), Exclude: k.exclude})
+		if report.Monitored != k.monitored || report.ProblemTime != k.problemTime || report.Incidents != k.incidents {
+			t.Errorf("%s: got monitored %s, problem time %s, %d incidents", k.name, report.Monitored, report.ProblemTime, report.Incidents)
+		}
+	}
+}
+
+func TestFinish(t *testing.T) {
+	report := finish(Report{Monitored: 10 * time.Hour, ProblemTime: 2 * time.Hour, Incidents: 2})
+	if report.Availability != 80 || report.MTTR != time.Hour || report.MTBF != 4*time.Hour {
+		t.Fatalf("unexpected figures: %+v", report)
+	}
+
+	if report := finish(Report{}); report.Availability != 100 {
+		t.Fatal("empty report isn't fully available:", report.Availability)
+	}
+}
+
+func TestForAgents(t *testing.T) {
+	ctx := context.Background()
+	store := dbtemplate.NewMemoryStore()
+
+	cpu, disk := fixtures.Trigger("cpu"), fixtures.Trigger("disk")
+	template := fixtures.Template("linux", nil, []models.Trigger{cpu, disk})
+	web, db := fixtures.Agent("web1", template), fixtures.Agent("db1", template)
+	for _, agent := range []*models.Agent{&web, &db} {
+		agent.TriggerMappings = []models.TriggerAssignment{{TriggerID: cpu.ID, Enabled: true}, {TriggerID: disk.ID, Enabled: true}}
+	}
+
+	//The problems of web1 overlap, so they are counted as a single incident
+	events := []models.TriggerEvent{
+		event(web.ID, cpu.ID, 1, true), event(web.ID, cpu.ID, 3, false),
+		event(web.ID, disk.ID, 2, true), event(web.ID, disk.ID, 4, false),
+		event(db.ID, disk.ID, 6, true),
+	}
+	for _, k := range events {
+		if _, err := store.InsertTriggerEvent(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := ForAgents(ctx, store, []models.Agent{web, db}, Options{Period: hours(0, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := summary.Agents[web.ID]; report.Incidents != 1 || report.ProblemTime != 3*time.Hour {
+		t.Fatalf("web1: %+v", report)
+	}
+	if report := summary.Agents[db.ID]; report.Incidents != 1 || report.ProblemTime != 4*time.Hour {
+		t.Fatalf("db1: %+v", report)
+	}
+	if summary.Total.Monitored != 20*time.Hour || summary.Total.ProblemTime != 7*time.Hour || summary.Total.Availability != 65 {
+		t.Fatalf("total: %+v", summary.Total)
+	}
+
+	//The problem of the cpu trigger on web1 started before the period
+	report, err := ForTrigger(ctx, store, web.ID, cpu.ID, Options{Period: hours(2, 10)})
+	if err != nil || report.ProblemTime != time.Hour || report.Incidents != 1 {
+		t.Fatalf("trigger: %+v, %v", report, err)
+	}
+
+	if _, err := ForAgent(ctx, store, web, Options{Period: hours(5, 5)}); !errors.Is(err, ErrInvalidPeriod) {
+		t.Fatal("empty period:", err)
+	}
+}
@@ -0,0 +1,92 @@
+package reporting
+
+import (
+	"sort"
+	"time"
+)
+
+//Period defines a time range, From is inclusive and To is exclusive
+type Period struct {
+	From, To time.Time
+}
+
+//Duration returns the length of the period
+func (p Period) Duration() time.Duration {
+	if !p.To.After(p.From) {
+		return 0
+	}
+
+	return p.To.Sub(p.From)
+}
+
+//clip limits the period to the specified bounds
+func (p Period) clip(Bounds Period) Period {
+	if p.From.Before(Bounds.From) {
+		p.From = Bounds.From
+	}
+	if p.To.After(Bounds.To) {
+		p.To = Bounds.To
+	}
+
+	return p
+}
+
+//merge sorts the periods and joins overlapping / touching periods
+//Empty periods are dropped
+func merge(Periods []Period) []Period {
+	sorted := make([]Period, 0, len(Periods))
+	for _, k := range Periods {
+		if k.Duration() > 0 {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From.Before(sorted[j].From) })
+
+	merged := make([]Period, 0, len(sorted))
+	for _, k := range sorted {
+		if len(merged) > 0 && !k.From.After(merged[len(merged)-1].To) {
+			if k.To.After(merged[len(merged)-1].To) {
+				merged[len(merged)-1].To = k.To
+			}
+			continue
+		}
+		merged = append(merged, k)
+	}
+
+	return merged
+}
+
+//subtract removes the excluded periods from the specified period
+//Exclude has to be merged
+func subtract(P Period, Exclude []Period) []Period {
+	remaining := []Period{P}
+
+	for _, excluded := range Exclude {
+		next := make([]Period, 0, len(remaining)+1)
+		for _, k := range remaining {
+			if !excluded.From.Before(k.To) || !excluded.To.After(k.From) {
+				next = append(next, k)
+				continue
+			}
+
+			if excluded.From.After(k.From) {
+				next = append(next, Period{From: k.From, To: excluded.From})
+			}
+			if excluded.To.Before(k.To) {
+				next = append(next, Period{From: excluded.To, To: k.To})
+			}
+		}
+		remaining = next
+	}
+
+	return remaining
+}
+
+func totalDuration(Periods []Period) time.Duration {
+	var total time.Duration
+	for _, k := range Periods {
+		total += k.Duration()
+	}
+
+	return total
+}
@@ -0,0 +1,70 @@
+package reporting
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+//base is the start of the day all periods of the tests are relative to
+var base = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+//hours returns the period between the two hours of the base day
+func hours(From, To float64) Period {
+	return Period{From: base.Add(time.Duration(From * float64(time.Hour))), To: base.Add(time.Duration(To * float64(time.Hour)))}
+}
+
+func TestMerge(t *testing.T) {
+	cases := []struct {
+		name    string
+		periods []Period
+		want    []Period
+	}{
+		{"empty", nil, []Period{}},
+		{"disjoint unsorted", []Period{hours(5, 6), hours(1, 2)}, []Period{hours(1, 2), hours(5, 6)}},
+		{"overlapping", []Period{hours(1, 3), hours(2, 4)}, []Period{hours(1, 4)}},
+		{"touching", []Period{hours(1, 2), hours(2, 3)}, []Period{hours(1, 3)}},
+		{"contained", []Period{hours(1, 5), hours(2, 3)}, []Period{hours(1, 5)}},
+		{"empty periods are dropped", []Period{hours(2, 2), hours(4, 3), hours(5, 6)}, []Period{hours(5, 6)}},
+	}
+
+	for _, k := range cases {
+		if got := merge(k.periods); !reflect.DeepEqual(got, k.want) {
+			t.Errorf("%s: got %v, want %v", k.name, got, k.want)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	cases := []struct {
+		name    string
+		exclude []Period
+		want    []Period
+	}{
+		{"nothing", nil, []Period{hours(2, 10)}},
+		{"outside", []Period{hours(0, 1), hours(11, 12)}, []Period{hours(2, 10)}},
+		{"touching", []Period{hours(0, 2), hours(10, 12)}, []Period{hours(2, 10)}},
+		{"start", []Period{hours(1, 4)}, []Period{hours(4, 10)}},
+		{"end", []Period{hours(8, 11)}, []Period{hours(2, 8)}},
+		{"middle", []Period{hours(4, 5), hours(6, 7)}, []Period{hours(2, 4), hours(5, 6), hours(7, 10)}},
+		{"everything", []Period{hours(0, 12)}, []Period{}},
+	}
+
+	for _, k := range cases {
+		if got := subtract(hours(2, 10), k.exclude); !reflect.DeepEqual(got, k.want) {
+			t.Errorf("%s: got %v, want %v", k.name, got, k.want)
+		}
+		if got, want := totalDuration(subtract(hours(2, 10), k.exclude)), totalDuration(k.want); got != want {
+			t.Errorf("%s: total duration %s, want %s", k.name, got, want)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	if got := hours(1, 5).clip(hours(2, 4)); got != hours(2, 4) {
+		t.Fatal("period wasn't clipped:", got)
+	}
+	if got := hours(6, 8).clip(hours(2, 4)); got.Duration() != 0 {
+		t.Fatal("period outside of the bounds has a duration:", got)
+	}
+}
@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/clock"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Execution is a single due execution of an item on an agent
+type Execution struct {
+	AgentID primitive.ObjectID
+	Item    models.Item
+	Due     time.Time
+}
+
+//Scheduler calculates when the items of a set of agents have to be executed
+//The slots of an item are calculated from its schedule on the agent (see models.Schedule)
+//Interval slots are shifted by a phase derived from the agent and item ID
+//This spreads the executions of items with the same interval evenly, while the timeline stays deterministic
+type Scheduler struct {
+	Clock clock.Clock
+	//Jitter additionally delays every execution by up to Jitter * the time until the following slot (0 - 1)
+	//The delay is derived from the slot, so the timeline stays deterministic
+	Jitter float64
+
+	mutex   sync.Mutex
+	entries map[key]*entry
+}
+
+type key struct {
+	agent primitive.ObjectID
+	item  primitive.ObjectID
+}
+
+type entry struct {
+	item     models.Item
+	schedule models.Schedule
+	//slot is the next slot of the item, the execution is due at slot + jitter
+	slot time.Time
+	//following is the slot after slot, it limits the jitter
+	following time.Time
+	//last is the slot executed the last time, it is zero if the item wasn't executed yet
+	last time.Time
+}
+
+//set moves the item to the specified slot
+func (e *entry) set(K key, Slot time.Time) {
+	e.slot = Slot
+	e.following = time.Time{}
+	if !Slot.IsZero() {
+		e.following = next(K, e.schedule, Slot)
+	}
+}
+
+//New returns an empty scheduler using the specified clock
+func New(Clock clock.Clock) *Scheduler {
+	return &Scheduler{Clock: Clock, entries: make(map[key]*entry)}
+}
+
+//Update replaces the scheduled items with the items of the specified agents
+//The agents have to be populated, only scrapable agents and items checked on the os of the agent are scheduled
+//Items which are already scheduled keep their next slot, if their schedule changed the next slot is calculated from the last execution using the new schedule
+func (s *Scheduler) Update(Agents []models.Agent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.Clock.Now()
+	entries := make(map[key]*entry)
+
+	for _, agent := range Agents {
+		if !agent.Scrapable() {
+			continue
+		}
+
+		for _, item := range agent.GetAllItems() {
+			if item.CheckOn != agent.OS {
+				continue
+			}
+
+			k := key{agent: agent.ID, item: item.ID}
+			schedule := agent.Schedule(item)
+			if schedule.Validate() != nil {
+				continue
+			}
+
+			e, found := s.entries[k]
+			if !found {
+				e = &entry{schedule: schedule}
+				e.set(k, next(k, schedule, now))
+			} else if !reflect.DeepEqual(e.schedule, schedule) {
+				from := e.last
+				if from.IsZero() {
+					from = now
+				}
+				e.schedule = schedule
+				e.set(k, next(k, schedule, from))
+			}
+			e.item = item
+			if e.slot.IsZero() {
+				//The cron expression never matches
+				continue
+			}
+			entries[k] = e
+		}
+	}
+
+	s.entries = entries
+}
+
+//Due returns all executions which are due at the current time of the clock and advances their items to the next slot
+//Every item is only returned once, even if multiple slots were missed
+func (s *Scheduler) Due() []Execution {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.Clock.Now()
+	due := make([]Execution, 0)
+
+	for k, e := range s.entries {
+		at := s.at(k, e.slot, e.following)
+		if at.After(now) {
+			continue
+		}
+
+		due = append(due, Execution{AgentID: k.agent, Item: e.item, Due: at})
+
+		e.last = e.slot
+		slot := e.following
+		if !slot.IsZero() && !slot.After(now) {
+			//Missed slots are skipped instead of being caught up at once
+			slot = next(k, e.schedule, now)
+		}
+		e.set(k, slot)
+		if e.slot.IsZero() {
+			delete(s.entries, k)
+		}
+	}
+
+	sortExecutions(due)
+	return due
+}
+
+//Next returns the time the next execution is due
+//The returned bool is false if no items are scheduled
+func (s *Scheduler) Next() (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var first time.Time
+	for k, e := range s.entries {
+		if at := s.at(k, e.slot, e.following); first.IsZero() || at.Before(first) {
+			first = at
+		}
+	}
+
+	return first, !first.IsZero()
+}
+
+//Timeline returns all executions due in [From, To) ordered by their due time, without changing the state of the scheduler
+//Executions before the next slot of an item (e.g. already executed ones) and missed slots aren't returned
+func (s *Scheduler) Timeline(From time.Time, To time.Time) []Execution {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.Clock.Now()
+	timeline := make([]Execution, 0)
+	for k, e := range s.entries {
+		slot, following := e.slot, e.following
+		for !slot.IsZero() && slot.Before(To) {
+			at := s.at(k, slot, following)
+			if !at.Before(From) && at.Before(To) {
+				timeline = append(timeline, Execution{AgentID: k.agent, Item: e.item, Due: at})
+			}
+
+			//Missed slots are skipped like in Due
+			if !following.IsZero() && !following.After(now) {
+				following = next(k, e.schedule, now)
+			}
+			slot = following
+			if !slot.IsZero() {
+				following = next(k, e.schedule, slot)
+			}
+		}
+	}
+
+	sortExecutions(timeline)
+	return timeline
+}
+
+//Phase returns the offset of the slots of the item on the agent within the interval
+//The phase is the same fraction of the interval for every interval, so it's kept if the interval changes
+func Phase(AgentID primitive.ObjectID, ItemID primitive.ObjectID, Interval time.Duration) time.Duration {
+	return fraction(Interval, AgentID[:], ItemID[:])
+}
+
+//at returns the time the execution of the slot is due
+func (s *Scheduler) at(K key, Slot time.Time, Following time.Time) time.Time {
+	jitter := s.Jitter
+	if jitter <= 0 {
+		return Slot
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	//The jitter is smaller than the time until the following slot, so the executions keep their order
+	if Following.IsZero() {
+		return Slot
+	}
+
+	var slot [8]byte
+	binary.BigEndian.PutUint64(slot[:], uint64(Slot.UnixNano()))
+	return Slot.Add(fraction(time.Duration(float64(Following.Sub(Slot))*jitter), K.agent[:], K.item[:], slot[:]))
+}
+
+//next returns the first slot of the item which is after the specified time, it is zero if there is none
+func next(K key, Schedule models.Schedule, After time.Time) time.Time {
+	return Schedule.Next(After, ratio(K.agent[:], K.item[:]))
+}
+
+//fraction returns a deterministic duration in [0, Max) derived from the data
+func fraction(Max time.Duration, Data ...[]byte) time.Duration {
+	return time.Duration(ratio(Data...) * float64(Max))
+}
+
+//ratio returns a deterministic number in [0, 1) derived from the data
+func ratio(Data ...[]byte) float64 {
+	sum := sha256.Sum256(bytes.Join(Data, nil))
+	return float64(binary.BigEndian.Uint64(sum[:8])) / (1 << 64)
+}
+
+func sortExecutions(Executions []Execution) {
+	sort.Slice(Executions, func(i, j int) bool {
+		a, b := Executions[i], Executions[j]
+		if !a.Due.Equal(b.Due) {
+			return a.Due.Before(b.Due)
+		}
+		if c := bytes.Compare(a.AgentID[:], b.AgentID[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(a.Item.ID[:], b.Item.ID[:]) < 0
+	})
+}
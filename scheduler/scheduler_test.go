@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/clock"
+	"github.com/FlowKeeper/FlowUtils/v2/internal/fixtures"
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//start is an arbitrary point in time, which isn't aligned to any interval used in the tests
+var start = time.Date(2021, 6, 1, 8, 0, 0, 123456789, time.UTC)
+
+//withItems returns a linux agent with a template containing the items
+func withItems(Items ...models.Item) models.Agent {
+	return fixtures.Agent("web1", fixtures.Template("linux", Items, nil))
+}
+
+//withInterval returns a linux item with the specified interval
+func withInterval(Interval int) models.Item {
+	item := fixtures.Item("item")
+	item.Interval = Interval
+
+	return item
+}
+
+func newTestScheduler(Jitter float64, Agents ...models.Agent) (*Scheduler, *clock.ManualClock) {
+	manual := clock.NewManualClock(start)
+	scheduler := New(manual)
+	scheduler.Jitter = Jitter
+	scheduler.Update(Agents)
+
+	return scheduler, manual
+}
+
+//offset returns the position of the time within the interval grid anchored at the unix epoch
+func offset(At time.Time, Interval time.Duration) time.Duration {
+	return At.Sub(time.Unix(0, 0)) % Interval
+}
+
+func TestPhaseStableAcrossIntervals(t *testing.T) {
+	item := fixtures.Item("item")
+	agent := withItems(item)
+	scheduler, manual := newTestScheduler(0, agent)
+
+	for _, k := range scheduler.Timeline(start, start.Add(5*time.Minute)) {
+		if got, want := offset(k.Due, time.Minute), Phase(agent.ID, item.ID, time.Minute); got != want {
+			t.Fatalf("execution at %s has offset %s, want phase %s", k.Due, got, want)
+		}
+	}
+
+	//The phase is the same fraction of every interval
+	if short, long := Phase(agent.ID, item.ID, time.Minute), Phase(agent.ID, item.ID, 2*time.Minute); long-2*short < -time.Nanosecond || long-2*short > time.Nanosecond {
+		t.Fatal("phase isn't a fraction of the interval:", short, long)
+	}
+
+	//Execute the item once, the new schedule continues from the last execution
+	first, _ := scheduler.Next()
+	manual.Set(first)
+	if due := scheduler.Due(); len(due) != 1 {
+		t.Fatal("got", len(due), "executions")
+	}
+
+	agent.Templates[0].Items[0].Interval = 120
+	scheduler.Update([]models.Agent{agent})
+
+	next, ok := scheduler.Next()
+	if !ok || !next.After(first) || next.Sub(first) > 2*time.Minute {
+		t.Fatal("next slot after the interval change is", next)
+	}
+	timeline := scheduler.Timeline(start, start.Add(10*time.Minute))
+	if len(timeline) == 0 || !timeline[0].Due.Equal(next) {
+		t.Fatal("timeline doesn't start with the next slot:", timeline)
+	}
+	for _, k := range timeline {
+		if got, want := offset(k.Due, 2*time.Minute), Phase(agent.ID, item.ID, 2*time.Minute); got != want {
+			t.Fatalf("execution at %s has offset %s, want phase %s", k.Due, got, want)
+		}
+		if k.Item.Interval != 120 {
+			t.Fatal("item wasn't updated:", k.Item.Interval)
+		}
+	}
+}
+
+func TestPhaseSpreadsItems(t *testing.T) {
+	items := make([]models.Item, 0)
+	for i := 0; i < 10; i++ {
+		items = append(items, fixtures.Item("item"))
+	}
+	scheduler, _ := newTestScheduler(0, withItems(items...))
+
+	timeline := scheduler.Timeline(start, start.Add(time.Minute))
+	if len(timeline) != len(items) {
+		t.Fatal("got", len(timeline), "executions")
+	}
+	if timeline[0].Due.Equal(timeline[len(timeline)-1].Due) {
+		t.Fatal("items with the same interval are executed at the same time")
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	for _, jitter := range []float64{0.25, 1, 5} {
+		item := fixtures.Item("item")
+		agent := withItems(item)
+		scheduler, _ := newTestScheduler(jitter, agent)
+
+		k := key{agent: agent.ID, item: item.ID}
+		schedule := agent.Schedule(item)
+		limit := jitter
+		if limit > 1 {
+			limit = 1
+		}
+
+		timeline := scheduler.Timeline(start, start.Add(time.Hour))
+		if len(timeline) < 59 {
+			t.Fatal("got", len(timeline), "executions")
+		}
+
+		slot := next(k, schedule, start)
+		jittered := false
+		for _, execution := range timeline {
+			following := next(k, schedule, slot)
+			if execution.Due.Before(slot) || !execution.Due.Before(following) {
+				t.Fatalf("jitter %v: execution of slot %s is due at %s, following slot is %s", jitter, slot, execution.Due, following)
+			}
+			if delay := execution.Due.Sub(slot); delay >= time.Duration(limit*float64(following.Sub(slot))) {
+				t.Fatalf("jitter %v: execution of slot %s is delayed by %s", jitter, slot, delay)
+			}
+			if execution.Due.After(slot) {
+				jittered = true
+			}
+			slot = following
+		}
+		if !jittered {
+			t.Fatalf("jitter %v: no execution was delayed", jitter)
+		}
+	}
+}
+
+func TestDueSkipsMissedSlots(t *testing.T) {
+	item := fixtures.Item("item")
+	scheduler, manual := newTestScheduler(0, withItems(item))
+
+	first, ok := scheduler.Next()
+	if !ok {
+		t.Fatal("item wasn't scheduled")
+	}
+	manual.Set(first.Add(-time.Nanosecond))
+	if due := scheduler.Due(); len(due) != 0 {
+		t.Fatal("execution is due too early:", due)
+	}
+
+	//Five slots are missed, only the first one is returned
+	manual.Set(first.Add(5*time.Minute + time.Second))
+	due := scheduler.Due()
+	if len(due) != 1 || !due[0].Due.Equal(first) || due[0].Item.ID != item.ID {
+		t.Fatal("expected a single execution of the first slot:", due)
+	}
+	if due := scheduler.Due(); len(due) != 0 {
+		t.Fatal("missed slots are caught up:", due)
+	}
+
+	next, _ := scheduler.Next()
+	if want := first.Add(6 * time.Minute); !next.Equal(want) {
+		t.Fatal("next slot is", next, "want", want)
+	}
+
+	manual.Set(next)
+	if due := scheduler.Due(); len(due) != 1 || !due[0].Due.Equal(next) {
+		t.Fatal("expected the execution of the next slot:", due)
+	}
+}
+
+func TestTimelineDeterministic(t *testing.T) {
+	agents := []models.Agent{
+		withItems(withInterval(30), withInterval(45)),
+		withItems(fixtures.Item("item")),
+	}
+	scheduler, manual := newTestScheduler(0.5, agents...)
+	other, _ := newTestScheduler(0.5, agents...)
+
+	from, to := start, start.Add(10*time.Minute)
+	timeline := scheduler.Timeline(from, to)
+	if !reflect.DeepEqual(timeline, other.Timeline(from, to)) {
+		t.Fatal("schedulers with the same agents have different timelines")
+	}
+	if !reflect.DeepEqual(timeline, scheduler.Timeline(from, to)) {
+		t.Fatal("timeline changed the state of the scheduler")
+	}
+	for i := 1; i < len(timeline); i++ {
+		if timeline[i].Due.Before(timeline[i-1].Due) {
+			t.Fatal("timeline isn't ordered:", timeline[i-1].Due, timeline[i].Due)
+		}
+	}
+
+	//Due returns the executions of the timeline if it's called at their due times
+	executed := make([]Execution, 0)
+	for _, k := range timeline {
+		manual.Set(k.Due)
+		executed = append(executed, scheduler.Due()...)
+	}
+	if !reflect.DeepEqual(executed, timeline) {
+		t.Fatalf("executions differ from the timeline:\n%v\n%v", executed, timeline)
+	}
+}
+
+func TestUpdateFilters(t *testing.T) {
+	linux := fixtures.Item("linux")
+	windows := fixtures.Item("windows")
+	windows.CheckOn = models.Windows
+	invalid := withInterval(0)
+	overridden := withInterval(0)
+
+	agent := withItems(linux, windows, invalid, overridden)
+	agent.ItemSchedules = []models.ItemSchedule{{ItemID: overridden.ID, Schedule: models.Schedule{Interval: 30}}}
+
+	disabled := withItems(fixtures.Item("item"))
+	disabled.Enabled = false
+	deleted := withItems(fixtures.Item("item"))
+	deleted.LifecycleState = models.LifecycleDeleted
+
+	scheduler, _ := newTestScheduler(0, agent, disabled, deleted)
+
+	scheduled := make(map[primitive.ObjectID]bool)
+	for _, k := range scheduler.Timeline(start, start.Add(time.Minute)) {
+		if k.AgentID != agent.ID {
+			t.Fatal("item of an agent which isn't scrapable was scheduled")
+		}
+		scheduled[k.Item.ID] = true
+	}
+
+	if !scheduled[linux.ID] || !scheduled[overridden.ID] {
+		t.Fatal("items checked on the os of the agent weren't scheduled:", scheduled)
+	}
+	if scheduled[windows.ID] {
+		t.Fatal("item checked on another os was scheduled")
+	}
+	if scheduled[invalid.ID] {
+		t.Fatal("item without schedule was scheduled")
+	}
+
+	//Agents which aren't passed anymore are removed
+	scheduler.Update(nil)
+	if _, ok := scheduler.Next(); ok {
+		t.Fatal("items of removed agents are still scheduled")
+	}
+}
@@ -0,0 +1,181 @@
+package templating
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/FlowKeeper/FlowUtils/v2/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Data is passed to the templates when a notification is rendered
+//Example: {{ .Trigger.Name }} on {{ .Agent.Name }} is {{ .State }} since {{ duration .Duration }}
+type Data struct {
+	Agent   AgentData
+	Trigger TriggerData
+	//State is either PROBLEM or RESOLVED
+	State       string
+	Problematic bool
+	//Time is the time of the state change
+	Time  time.Time
+	Error string
+	//Duration is the time since the problem started (for recoveries the total length of the problem)
+	Duration time.Duration
+	//Values contains the newest results of the items used by the trigger expression (indexed by item name)
+	Values map[string]Value
+}
+
+//AgentData contains the agent fields available in templates
+type AgentData struct {
+	ID, Name, Description string
+	Endpoint              string
+	OS                    string
+	Tags                  []string
+}
+
+//TriggerData contains the trigger fields available in templates
+type TriggerData struct {
+	ID, Name, Description string
+	Severity              string
+	Expression            string
+}
+
+//Value is a single item result available in templates
+//It is printed as value followed by the unit of the item
+type Value struct {
+	Value      string
+	Unit       string
+	CapturedAt time.Time
+}
+
+func (v Value) String() string {
+	if v.Unit == "" {
+		return v.Value
+	}
+
+	return v.Value + " " + v.Unit
+}
+
+//NewData collects the template data for a state change of the trigger on the agent
+//The agent has to be populated, so the units of the items can be resolved
+//The severity is the effective severity of the trigger assignment, the one of the event is only used if the agent has no assignment
+func NewData(Agent models.Agent, Trigger models.Trigger, Event models.TriggerEvent, Values map[string]models.Result) Data {
+	data := Data{
+		Agent: AgentData{
+			ID:          Agent.ID.Hex(),
+			Name:        Agent.Name,
+			Description: Agent.Description,
+			Endpoint:    Agent.Endpoint,
+			OS:          Agent.OS.String(),
+			Tags:        Agent.Tags,
+		},
+		Trigger: TriggerData{
+			ID:          Trigger.ID.Hex(),
+			Name:        Trigger.Name,
+			Description: Trigger.Description,
+			Severity:    Event.Severity.String(),
+			Expression:  Trigger.Expression,
+		},
+		State:       "RESOLVED",
+		Problematic: Event.Problematic,
+		Time:        Event.Time,
+		Error:       Event.Error,
+		Values:      make(map[string]Value),
+	}
+	if Event.Problematic {
+		data.State = "PROBLEM"
+	}
+
+	if assignment, err := Agent.GetTriggerMappingByTriggerID(Trigger.ID); err == nil {
+		//The severity may have been changed on acknowledgement, so the one of the assignment is used instead of the one of the event
+		data.Trigger.Severity = assignment.EffectiveSeverity(Trigger).String()
+
+		if !assignment.ProblemSince.IsZero() && Event.Time.After(assignment.ProblemSince) {
+			data.Duration = Event.Time.Sub(assignment.ProblemSince)
+		}
+	}
+
+	units := make(map[primitive.ObjectID]string)
+	for _, k := range Agent.GetAllItems() {
+		units[k.ID] = k.Unit
+	}
+
+	for name, result := range Values {
+		value := Value{Unit: units[result.ItemID], CapturedAt: result.CapturedAt}
+		if result.Type == models.Text {
+			value.Value = result.ValueString
+		} else {
+			value.Value = strconv.FormatFloat(result.ValueNumeric, 'f', -1, 64)
+		}
+		data.Values[name] = value
+	}
+
+	return data
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	//duration rounds the duration to seconds
+	"duration": func(Duration time.Duration) string {
+		return Duration.Round(time.Second).String()
+	},
+	"formatTime": func(Layout string, Time time.Time) string {
+		return Time.Format(Layout)
+	},
+}
+
+//sampleData is used to validate that templates only reference existing fields
+var sampleData = Data{
+	Agent:   AgentData{Name: "agent", Endpoint: "agent.local", OS: "Linux", Tags: []string{}},
+	Trigger: TriggerData{Name: "trigger", Severity: "HIGH"},
+	State:   "PROBLEM",
+	Time:    time.Unix(0, 0),
+	Values:  map[string]Value{},
+}
+
+//Validate checks if the subject and body of the template can be parsed and rendered
+//Templates referencing unknown fields or functions are rejected
+func Validate(Template models.MessageTemplate) error {
+	if _, _, err := Render(Template, sampleData); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//Render renders the subject and body of the template
+func Render(Template models.MessageTemplate, Data Data) (string, string, error) {
+	subject, err := execute("subject", Template.Subject, Data)
+	if err != nil {
+		return "", "", err
+	}
+
+	body, err := execute("body", Template.Body, Data)
+	if err != nil {
+		return "", "", err
+	}
+
+	//Header injection isn't possible, as subjects can't span multiple lines
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	return subject, body, nil
+}
+
+func execute(Name string, Text string, Data Data) (string, error) {
+	parsed, err := template.New(Name).Funcs(funcs).Option("missingkey=zero").Parse(Text)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse %s template: %w", Name, err)
+	}
+
+	var output bytes.Buffer
+	if err := parsed.Execute(&output, Data); err != nil {
+		return "", fmt.Errorf("couldn't render %s template: %w", Name, err)
+	}
+
+	return output.String(), nil
+}